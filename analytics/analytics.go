@@ -0,0 +1,304 @@
+// Package analytics computes response time and turnout statistics from the incident rosters kept by the archive
+// package.
+//
+// Turnout is the time from an incident arriving to a member being called (pressing respond), and the ETA error is the
+// time from the ETA a member gave to their responder board entry expiring, which happens when they arrive or are
+// cleared.  Durations are reported in seconds.
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmmorris1975/iarapi/archive"
+)
+
+// Stats summarizes a set of durations, in seconds
+type Stats struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+}
+
+// IncidentMetrics are the turnout metrics of a single incident
+type IncidentMetrics struct {
+	IncidentId  int       `json:"incidentId"`
+	ArrivedOn   time.Time `json:"arrivedOn"`
+	Responders  int       `json:"responders"`
+	MutualAid   int       `json:"mutualAid"`
+	FirstCalled float64   `json:"firstCalled"`
+	Turnout     Stats     `json:"turnout"`
+}
+
+// MemberMetrics are the turnout and ETA metrics of a single member, across all incidents they responded to.  Mutual
+// aid responders from other agencies are included, identified by their responder id as they have no member id.
+type MemberMetrics struct {
+	MemberId    int    `json:"memberId"`
+	ResponderId string `json:"responderId,omitempty"`
+	Name        string `json:"name"`
+	MutualAid   bool   `json:"mutualAid"`
+	Responses   int    `json:"responses"`
+	Turnout     Stats  `json:"turnout"`
+	EtaError    Stats  `json:"etaError"`
+}
+
+// PeriodMetrics are the turnout metrics of the incidents arriving in an hour of the day or a day of the week
+type PeriodMetrics struct {
+	Period    string `json:"period"`
+	Incidents int    `json:"incidents"`
+	Turnout   Stats  `json:"turnout"`
+}
+
+// Report holds the metrics computed from a set of rosters
+type Report struct {
+	Incidents      []*IncidentMetrics `json:"incidents"`
+	Members        []*MemberMetrics   `json:"members"`
+	ByHour         []*PeriodMetrics   `json:"byHour"`
+	ByWeekday      []*PeriodMetrics   `json:"byWeekday"`
+	Turnout        Stats              `json:"turnout"`
+	EtaError       Stats              `json:"etaError"`
+	Responses      int                `json:"responses"`
+	MutualAidShare float64            `json:"mutualAidShare"`
+}
+
+type memberSamples struct {
+	m        *MemberMetrics
+	turnout  []float64
+	etaError []float64
+}
+
+// Compute calculates the metrics of the rosters.  Incident times without a zone offset are taken to be in loc, which
+// is also used to group incidents by hour and weekday.  Pass the Zone of the archive the rosters are from; if loc is
+// nil, time.Local is used like the archive does.  Rosters for incidents with an unparseable arrival time are skipped.
+func Compute(rosters []*archive.Roster, loc *time.Location) *Report {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	r := &Report{Incidents: make([]*IncidentMetrics, 0, len(rosters))}
+
+	members := make(map[string]*memberSamples)
+	hours := make([][]float64, 24)
+	hourCounts := make([]int, 24)
+	days := make([][]float64, 7)
+	dayCounts := make([]int, 7)
+
+	var allTurnout, allEta []float64
+	var mutualAid int
+
+	for _, ro := range rosters {
+		arrived, err := ro.Incident.ArrivedTimeIn(loc)
+		if err != nil {
+			continue
+		}
+		arrived = arrived.In(loc)
+
+		im := &IncidentMetrics{IncidentId: ro.Incident.Id, ArrivedOn: arrived, Responders: len(ro.Responders)}
+		turnout := make([]float64, 0, len(ro.Responders))
+
+		for _, e := range ro.Responders {
+			t := e.CalledAt.Sub(arrived).Seconds()
+			turnout = append(turnout, t)
+
+			if e.IsMutualAid {
+				im.MutualAid++
+			}
+
+			key := strconv.Itoa(e.MemberId)
+			if e.MemberId == 0 {
+				key = "r:" + e.ResponderId
+			}
+
+			ms, ok := members[key]
+			if !ok {
+				ms = &memberSamples{m: &MemberMetrics{MemberId: e.MemberId, ResponderId: e.ResponderId}}
+				members[key] = ms
+			}
+			ms.m.Name = e.Name
+			ms.m.MutualAid = e.IsMutualAid
+			ms.m.Responses++
+			ms.turnout = append(ms.turnout, t)
+
+			if !e.EtaBefore.IsZero() && !e.Expired.IsZero() {
+				eta := e.Expired.Sub(e.EtaBefore).Seconds()
+				ms.etaError = append(ms.etaError, eta)
+				allEta = append(allEta, eta)
+			}
+		}
+
+		if len(turnout) > 0 {
+			im.FirstCalled = minOf(turnout)
+		}
+		im.Turnout = newStats(turnout)
+		r.Incidents = append(r.Incidents, im)
+
+		hours[arrived.Hour()] = append(hours[arrived.Hour()], turnout...)
+		hourCounts[arrived.Hour()]++
+		days[arrived.Weekday()] = append(days[arrived.Weekday()], turnout...)
+		dayCounts[arrived.Weekday()]++
+
+		allTurnout = append(allTurnout, turnout...)
+		mutualAid += im.MutualAid
+	}
+
+	r.Members = make([]*MemberMetrics, 0, len(members))
+	for _, ms := range members {
+		ms.m.Turnout = newStats(ms.turnout)
+		ms.m.EtaError = newStats(ms.etaError)
+		r.Members = append(r.Members, ms.m)
+	}
+
+	sort.Slice(r.Members, func(i, j int) bool {
+		if r.Members[i].Name == r.Members[j].Name {
+			return r.Members[i].MemberId < r.Members[j].MemberId
+		}
+		return r.Members[i].Name < r.Members[j].Name
+	})
+
+	r.ByHour = make([]*PeriodMetrics, 24)
+	for h := range hours {
+		r.ByHour[h] = &PeriodMetrics{Period: strconv.Itoa(h), Incidents: hourCounts[h], Turnout: newStats(hours[h])}
+	}
+
+	r.ByWeekday = make([]*PeriodMetrics, 7)
+	for d := range days {
+		r.ByWeekday[d] = &PeriodMetrics{Period: time.Weekday(d).String(), Incidents: dayCounts[d], Turnout: newStats(days[d])}
+	}
+
+	r.Turnout = newStats(allTurnout)
+	r.EtaError = newStats(allEta)
+	r.Responses = len(allTurnout)
+	if r.Responses > 0 {
+		r.MutualAidShare = float64(mutualAid) / float64(r.Responses)
+	}
+
+	return r
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteIncidentsCSV writes the per-incident metrics as CSV, with a header row
+func (r *Report) WriteIncidentsCSV(w io.Writer) error {
+	header := append([]string{"incident_id", "arrived_on", "responders", "mutual_aid", "first_called"},
+		statsHeader("turnout")...)
+
+	rows := make([][]string, 0, len(r.Incidents))
+	for _, im := range r.Incidents {
+		rec := []string{
+			strconv.Itoa(im.IncidentId),
+			im.ArrivedOn.Format(time.RFC3339),
+			strconv.Itoa(im.Responders),
+			strconv.Itoa(im.MutualAid),
+			formatSeconds(im.FirstCalled),
+		}
+		rows = append(rows, append(rec, im.Turnout.record()...))
+	}
+
+	return writeCSV(w, header, rows)
+}
+
+// WriteMembersCSV writes the per-member metrics as CSV, with a header row
+func (r *Report) WriteMembersCSV(w io.Writer) error {
+	header := []string{"member_id", "responder_id", "name", "mutual_aid", "responses"}
+	header = append(append(header, statsHeader("turnout")...), statsHeader("eta_error")...)
+
+	rows := make([][]string, 0, len(r.Members))
+	for _, m := range r.Members {
+		rec := []string{
+			strconv.Itoa(m.MemberId),
+			m.ResponderId,
+			m.Name,
+			strconv.FormatBool(m.MutualAid),
+			strconv.Itoa(m.Responses),
+		}
+		rows = append(rows, append(append(rec, m.Turnout.record()...), m.EtaError.record()...))
+	}
+
+	return writeCSV(w, header, rows)
+}
+
+// WritePeriodsCSV writes the hour of day metrics followed by the weekday metrics as CSV, with a header row
+func (r *Report) WritePeriodsCSV(w io.Writer) error {
+	header := append([]string{"period", "incidents"}, statsHeader("turnout")...)
+
+	rows := make([][]string, 0, len(r.ByHour)+len(r.ByWeekday))
+	for _, p := range append(append([]*PeriodMetrics{}, r.ByHour...), r.ByWeekday...) {
+		rows = append(rows, append([]string{p.Period, strconv.Itoa(p.Incidents)}, p.Turnout.record()...))
+	}
+
+	return writeCSV(w, header, rows)
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func statsHeader(prefix string) []string {
+	return []string{prefix + "_count", prefix + "_mean", prefix + "_p50", prefix + "_p90"}
+}
+
+func (s Stats) record() []string {
+	return []string{strconv.Itoa(s.Count), formatSeconds(s.Mean), formatSeconds(s.P50), formatSeconds(s.P90)}
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 1, 64)
+}
+
+func newStats(samples []float64) Stats {
+	if len(samples) < 1 {
+		return Stats{}
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return Stats{
+		Count: len(sorted),
+		Mean:  sum / float64(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted samples
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func minOf(v []float64) float64 {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
@@ -0,0 +1,166 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/archive"
+)
+
+var (
+	testLoc = time.FixedZone("EST", -5*3600)
+
+	// Friday 2022-11-04 at 10:00 and 22:00 local time
+	testRosters = []*archive.Roster{
+		{
+			Incident: &iarapi.Incident{Id: 1, ArrivedOn: "2022-11-04T10:00:00"},
+			Responders: []*archive.RosterEntry{
+				{MemberId: 10, Name: "Able", CalledAt: localTime(10, 1, 0), EtaBefore: localTime(10, 10, 0), Expired: localTime(10, 12, 0)},
+				{MemberId: 20, Name: "Baker", CalledAt: localTime(10, 3, 0)},
+				{ResponderId: "x1", Name: "Xray", CalledAt: localTime(10, 5, 0), IsMutualAid: true},
+			},
+		},
+		{
+			Incident: &iarapi.Incident{Id: 2, ArrivedOn: "2022-11-04T22:00:00"},
+			Responders: []*archive.RosterEntry{
+				{MemberId: 10, Name: "Able", CalledAt: localTime(22, 3, 0), EtaBefore: localTime(22, 20, 0), Expired: localTime(22, 16, 0)},
+			},
+		},
+		{
+			Incident: &iarapi.Incident{Id: 3, ArrivedOn: "bogus"},
+		},
+	}
+)
+
+func localTime(h, m, s int) time.Time {
+	return time.Date(2022, 11, 4, h, m, s, 0, testLoc)
+}
+
+func TestCompute(t *testing.T) {
+	r := Compute(testRosters, testLoc)
+
+	wantIncidents := []*IncidentMetrics{
+		{IncidentId: 1, ArrivedOn: localTime(10, 0, 0), Responders: 3, MutualAid: 1, FirstCalled: 60,
+			Turnout: Stats{Count: 3, Mean: 180, P50: 180, P90: 300}},
+		{IncidentId: 2, ArrivedOn: localTime(22, 0, 0), Responders: 1, FirstCalled: 180,
+			Turnout: Stats{Count: 1, Mean: 180, P50: 180, P90: 180}},
+	}
+	if !reflect.DeepEqual(r.Incidents, wantIncidents) {
+		t.Errorf("Compute() Incidents = %+v, want %+v", r.Incidents, wantIncidents)
+	}
+
+	wantMembers := []*MemberMetrics{
+		{MemberId: 10, Name: "Able", Responses: 2, Turnout: Stats{Count: 2, Mean: 120, P50: 60, P90: 180},
+			EtaError: Stats{Count: 2, Mean: -60, P50: -240, P90: 120}},
+		{MemberId: 20, Name: "Baker", Responses: 1, Turnout: Stats{Count: 1, Mean: 180, P50: 180, P90: 180}},
+		{ResponderId: "x1", Name: "Xray", MutualAid: true, Responses: 1, Turnout: Stats{Count: 1, Mean: 300, P50: 300, P90: 300}},
+	}
+	if !reflect.DeepEqual(r.Members, wantMembers) {
+		t.Errorf("Compute() Members = %+v, want %+v", r.Members, wantMembers)
+	}
+
+	if p := r.ByHour[10]; p.Incidents != 1 || p.Turnout.Count != 3 {
+		t.Errorf("Compute() ByHour[10] = %+v", p)
+	}
+
+	if p := r.ByWeekday[time.Friday]; p.Period != "Friday" || p.Incidents != 2 || p.Turnout.Count != 4 {
+		t.Errorf("Compute() ByWeekday[Friday] = %+v", p)
+	}
+
+	if r.Responses != 4 || r.MutualAidShare != 0.25 {
+		t.Errorf("Compute() Responses = %d, MutualAidShare = %v", r.Responses, r.MutualAidShare)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{p: 0, want: 1},
+		{p: 50, want: 5},
+		{p: 90, want: 9},
+		{p: 95, want: 10},
+		{p: 100, want: 10},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	r := Compute(testRosters, testLoc)
+
+	buf := new(bytes.Buffer)
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Report)
+	if err := json.Unmarshal(buf.Bytes(), got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got.Members, r.Members) {
+		t.Errorf("WriteJSON() Members = %+v, want %+v", got.Members, r.Members)
+	}
+
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+		want  []string
+	}{
+		{
+			name:  "incidents",
+			write: func(b *bytes.Buffer) error { return r.WriteIncidentsCSV(b) },
+			want: []string{
+				"incident_id,arrived_on,responders,mutual_aid,first_called,turnout_count,turnout_mean,turnout_p50,turnout_p90",
+				"1,2022-11-04T10:00:00-05:00,3,1,60.0,3,180.0,180.0,300.0",
+				"2,2022-11-04T22:00:00-05:00,1,0,180.0,1,180.0,180.0,180.0",
+			},
+		},
+		{
+			name:  "members",
+			write: func(b *bytes.Buffer) error { return r.WriteMembersCSV(b) },
+			want: []string{
+				"member_id,responder_id,name,mutual_aid,responses,turnout_count,turnout_mean,turnout_p50,turnout_p90," +
+					"eta_error_count,eta_error_mean,eta_error_p50,eta_error_p90",
+				"10,,Able,false,2,2,120.0,60.0,180.0,2,-60.0,-240.0,120.0",
+				"20,,Baker,false,1,1,180.0,180.0,180.0,0,0.0,0.0,0.0",
+				"0,x1,Xray,true,1,1,300.0,300.0,300.0,0,0.0,0.0,0.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			if err := tt.write(b); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Split(strings.TrimSpace(b.String()), "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	b := new(bytes.Buffer)
+	if err := r.WritePeriodsCSV(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(b.String(), "\n"); n != 1+24+7 {
+		t.Errorf("WritePeriodsCSV() wrote %d lines, want %d", n, 1+24+7)
+	}
+}
@@ -0,0 +1,253 @@
+package analytics
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/archive"
+)
+
+// TimeOfDay are the names of the 6 hour periods incidents are grouped in for participation reports
+var TimeOfDay = []string{"00-06", "06-12", "12-18", "18-24"}
+
+// ParticipationConfig controls the participation report
+type ParticipationConfig struct {
+	// Start and End bound the incidents included when building the report from an archive
+	Start, End time.Time
+
+	// Threshold is the minimum share of incidents, from 0 to 1, a member must respond to
+	Threshold float64
+
+	// Location is used to interpret incident times without a zone offset, and to group incidents by time of day.
+	// time.Local is used if nil, like the archive does.  ArchiveParticipation uses the archive's Zone instead.
+	Location *time.Location
+
+	// Members maps member id to name for all members expected to respond, so those who never responded are
+	// included in the report.  Only members which appear in the rosters are reported if nil.
+	Members map[int]string
+
+	// ResponseCodes name the response code ids, from the ResponderCodes API.  Unnamed codes are shown by id.
+	ResponseCodes []*iarapi.ResponderCode
+
+	// IncludeMutualAid includes responders from other agencies in the report
+	IncludeMutualAid bool
+}
+
+// MemberParticipation is the number of incidents a member responded to, in total and by response code and time of day
+type MemberParticipation struct {
+	MemberId       int            `json:"memberId"`
+	ResponderId    string         `json:"responderId,omitempty"`
+	Name           string         `json:"name"`
+	Responses      int            `json:"responses"`
+	Share          float64        `json:"share"`
+	BelowThreshold bool           `json:"belowThreshold"`
+	ByResponseCode map[string]int `json:"byResponseCode"`
+	ByTimeOfDay    map[string]int `json:"byTimeOfDay"`
+}
+
+// ParticipationReport is the participation of each member over a set of incidents
+type ParticipationReport struct {
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	Threshold   float64                `json:"threshold"`
+	Incidents   int                    `json:"incidents"`
+	ByTimeOfDay map[string]int         `json:"byTimeOfDay"`
+	Codes       []string               `json:"codes"`
+	Members     []*MemberParticipation `json:"members"`
+}
+
+// ArchiveParticipation computes the participation report for the archived incidents between cfg.Start and cfg.End.
+// Incident times are read in the archive's Zone, which replaces cfg.Location.
+func ArchiveParticipation(a *archive.Archive, cfg *ParticipationConfig) *ParticipationReport {
+	c := *cfg
+	c.Location = a.Zone()
+	return Participation(a.Rosters(cfg.Start, cfg.End), &c)
+}
+
+// Participation computes each member's responses against the number of incidents in the rosters.  A member who
+// appears more than once in a roster is counted once for that incident.
+func Participation(rosters []*archive.Roster, cfg *ParticipationConfig) *ParticipationReport {
+	loc := cfg.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	codeNames := make(map[int]string)
+	for _, c := range cfg.ResponseCodes {
+		codeNames[c.Id] = c.KeyEntry
+	}
+
+	r := &ParticipationReport{Start: cfg.Start, End: cfg.End, Threshold: cfg.Threshold, ByTimeOfDay: make(map[string]int)}
+	members := make(map[string]*MemberParticipation)
+	codes := make(map[string]bool)
+
+	newMember := func(id int, responderId, name string) *MemberParticipation {
+		return &MemberParticipation{MemberId: id, ResponderId: responderId, Name: name,
+			ByResponseCode: make(map[string]int), ByTimeOfDay: make(map[string]int)}
+	}
+
+	for id, name := range cfg.Members {
+		members[strconv.Itoa(id)] = newMember(id, "", name)
+	}
+
+	for _, ro := range rosters {
+		var tod string
+		if t, err := ro.Incident.ArrivedTimeIn(loc); err == nil {
+			tod = TimeOfDay[t.In(loc).Hour()/6]
+			r.ByTimeOfDay[tod]++
+		}
+		r.Incidents++
+
+		seen := make(map[string]bool)
+		for _, e := range ro.Responders {
+			if e.IsMutualAid && !cfg.IncludeMutualAid {
+				continue
+			}
+
+			key := strconv.Itoa(e.MemberId)
+			if e.MemberId == 0 {
+				key = "r:" + e.ResponderId
+			}
+
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			m, ok := members[key]
+			if !ok {
+				m = newMember(e.MemberId, e.ResponderId, e.Name)
+				members[key] = m
+			}
+
+			code, ok := codeNames[e.ResponseCodeId]
+			if !ok {
+				code = strconv.Itoa(e.ResponseCodeId)
+			}
+			codes[code] = true
+
+			m.Responses++
+			m.ByResponseCode[code]++
+			if len(tod) > 0 {
+				m.ByTimeOfDay[tod]++
+			}
+		}
+	}
+
+	for c := range codes {
+		r.Codes = append(r.Codes, c)
+	}
+	sort.Strings(r.Codes)
+
+	r.Members = make([]*MemberParticipation, 0, len(members))
+	for _, m := range members {
+		if r.Incidents > 0 {
+			m.Share = float64(m.Responses) / float64(r.Incidents)
+		}
+		m.BelowThreshold = m.Share < cfg.Threshold
+		r.Members = append(r.Members, m)
+	}
+
+	sort.Slice(r.Members, func(i, j int) bool {
+		if r.Members[i].Name == r.Members[j].Name {
+			return r.Members[i].MemberId < r.Members[j].MemberId
+		}
+		return r.Members[i].Name < r.Members[j].Name
+	})
+
+	return r
+}
+
+// Below returns the members whose share of responses is below the threshold
+func (r *ParticipationReport) Below() []*MemberParticipation {
+	below := make([]*MemberParticipation, 0)
+	for _, m := range r.Members {
+		if m.BelowThreshold {
+			below = append(below, m)
+		}
+	}
+	return below
+}
+
+// WriteCSV writes a row for each member, with a header row.  There is a column for each response code and time of
+// day period.
+func (r *ParticipationReport) WriteCSV(w io.Writer) error {
+	header := []string{"member_id", "responder_id", "name", "responses", "incidents", "share", "below_threshold"}
+	for _, c := range r.Codes {
+		header = append(header, "code_"+c)
+	}
+	for _, p := range TimeOfDay {
+		header = append(header, "time_"+p)
+	}
+
+	rows := make([][]string, 0, len(r.Members))
+	for _, m := range r.Members {
+		rec := []string{
+			strconv.Itoa(m.MemberId),
+			m.ResponderId,
+			m.Name,
+			strconv.Itoa(m.Responses),
+			strconv.Itoa(r.Incidents),
+			strconv.FormatFloat(m.Share, 'f', 3, 64),
+			strconv.FormatBool(m.BelowThreshold),
+		}
+		for _, c := range r.Codes {
+			rec = append(rec, strconv.Itoa(m.ByResponseCode[c]))
+		}
+		for _, p := range TimeOfDay {
+			rec = append(rec, strconv.Itoa(m.ByTimeOfDay[p]))
+		}
+		rows = append(rows, rec)
+	}
+
+	return writeCSV(w, header, rows)
+}
+
+// WriteHTML writes the report as a standalone HTML page, with members below the threshold highlighted
+func (r *ParticipationReport) WriteHTML(w io.Writer) error {
+	return participationTemplate.Execute(w, r)
+}
+
+var participationTemplate = template.Must(template.New("participation").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	"periods": func() []string { return TimeOfDay },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Member Participation</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tr.below { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Member Participation</h1>
+<p>{{date .Start}} to {{date .End}}: {{.Incidents}} incidents, minimum {{percent .Threshold}}</p>
+<table>
+<tr><th>Member</th><th>Responses</th><th>Share</th>{{range .Codes}}<th>{{.}}</th>{{end}}{{range periods}}<th>{{.}}</th>{{end}}</tr>
+{{- $r := .}}
+{{- range .Members}}
+<tr{{if .BelowThreshold}} class="below"{{end}}><td>{{.Name}}</td><td>{{.Responses}}</td><td>{{percent .Share}}</td>
+{{- $m := .}}{{range $r.Codes}}<td>{{index $m.ByResponseCode .}}</td>{{end}}
+{{- range periods}}<td>{{index $m.ByTimeOfDay .}}</td>{{end}}</tr>
+{{- end}}
+<tr><td>Incidents</td><td>{{.Incidents}}</td><td></td>{{range .Codes}}<td></td>{{end}}{{range periods}}<td>{{index $r.ByTimeOfDay .}}</td>{{end}}</tr>
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/archive"
+)
+
+func TestParticipation(t *testing.T) {
+	rosters := append(testRosters, &archive.Roster{
+		Incident: &iarapi.Incident{Id: 4, ArrivedOn: "2022-11-05T03:00:00"},
+		Responders: []*archive.RosterEntry{
+			{MemberId: 20, Name: "Baker", CalledAt: localTime(3, 5, 0), ResponseCodeId: 2},
+			{MemberId: 20, Name: "Baker", CalledAt: localTime(3, 6, 0), ResponseCodeId: 2},
+		},
+	})
+
+	cfg := &ParticipationConfig{
+		Threshold:     0.5,
+		Location:      testLoc,
+		Members:       map[int]string{10: "Able", 20: "Baker", 30: "Charlie"},
+		ResponseCodes: []*iarapi.ResponderCode{{Id: 2, KeyEntry: "Station"}},
+	}
+
+	r := Participation(rosters, cfg)
+
+	if r.Incidents != 4 || !reflect.DeepEqual(r.Codes, []string{"0", "Station"}) {
+		t.Errorf("Participation() Incidents = %d, Codes = %v", r.Incidents, r.Codes)
+	}
+
+	if want := map[string]int{"00-06": 1, "06-12": 1, "18-24": 1}; !reflect.DeepEqual(r.ByTimeOfDay, want) {
+		t.Errorf("Participation() ByTimeOfDay = %v, want %v", r.ByTimeOfDay, want)
+	}
+
+	want := []*MemberParticipation{
+		{MemberId: 10, Name: "Able", Responses: 2, Share: 0.5,
+			ByResponseCode: map[string]int{"0": 2}, ByTimeOfDay: map[string]int{"06-12": 1, "18-24": 1}},
+		{MemberId: 20, Name: "Baker", Responses: 2, Share: 0.5,
+			ByResponseCode: map[string]int{"0": 1, "Station": 1}, ByTimeOfDay: map[string]int{"06-12": 1, "00-06": 1}},
+		{MemberId: 30, Name: "Charlie", BelowThreshold: true, ByResponseCode: map[string]int{}, ByTimeOfDay: map[string]int{}},
+	}
+	if !reflect.DeepEqual(r.Members, want) {
+		t.Errorf("Participation() Members = %+v, want %+v", r.Members, want)
+	}
+
+	if below := r.Below(); len(below) != 1 || below[0].MemberId != 30 {
+		t.Errorf("Below() = %+v", below)
+	}
+
+	cfg.IncludeMutualAid = true
+	if r = Participation(rosters, cfg); len(r.Members) != 4 || r.Members[3].ResponderId != "x1" {
+		t.Errorf("Participation() with mutual aid Members = %+v", r.Members)
+	}
+}
+
+type archiveSource struct {
+	incidents iarapi.IncidentList
+}
+
+func (s *archiveSource) SearchIncidents(*iarapi.IncidentSearchRequest) (*iarapi.IncidentList, error) {
+	return &s.incidents, nil
+}
+
+func (s *archiveSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &iarapi.ResponderList{}, nil
+}
+
+func TestArchiveParticipation(t *testing.T) {
+	a, err := archive.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Location = testLoc
+
+	// times are local to the agency, near the edges of the day in EST but not in UTC
+	src := &archiveSource{incidents: iarapi.IncidentList{
+		{Id: 1, ArrivedOn: "2022-11-03T23:30:00", UpdatedOn: "2022-11-03T23:30:00"},
+		{Id: 2, ArrivedOn: "2022-11-04T02:00:00", UpdatedOn: "2022-11-04T02:00:00"},
+		{Id: 3, ArrivedOn: "2022-11-04T22:00:00", UpdatedOn: "2022-11-04T22:00:00"},
+		{Id: 4, ArrivedOn: "2022-11-05T06:00:00", UpdatedOn: "2022-11-05T06:00:00"},
+	}}
+	if _, err = a.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive's zone is used, not the config's
+	cfg := &ParticipationConfig{Location: time.UTC, Start: time.Date(2022, 11, 4, 0, 0, 0, 0, testLoc),
+		End: time.Date(2022, 11, 5, 0, 0, 0, 0, testLoc)}
+
+	r := ArchiveParticipation(a, cfg)
+	if want := map[string]int{"00-06": 1, "18-24": 1}; r.Incidents != 2 || !reflect.DeepEqual(r.ByTimeOfDay, want) {
+		t.Errorf("ArchiveParticipation() incidents = %d by time of day %v, want 2 %v", r.Incidents, r.ByTimeOfDay, want)
+	}
+}
+
+func TestParticipationReport_Write(t *testing.T) {
+	r := Participation(testRosters, &ParticipationConfig{Threshold: 0.75, Location: testLoc})
+
+	b := new(bytes.Buffer)
+	if err := r.WriteCSV(b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"member_id,responder_id,name,responses,incidents,share,below_threshold,code_0,time_00-06,time_06-12,time_12-18,time_18-24",
+		"10,,Able,2,3,0.667,true,2,0,1,0,1",
+		"20,,Baker,1,3,0.333,true,1,0,1,0,0",
+	}
+	if got := strings.Split(strings.TrimSpace(b.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("WriteCSV() = %q, want %q", got, want)
+	}
+
+	b.Reset()
+	r.Members[0].Name = "<Able>"
+	if err := r.WriteHTML(b); err != nil {
+		t.Fatal(err)
+	}
+
+	html := b.String()
+	for _, s := range []string{`<tr class="below"><td>&lt;Able&gt;</td><td>2</td><td>66.7%</td><td>2</td>`, "minimum 75.0%"} {
+		if !strings.Contains(html, s) {
+			t.Errorf("WriteHTML() missing %q in:\n%s", s, html)
+		}
+	}
+}
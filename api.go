@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/publicsuffix"
@@ -19,22 +22,44 @@ var (
 	dashboardHost = `https://dashboard.iamresponding.com`
 	apiBase       = `https://coordinator.iamresponding.com/api`
 	loginUrl      = `https://auth.iamresponding.com/login/member`
+
+	ErrLoginFailed = errors.New("login failed")
 )
 
-func NewClient(agency, user, password string) (*Client, error) {
+func NewClient(agency, user, password string, opts ...ClientOption) (*Client, error) {
 	c := new(Client)
 	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	c.httpClient = http.Client{Jar: jar}
 
-	if err := c.login(agency, user, password); err != nil {
+	for _, o := range opts {
+		o(c)
+	}
+
+	err := c.login(agency, user, password)
+	if c.observer != nil {
+		c.observer.ObserveLogin(err)
+	}
+
+	if err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
 
+// login logs in to the service, keeping the credentials so an expired session can be renewed
 func (c *Client) login(agency, user, password string) error {
-	token, err := c.fetchRequestToken()
+	return c.loginContext(context.Background(), agency, user, password)
+}
+
+// loginContext logs in, with the login spans started from ctx
+func (c *Client) loginContext(ctx context.Context, agency, user, password string) (err error) {
+	ctx, span := c.startSpan(ctx, "iarapi.login")
+	defer func() { endSpan(span, err) }()
+
+	c.agency, c.username, c.password = agency, user, password
+
+	token, err := c.fetchRequestToken(ctx)
 	if err != nil {
 		return err
 	}
@@ -48,24 +73,31 @@ func (c *Client) login(agency, user, password string) error {
 	form.Add("Input.button", "login")
 	form.Add("Input.ReturnUrl", "")
 
-	return c.doLogin(form)
+	c.debug("login", "agency", agency, "form", form)
+	return c.doLogin(ctx, form)
 }
 
 // Get the request verification token from the hidden form field on the HTML login page
 // Passed in login request along with Agency, Username, and Password
-func (c *Client) fetchRequestToken() (string, error) {
-	res, err := c.httpClient.Get(loginUrl)
+func (c *Client) fetchRequestToken(ctx context.Context) (token string, err error) {
+	ctx, span := c.startSpan(ctx, "iarapi.fetchRequestToken")
+	defer func() { endSpan(span, err) }()
+
+	res, err := c.loginGet(ctx, span, c.loginUrl())
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login page: HTTP Status %d", res.StatusCode)
+	}
+
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
 		return "", err
 	}
 
-	var token string
 	doc.FindMatcher(goquery.Single("form.iar-form__form")).ChildrenFiltered("input").Each(func(i int, s *goquery.Selection) {
 		if val, ok := s.Attr("name"); ok {
 			if val == "__RequestVerificationToken" {
@@ -74,34 +106,94 @@ func (c *Client) fetchRequestToken() (string, error) {
 		}
 	})
 
+	if len(token) < 1 {
+		return "", fmt.Errorf("request verification token not found on login page")
+	}
 	return token, nil
 }
 
 // POST login form values to user auth endpoint, then perform oauth authorization
-func (c *Client) doLogin(data url.Values) error {
+func (c *Client) doLogin(ctx context.Context, data url.Values) (err error) {
 	var req *http.Request
 	var res *http.Response
-	var err error
 
-	req, err = http.NewRequest(http.MethodPost, loginUrl, strings.NewReader(data.Encode()))
+	ctx, span := c.startSpan(ctx, "iarapi.doLogin")
+	defer func() { endSpan(span, err) }()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.loginUrl(), strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.AddCookie(&http.Cookie{Name: "CookieConsent", Value: "yes"})
 
+	span.SetAttributes(Attribute{Key: AttrHTTPMethod, Value: req.Method}, Attribute{Key: AttrEndpoint, Value: req.URL.Path})
 	res, err = c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(Attribute{Key: AttrHTTPStatusCode, Value: res.StatusCode})
+	c.debug("login response", "status", res.StatusCode, "headers", res.Header)
+
+	err = checkLoginResponse(res)
 	res.Body.Close()
+	if err != nil {
+		return err
+	}
 
-	res, err = c.httpClient.Get(dashboardHost + `/system/login?returnUrl=/`)
+	dctx, dspan := c.startSpan(ctx, "iarapi.dashboardLogin")
+	res, err = c.loginGet(dctx, dspan, c.dashboardUrl()+`/system/login?returnUrl=/`)
 	if err != nil {
+		endSpan(dspan, err)
 		return err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("dashboard login: HTTP Status %d", res.StatusCode)
+	}
+	endSpan(dspan, err)
+	return err
+}
+
+// loginGet sends a GET request during the login, recording it on the span and in the debug log
+func (c *Client) loginGet(ctx context.Context, span Span, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(Attribute{Key: AttrHTTPMethod, Value: req.Method}, Attribute{Key: AttrEndpoint, Value: req.URL.Path})
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		c.debug("login request failed", "url", u, "error", err)
+		return nil, err
+	}
+
+	span.SetAttributes(Attribute{Key: AttrHTTPStatusCode, Value: res.StatusCode})
+	c.debug("login request", "url", u, "status", res.StatusCode, "headers", res.Header)
+	return res, nil
+}
+
+// A successful login redirects away from the login page, a failed login returns the login form again along with
+// the validation errors
+func checkLoginResponse(res *http.Response) error {
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: HTTP Status %d", ErrLoginFailed, res.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if doc.Find("form.iar-form__form").Length() > 0 {
+		msg := strings.TrimSpace(doc.Find(".validation-summary-errors").First().Text())
+		if len(msg) > 0 {
+			return fmt.Errorf("%w: %s", ErrLoginFailed, strings.Join(strings.Fields(msg), " "))
+		}
+		return ErrLoginFailed
+	}
 	return nil
 }
 
@@ -145,14 +237,239 @@ func (c *Client) ResponderList() (*ResponderList, error) {
 	return rl, c.apiGet("/ResponderList", rl)
 }
 
+// Respond sets the logged in member's response on the responder board to the response code, returning the member's
+// board entry
+func (c *Client) Respond(codeId int) (*Responder, error) {
+	r := new(Responder)
+	body := map[string]interface{}{"responseCodeId": codeId}
+	if err := c.apiPost(c.apiUrl()+"/Respond", body, r); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/ResponderList")
+	return r, nil
+}
+
 func (c *Client) ApparatusList() (*ApparatusList, error) {
 	al := new(ApparatusList)
 	return al, c.apiGet("/ApparatusList", al)
 }
 
+// UpdateApparatusStatus sets the status of an apparatus, returning the updated apparatus
+func (c *Client) UpdateApparatusStatus(id int, status ApparatusStatus) (*Apparatus, error) {
+	a := new(Apparatus)
+	body := map[string]interface{}{"status": status}
+	if err := c.apiPost(fmt.Sprintf("%s/Apparatus/%d/Status", c.apiUrl(), id), body, a); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/ApparatusList")
+	return a, nil
+}
+
 func (c *Client) SearchIncidents(isr *IncidentSearchRequest) (*IncidentList, error) {
 	il := new(IncidentList)
-	return il, c.apiPost(apiBase+"/SearchIncidents", isr, il)
+	return il, c.apiPost(c.apiUrl()+"/SearchIncidents", isr, il)
+}
+
+// VerifyIncidentAddress submits a corrected address for an incident, returning the updated incident.  The member
+// must have the PermittedToVerifyIncidentAddresses permission.
+func (c *Client) VerifyIncidentAddress(v *AddressVerification) (*Incident, error) {
+	if v == nil || v.IncidentId < 1 {
+		return nil, fmt.Errorf("invalid incident id")
+	}
+
+	inc := new(Incident)
+	return inc, c.apiPost(fmt.Sprintf("%s/Incident/%d/VerifyAddress", c.apiUrl(), v.IncidentId), v, inc)
+}
+
+func (c *Client) Hydrants() (*HydrantList, error) {
+	hl := new(HydrantList)
+	return hl, c.apiGet("/Hydrants", hl)
+}
+
+func (c *Client) CreateHydrant(h *Hydrant) (*Hydrant, error) {
+	out := new(Hydrant)
+	if err := c.apiPost(c.apiUrl()+"/Hydrants", h, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Hydrants")
+	return out, nil
+}
+
+func (c *Client) UpdateHydrant(h *Hydrant) (*Hydrant, error) {
+	if h == nil || h.Id < 1 {
+		return nil, fmt.Errorf("invalid hydrant id")
+	}
+
+	out := new(Hydrant)
+	if err := c.apiPut(fmt.Sprintf("%s/Hydrants/%d", c.apiUrl(), h.Id), h, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Hydrants")
+	return out, nil
+}
+
+func (c *Client) DeleteHydrant(id int) error {
+	if id < 1 {
+		return fmt.Errorf("invalid hydrant id")
+	}
+
+	if err := c.apiDelete(fmt.Sprintf("%s/Hydrants/%d", c.apiUrl(), id)); err != nil {
+		return err
+	}
+
+	c.InvalidateCache("/Hydrants")
+	return nil
+}
+
+func (c *Client) Markers() (*MarkerList, error) {
+	ml := new(MarkerList)
+	return ml, c.apiGet("/Markers", ml)
+}
+
+func (c *Client) CreateMarker(m *Marker) (*Marker, error) {
+	out := new(Marker)
+	if err := c.apiPost(c.apiUrl()+"/Markers", m, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Markers")
+	return out, nil
+}
+
+func (c *Client) UpdateMarker(m *Marker) (*Marker, error) {
+	if m == nil || m.Id < 1 {
+		return nil, fmt.Errorf("invalid marker id")
+	}
+
+	out := new(Marker)
+	if err := c.apiPut(fmt.Sprintf("%s/Markers/%d", c.apiUrl(), m.Id), m, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Markers")
+	return out, nil
+}
+
+func (c *Client) DeleteMarker(id int) error {
+	if id < 1 {
+		return fmt.Errorf("invalid marker id")
+	}
+
+	if err := c.apiDelete(fmt.Sprintf("%s/Markers/%d", c.apiUrl(), id)); err != nil {
+		return err
+	}
+
+	c.InvalidateCache("/Markers")
+	return nil
+}
+
+func (c *Client) Geofences() (*GeofenceList, error) {
+	gl := new(GeofenceList)
+	return gl, c.apiGet("/Geofences", gl)
+}
+
+func (c *Client) CreateGeofence(g *Geofence) (*Geofence, error) {
+	out := new(Geofence)
+	if err := c.apiPost(c.apiUrl()+"/Geofences", g, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Geofences")
+	return out, nil
+}
+
+func (c *Client) UpdateGeofence(g *Geofence) (*Geofence, error) {
+	if g == nil || g.Id < 1 {
+		return nil, fmt.Errorf("invalid geofence id")
+	}
+
+	out := new(Geofence)
+	if err := c.apiPut(fmt.Sprintf("%s/Geofences/%d", c.apiUrl(), g.Id), g, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Geofences")
+	return out, nil
+}
+
+func (c *Client) DeleteGeofence(id int) error {
+	if id < 1 {
+		return fmt.Errorf("invalid geofence id")
+	}
+
+	if err := c.apiDelete(fmt.Sprintf("%s/Geofences/%d", c.apiUrl(), id)); err != nil {
+		return err
+	}
+
+	c.InvalidateCache("/Geofences")
+	return nil
+}
+
+func (c *Client) Events() (*EventList, error) {
+	el := new(EventList)
+	return el, c.apiGet("/Events", el)
+}
+
+func (c *Client) CreateEvent(e *Event) (*Event, error) {
+	out := new(Event)
+	if err := c.apiPost(c.apiUrl()+"/Events", e, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Events")
+	return out, nil
+}
+
+func (c *Client) UpdateEvent(e *Event) (*Event, error) {
+	if e == nil || e.Id < 1 {
+		return nil, fmt.Errorf("invalid event id")
+	}
+
+	out := new(Event)
+	if err := c.apiPut(fmt.Sprintf("%s/Events/%d", c.apiUrl(), e.Id), e, out); err != nil {
+		return nil, err
+	}
+
+	c.InvalidateCache("/Events")
+	return out, nil
+}
+
+func (c *Client) DeleteEvent(id int) error {
+	if id < 1 {
+		return fmt.Errorf("invalid event id")
+	}
+
+	if err := c.apiDelete(fmt.Sprintf("%s/Events/%d", c.apiUrl(), id)); err != nil {
+		return err
+	}
+
+	c.InvalidateCache("/Events")
+	return nil
+}
+
+func (c *Client) loginUrl() string {
+	if len(c.loginEndpoint) > 0 {
+		return c.loginEndpoint
+	}
+	return loginUrl
+}
+
+func (c *Client) dashboardUrl() string {
+	if len(c.dashboardEndpoint) > 0 {
+		return c.dashboardEndpoint
+	}
+	return dashboardHost
+}
+
+func (c *Client) apiUrl() string {
+	if len(c.apiEndpoint) > 0 {
+		return c.apiEndpoint
+	}
+	return apiBase
 }
 
 func (c *Client) apiGet(path string, t interface{}) error {
@@ -160,7 +477,11 @@ func (c *Client) apiGet(path string, t interface{}) error {
 }
 
 func (c *Client) apiGetWithContext(ctx context.Context, path string, t interface{}) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBase+path, http.NoBody)
+	if c.cache != nil && c.cache.ttl(path) > 0 {
+		return c.cachedGet(ctx, path, t)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl()+path, http.NoBody)
 	if err != nil {
 		return err
 	}
@@ -173,12 +494,29 @@ func (c *Client) apiPost(url string, input, output interface{}) error {
 }
 
 func (c *Client) apiPostWithContext(ctx context.Context, url string, input, output interface{}) error {
+	return c.apiSendWithContext(ctx, http.MethodPost, url, input, output)
+}
+
+func (c *Client) apiPut(url string, input, output interface{}) error {
+	return c.apiSendWithContext(context.Background(), http.MethodPut, url, input, output)
+}
+
+func (c *Client) apiDelete(url string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodDelete, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	return c.doApiRequest(req, nil)
+}
+
+func (c *Client) apiSendWithContext(ctx context.Context, method, url string, input, output interface{}) error {
 	data, err := json.Marshal(input)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
@@ -188,27 +526,187 @@ func (c *Client) apiPostWithContext(ctx context.Context, url string, input, outp
 }
 
 func (c *Client) doApiRequest(req *http.Request, t interface{}) error {
+	res, b, err := c.sendApiRequest(req)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("HTTP Status %d", res.StatusCode)
+	}
+
+	return c.decodeApiResponse(req.URL.Path, b, t)
+}
+
+// sendApiRequest adds the headers required by the API and sends the request, returning the response and its body.
+// If the session has expired, the client logs in again with the same credentials and resends the request once.  The
+// request is recorded on a span, with the number of resends.
+func (c *Client) sendApiRequest(req *http.Request) (*http.Response, []byte, error) {
 	req.Header.Add("Accept", "text/plain,application/json")
 	req.Header.Set("X-CSRF", "1")
+
+	endpoint := c.apiEndpointPath(req.URL.String())
+	ctx, span := c.startSpan(req.Context(), "iarapi.request")
+	span.SetAttributes(Attribute{Key: AttrHTTPMethod, Value: req.Method}, Attribute{Key: AttrEndpoint, Value: endpoint})
+
+	res, b, retries, err := c.sendRenewing(req.WithContext(ctx), endpoint)
+
+	span.SetAttributes(Attribute{Key: AttrRetries, Value: retries})
+	if res != nil {
+		span.SetAttributes(Attribute{Key: AttrHTTPStatusCode, Value: res.StatusCode})
+	}
+	endSpan(span, err)
+	return res, b, err
+}
+
+// sendRenewing sends the request, and if the session has expired logs in again and resends it, returning the
+// number of resends
+func (c *Client) sendRenewing(req *http.Request, endpoint string) (*http.Response, []byte, int, error) {
+	// the cookie jar adds the session cookie to the request when it is sent, so keep a copy without it
+	retry := req.Clone(req.Context())
+	gen := c.loginGeneration()
+
+	res, b, err := c.send(req, endpoint)
+	if err != nil || !c.sessionExpired(res) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return res, b, 0, err
+	}
+
+	// the login spans are children of the request's
+	if err = c.relogin(req.Context(), gen); err != nil {
+		return nil, nil, 0, fmt.Errorf("session expired, logging in again: %w", err)
+	}
+
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	res, b, err = c.send(retry, endpoint)
+	return res, b, 1, err
+}
+
+// send sends the API request, recording it with the observer and in the debug log
+func (c *Client) send(req *http.Request, endpoint string) (*http.Response, []byte, error) {
 	req.AddCookie(&http.Cookie{Name: "CookieConsent", Value: "yes"})
+
+	start := time.Now()
 	res, err := c.httpClient.Do(req)
 
+	var b []byte
+	if err == nil {
+		b, err = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+
+	d := time.Since(start)
+
+	var status int
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	if c.observer != nil {
+		c.observer.ObserveRequest(req.Method, endpoint, status, d)
+	}
+
+	if err != nil {
+		c.debug("api request failed", "method", req.Method, "endpoint", endpoint, "duration", d, "error", err)
+		return nil, nil, err
+	}
+	c.debug("api request", "method", req.Method, "endpoint", endpoint, "status", status, "duration", d,
+		"headers", req.Header)
+	return res, b, nil
+}
+
+// sessionExpired reports whether the response shows the login session has expired: a 401 status, or a redirect to
+// the login page
+func (c *Client) sessionExpired(res *http.Response) bool {
+	if res.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+
+	u, err := url.Parse(c.loginUrl())
+	if err != nil || res.Request == nil {
+		return false
+	}
+	return res.Request.URL.Host == u.Host && res.Request.URL.Path == u.Path
+}
+
+func (c *Client) loginGeneration() int {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.loginGen
+}
+
+// relogin logs in again, unless another request already did since the login generation gen
+func (c *Client) relogin(ctx context.Context, gen int) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	if c.loginGen != gen {
+		return nil
+	}
+
+	if len(c.username) < 1 {
+		return ErrLoginFailed
+	}
+
+	err := c.loginContext(ctx, c.agency, c.username, c.password)
+	if c.observer != nil {
+		c.observer.ObserveRelogin(err)
+	}
+
 	if err != nil {
 		return err
 	}
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(res.Body)
+	c.loginGen++
+	return nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Status %d", res.StatusCode)
+func (c *Client) decodeApiResponse(endpoint string, b []byte, t interface{}) error {
+	// create, update and delete calls may reply with an empty body (204 No Content), or the caller doesn't care
+	if t == nil || len(bytes.TrimSpace(b)) == 0 {
+		return nil
 	}
 
-	var b []byte
-	b, err = io.ReadAll(res.Body)
+	if c.strict {
+		return c.strictDecode(endpoint, b, t)
+	}
+
+	if err := json.Unmarshal(b, t); err != nil {
+		return err
+	}
+
+	if c.driftHandler != nil {
+		for _, d := range FindSchemaDrift(t) {
+			d.Endpoint = endpoint
+			c.driftHandler(d)
+		}
+	}
+	return nil
+}
+
+// strictDecode compares the shape of the response with the type of t before decoding.  DisallowUnknownFields only
+// applies to types without their own UnmarshalJSON, so the response is checked against the type directly as well.
+func (c *Client) strictDecode(endpoint string, data []byte, t interface{}) error {
+	v, err := decodeGeneric(data)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(b, t)
+	diffs := make([]*SchemaDifference, 0)
+	for _, d := range schemaDiff(v, reflect.TypeOf(t)) {
+		if d.Kind != FieldMissing {
+			diffs = append(diffs, d)
+		}
+	}
+
+	if len(diffs) > 0 {
+		return &StrictDecodeError{Endpoint: endpoint, Differences: diffs}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(t)
 }
@@ -2,11 +2,15 @@ package iarapi
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -26,13 +30,17 @@ var (
 		SubscriberId: 654321,
 		FirstName:    "Test",
 		LastName:     "User",
+		DeviceToken:  json.RawMessage(`"a1b2c3"`),
 	}
 
 	incidentListGood = IncidentList{
 		{
-			Id:           12345678,
-			SubscriberId: 654321,
-			ArrivedOn:    "today",
+			Id:            12345678,
+			SubscriberId:  654321,
+			ArrivedOn:     "today",
+			Direction:     json.RawMessage(`"N"`),
+			AddedBy:       json.RawMessage(`"dispatch"`),
+			LastUpdatedBy: json.RawMessage(`123456`),
 		},
 	}
 
@@ -91,12 +99,73 @@ var (
 	}
 
 	apparatusListGood = ApparatusList{
-		{},
+		{
+			Id:           77,
+			SubscriberId: 654321,
+			Name:         "Engine 1",
+			Type:         "Engine",
+			Status:       ApparatusInService,
+			Crew:         []*ApparatusCrewMember{{MemberId: 123456, Name: "Test User", Position: "Driver"}},
+			Location:     Coordinates{Lat: 40.0, Lng: -75.0},
+		},
+	}
+
+	hydrantGood = Hydrant{
+		Id:             2001,
+		SubscriberId:   654321,
+		Name:           "H-1",
+		Location:       Coordinates{Lat: 40.1, Lng: -75.2},
+		FlowRate:       1000,
+		StaticPressure: 65,
+		LastTested:     time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	hydrantListGood = HydrantList{&hydrantGood}
+
+	markerGood = Marker{
+		Id:           3001,
+		SubscriberId: 654321,
+		Name:         "Acme Chemical",
+		Category:     "Target Hazard",
+		Location:     Coordinates{Lat: 40.2, Lng: -75.3},
+		Notes:        "Ammonia storage at rear loading dock",
+		Attachments: []*MarkerAttachment{
+			{Id: 1, FileName: "preplan.pdf", ContentType: "application/pdf", Url: "https://example.com/preplan.pdf"},
+		},
+	}
+
+	markerListGood = MarkerList{&markerGood}
+
+	geofenceGood = Geofence{
+		Id:           4001,
+		SubscriberId: 654321,
+		Name:         "Station 1",
+		Shape:        GeofenceCircle,
+		Center:       Coordinates{Lat: 40.0, Lng: -75.0},
+		Radius:       150,
+		Triggers:     []*GeofenceTrigger{{On: GeofenceEnter, ResponseCodeId: 1}},
+		IsActive:     true,
 	}
+
+	geofenceListGood = GeofenceList{&geofenceGood}
+
+	eventGood = Event{
+		Id:           5001,
+		SubscriberId: 654321,
+		Title:        "Pump Training",
+		Location:     "Station 1",
+		Category:     "Drill",
+		Start:        time.Date(2022, 11, 7, 23, 30, 0, 0, time.UTC),
+		End:          time.Date(2022, 11, 8, 2, 0, 0, 0, time.UTC),
+		UpdatedOn:    time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	eventListGood = EventList{&eventGood}
 )
 
 func TestMain(m *testing.M) {
 	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/system/login", dashboardLoginHandler)
 	http.HandleFunc("/Subscriber", subscriberHandler)
 	http.HandleFunc("/Member", memberHandler)
 	http.HandleFunc("/IncidentList", incidentListHandler)
@@ -106,7 +175,18 @@ func TestMain(m *testing.M) {
 	http.HandleFunc("/OnDutyAtCodes", onDutyAtCodesHandler)
 	http.HandleFunc("/ResponderList", responderListHandler)
 	http.HandleFunc("/ApparatusList", apparatusListHandler)
+	http.HandleFunc("/Apparatus/", apparatusStatusHandler)
 	http.HandleFunc("/SearchIncidents", searchIncidentsHandler)
+	http.HandleFunc("/Respond", respondHandler)
+	http.HandleFunc("/Incident/", verifyAddressHandler)
+	http.HandleFunc("/Hydrants", crudHandler(&hydrantListGood, func() interface{} { return new(Hydrant) }))
+	http.HandleFunc("/Hydrants/", crudHandler(&hydrantListGood, func() interface{} { return new(Hydrant) }))
+	http.HandleFunc("/Markers", crudHandler(&markerListGood, func() interface{} { return new(Marker) }))
+	http.HandleFunc("/Markers/", crudHandler(&markerListGood, func() interface{} { return new(Marker) }))
+	http.HandleFunc("/Geofences", crudHandler(&geofenceListGood, func() interface{} { return new(Geofence) }))
+	http.HandleFunc("/Geofences/", crudHandler(&geofenceListGood, func() interface{} { return new(Geofence) }))
+	http.HandleFunc("/Events", crudHandler(&eventListGood, func() interface{} { return new(Event) }))
+	http.HandleFunc("/Events/", crudHandler(&eventListGood, func() interface{} { return new(Event) }))
 
 	ts := httptest.NewTLSServer(nil)
 	defer ts.Close()
@@ -447,6 +527,53 @@ func TestClient_ResponderList(t *testing.T) {
 	}
 }
 
+func TestClient_Respond(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	responding := *responderListGood[0]
+	responding.RespondingTo = responseCodesGood.ResponseCodes[0].KeyEntry
+	responding.ResponseCodeId = 1
+
+	tests := []struct {
+		name    string
+		fields  fields
+		codeId  int
+		want    *Responder
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			codeId: 1,
+			want:   &responding,
+		},
+		{
+			name:    "unknown code",
+			fields:  fields{httpClient: testClient},
+			codeId:  99,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.Respond(tt.codeId)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Respond() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Respond() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestClient_ApparatusList(t *testing.T) {
 	type fields struct {
 		httpClient http.Client
@@ -482,6 +609,57 @@ func TestClient_ApparatusList(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateApparatusStatus(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	type args struct {
+		id     int
+		status ApparatusStatus
+	}
+
+	onScene := *apparatusListGood[0]
+	onScene.Status = ApparatusOnScene
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *Apparatus
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			args:   args{id: 77, status: ApparatusOnScene},
+			want:   &onScene,
+		},
+		{
+			name:    "unknown apparatus",
+			fields:  fields{httpClient: testClient},
+			args:    args{id: 404, status: ApparatusEnRoute},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.UpdateApparatusStatus(tt.args.id, tt.args.status)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.UpdateApparatusStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.UpdateApparatusStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestClient_SearchIncidents(t *testing.T) {
 	type fields struct {
 		httpClient http.Client
@@ -527,26 +705,439 @@ func TestClient_SearchIncidents(t *testing.T) {
 	}
 }
 
+func TestClient_Hydrants(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *HydrantList
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			want:   &hydrantListGood,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.Hydrants()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Hydrants() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Hydrants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Markers(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *MarkerList
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			want:   &markerListGood,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.Markers()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Markers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Markers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Geofences(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *GeofenceList
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			want:   &geofenceListGood,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.Geofences()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Geofences() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Geofences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *EventList
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			want:   &eventListGood,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.Events()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Events() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Events() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestClient_crud covers the Create*, Update* and Delete* methods of the hydrant, marker, geofence and event lists
+func TestClient_crud(t *testing.T) {
+	deleted := func(err error) (interface{}, error) { return nil, err }
+
+	tests := []struct {
+		name       string
+		call       func(c *Client) (interface{}, error)
+		wantMethod string
+		wantPath   string
+		want       interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "CreateHydrant",
+			call:       func(c *Client) (interface{}, error) { return c.CreateHydrant(&hydrantGood) },
+			wantMethod: http.MethodPost,
+			wantPath:   "/Hydrants",
+			want:       &hydrantGood,
+		},
+		{
+			name:       "UpdateHydrant",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateHydrant(&hydrantGood) },
+			wantMethod: http.MethodPut,
+			wantPath:   fmt.Sprintf("/Hydrants/%d", hydrantGood.Id),
+			want:       &hydrantGood,
+		},
+		{
+			name:       "UpdateHydrant not found",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateHydrant(&Hydrant{Id: 404}) },
+			wantMethod: http.MethodPut,
+			wantPath:   "/Hydrants/404",
+			wantErr:    true,
+		},
+		{
+			name:    "UpdateHydrant no id",
+			call:    func(c *Client) (interface{}, error) { return c.UpdateHydrant(&Hydrant{Name: "new"}) },
+			wantErr: true,
+		},
+		{
+			name:       "DeleteHydrant",
+			call:       func(c *Client) (interface{}, error) { return deleted(c.DeleteHydrant(hydrantGood.Id)) },
+			wantMethod: http.MethodDelete,
+			wantPath:   fmt.Sprintf("/Hydrants/%d", hydrantGood.Id),
+		},
+		{
+			name:       "DeleteHydrant not found",
+			call:       func(c *Client) (interface{}, error) { return deleted(c.DeleteHydrant(404)) },
+			wantMethod: http.MethodDelete,
+			wantPath:   "/Hydrants/404",
+			wantErr:    true,
+		},
+		{
+			name:    "DeleteHydrant no id",
+			call:    func(c *Client) (interface{}, error) { return deleted(c.DeleteHydrant(0)) },
+			wantErr: true,
+		},
+		{
+			name:       "CreateMarker",
+			call:       func(c *Client) (interface{}, error) { return c.CreateMarker(&markerGood) },
+			wantMethod: http.MethodPost,
+			wantPath:   "/Markers",
+			want:       &markerGood,
+		},
+		{
+			name:       "UpdateMarker",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateMarker(&markerGood) },
+			wantMethod: http.MethodPut,
+			wantPath:   fmt.Sprintf("/Markers/%d", markerGood.Id),
+			want:       &markerGood,
+		},
+		{
+			name:       "UpdateMarker not found",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateMarker(&Marker{Id: 404}) },
+			wantMethod: http.MethodPut,
+			wantPath:   "/Markers/404",
+			wantErr:    true,
+		},
+		{
+			name:    "UpdateMarker no id",
+			call:    func(c *Client) (interface{}, error) { return c.UpdateMarker(&Marker{Name: "new"}) },
+			wantErr: true,
+		},
+		{
+			name:       "DeleteMarker",
+			call:       func(c *Client) (interface{}, error) { return deleted(c.DeleteMarker(markerGood.Id)) },
+			wantMethod: http.MethodDelete,
+			wantPath:   fmt.Sprintf("/Markers/%d", markerGood.Id),
+		},
+		{
+			name:    "DeleteMarker no id",
+			call:    func(c *Client) (interface{}, error) { return deleted(c.DeleteMarker(0)) },
+			wantErr: true,
+		},
+		{
+			name:       "CreateGeofence",
+			call:       func(c *Client) (interface{}, error) { return c.CreateGeofence(&geofenceGood) },
+			wantMethod: http.MethodPost,
+			wantPath:   "/Geofences",
+			want:       &geofenceGood,
+		},
+		{
+			name:       "UpdateGeofence",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateGeofence(&geofenceGood) },
+			wantMethod: http.MethodPut,
+			wantPath:   fmt.Sprintf("/Geofences/%d", geofenceGood.Id),
+			want:       &geofenceGood,
+		},
+		{
+			name:    "UpdateGeofence no id",
+			call:    func(c *Client) (interface{}, error) { return c.UpdateGeofence(nil) },
+			wantErr: true,
+		},
+		{
+			name:       "DeleteGeofence",
+			call:       func(c *Client) (interface{}, error) { return deleted(c.DeleteGeofence(geofenceGood.Id)) },
+			wantMethod: http.MethodDelete,
+			wantPath:   fmt.Sprintf("/Geofences/%d", geofenceGood.Id),
+		},
+		{
+			name:       "CreateEvent",
+			call:       func(c *Client) (interface{}, error) { return c.CreateEvent(&eventGood) },
+			wantMethod: http.MethodPost,
+			wantPath:   "/Events",
+			want:       &eventGood,
+		},
+		{
+			name:       "UpdateEvent",
+			call:       func(c *Client) (interface{}, error) { return c.UpdateEvent(&eventGood) },
+			wantMethod: http.MethodPut,
+			wantPath:   fmt.Sprintf("/Events/%d", eventGood.Id),
+			want:       &eventGood,
+		},
+		{
+			name:    "UpdateEvent no id",
+			call:    func(c *Client) (interface{}, error) { return c.UpdateEvent(&Event{Title: "new"}) },
+			wantErr: true,
+		},
+		{
+			name:       "DeleteEvent",
+			call:       func(c *Client) (interface{}, error) { return deleted(c.DeleteEvent(eventGood.Id)) },
+			wantMethod: http.MethodDelete,
+			wantPath:   fmt.Sprintf("/Events/%d", eventGood.Id),
+		},
+		{
+			name:    "DeleteEvent no id",
+			call:    func(c *Client) (interface{}, error) { return deleted(c.DeleteEvent(-1)) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: testClient,
+			}
+
+			crudRequests.reset()
+			got, err := tt.call(c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			var want []string
+			if len(tt.wantMethod) > 0 {
+				want = []string{tt.wantMethod + " " + tt.wantPath}
+			}
+			if got := crudRequests.get(); !reflect.DeepEqual(got, want) {
+				t.Errorf("requests = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_VerifyIncidentAddress(t *testing.T) {
+	type fields struct {
+		httpClient http.Client
+	}
+
+	type args struct {
+		v *AddressVerification
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *Incident
+		wantErr bool
+	}{
+		{
+			name:   "good",
+			fields: fields{httpClient: testClient},
+			args: args{v: &AddressVerification{
+				IncidentId:   12345678,
+				StreetNumber: "100",
+				StreetName:   "Main St",
+				City:         "Anytown",
+				State:        "PA",
+				Location:     &Coordinates{Lat: 40.1, Lng: -75.1},
+			}},
+			want: &Incident{
+				Id:                    12345678,
+				SubscriberId:          654321,
+				ArrivedOn:             "today",
+				Direction:             json.RawMessage(`"N"`),
+				AddedBy:               json.RawMessage(`"dispatch"`),
+				LastUpdatedBy:         json.RawMessage(`123456`),
+				VerifiedAddressStatus: AddressManuallyVerified,
+				VerifiedStreetNumber:  "100",
+				VerifiedStreetName:    "Main St",
+				VerifiedCity:          "Anytown",
+				VerifiedState:         "PA",
+				IsVerifiedAndActive:   true,
+			},
+		},
+		{
+			name:    "missing incident",
+			fields:  fields{httpClient: testClient},
+			args:    args{v: &AddressVerification{StreetName: "Main St"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown incident",
+			fields:  fields{httpClient: testClient},
+			args:    args{v: &AddressVerification{IncidentId: 404}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				httpClient: tt.fields.httpClient,
+			}
+			got, err := c.VerifyIncidentAddress(tt.args.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.VerifyIncidentAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.VerifyIncidentAddress() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const (
+	testRequestToken = "test-request-token"
+
+	loginPage = `<html><body>
+<form class="iar-form__form" method="post">
+  <input name="__RequestVerificationToken" type="hidden" value="%s">
+  <div class="validation-summary-errors">%s</div>
+</form>
+</body></html>`
+)
+
+// loginHandler serves the login page with a request verification token, and answers a POST of the login form by
+// either redirecting for good credentials, or showing the login page again with an error
 func loginHandler(w http.ResponseWriter, r *http.Request) {
-	req := new(LoginRequest)
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "text/html")
+
+	if r.Method == http.MethodGet {
+		fmt.Fprintf(w, loginPage, testRequestToken, "")
 		return
 	}
 
-	if err = json.Unmarshal(body, req); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	reply := new(LoginReply)
+	if r.PostForm.Get("__RequestVerificationToken") != testRequestToken {
+		http.Error(w, "bad request token", http.StatusBadRequest)
+		return
+	}
 
-	if req.Agency == "good" && req.User == "good" && req.Password == "good" {
-		reply.Message = "Login to iamresponding.com/ successful"
+	f := r.PostForm
+	if f.Get("Input.Agency") == "good" && f.Get("Input.Username") == "good" && f.Get("Input.Password") == "good" {
+		http.Redirect(w, r, "/system/login?returnUrl=/", http.StatusFound)
+		return
 	}
 
-	sendResponse(w, r, reply)
+	fmt.Fprintf(w, loginPage, testRequestToken, "<ul><li>Invalid agency, username or password</li></ul>")
+}
+
+func dashboardLoginHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
 }
 
 func subscriberHandler(w http.ResponseWriter, r *http.Request) {
@@ -585,10 +1176,156 @@ func apparatusListHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, r, &apparatusListGood)
 }
 
+func verifyAddressHandler(w http.ResponseWriter, r *http.Request) {
+	v := new(AddressVerification)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost || r.URL.Path != fmt.Sprintf("/Incident/%d/VerifyAddress", incidentListGood[0].Id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	inc := *incidentListGood[0]
+	inc.VerifiedAddressStatus = AddressManuallyVerified
+	inc.VerifiedStreetNumber = v.StreetNumber
+	inc.VerifiedStreetName = v.StreetName
+	inc.VerifiedCity = v.City
+	inc.VerifiedState = v.State
+	inc.VerifiedCountry = v.Country
+	inc.IsVerifiedAndActive = true
+
+	sendResponse(w, r, &inc)
+}
+
+func apparatusStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status ApparatusStatus `json:"status"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a := *apparatusListGood[0]
+	if r.Method != http.MethodPost || r.URL.Path != fmt.Sprintf("/Apparatus/%d/Status", a.Id) {
+		http.NotFound(w, r)
+		return
+	}
+	a.Status = body.Status
+
+	sendResponse(w, r, &a)
+}
+
+func respondHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ResponseCodeId int `json:"responseCodeId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	for _, c := range responseCodesGood.ResponseCodes {
+		if c.Id == body.ResponseCodeId {
+			resp := *responderListGood[0]
+			resp.RespondingTo = c.KeyEntry
+			resp.ResponseCodeId = c.Id
+			sendResponse(w, r, &resp)
+			return
+		}
+	}
+
+	http.Error(w, "unknown response code", http.StatusBadRequest)
+}
+
 func searchIncidentsHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, r, &incidentListGood)
 }
 
+// crudRequests records the method and path of each request to a crudHandler
+var crudRequests requestLog
+
+type requestLog struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (l *requestLog) add(r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, r.Method+" "+r.URL.Path)
+}
+
+func (l *requestLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests
+}
+
+func (l *requestLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = nil
+}
+
+// crudHandler serves the list on GET and creates an item on POST to the list path, and updates an item on PUT or
+// deletes it on DELETE to its item path.  An update must have the item id from the path.  Any request for item id 404
+// is answered with a 404 status.
+func crudHandler(list interface{}, item func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		crudRequests.add(r)
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			sendResponse(w, r, list)
+		case len(parts) == 1 && r.Method == http.MethodPost:
+			echoItem(w, r, item(), "0")
+		case len(parts) == 2 && parts[1] == "404":
+			http.NotFound(w, r)
+		case len(parts) == 2 && r.Method == http.MethodPut:
+			echoItem(w, r, item(), parts[1])
+		case len(parts) == 2 && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// echoItem sends the item in the request body back, if its id is id.  A new item may have any id.
+func echoItem(w http.ResponseWriter, r *http.Request, v interface{}, id string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ref struct {
+		Id int `json:"id"`
+	}
+	if err = json.Unmarshal(body, &ref); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if id != "0" && strconv.Itoa(ref.Id) != id {
+		http.Error(w, "item id does not match the path", http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sendResponse(w, r, v)
+}
+
 func sendResponse(w http.ResponseWriter, r *http.Request, t interface{}) {
 	defer r.Body.Close()
 
@@ -601,3 +1338,34 @@ func sendResponse(w http.ResponseWriter, r *http.Request, t interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(data)
 }
+
+func TestClient_sessionExpired(t *testing.T) {
+	c := new(Client)
+	WithEndpoints("https://auth.example.com/login/member", "", "https://api.example.com/api")(c)
+
+	req := func(u string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, u, http.NoBody)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		res  *http.Response
+		want bool
+	}{
+		{name: "ok", res: &http.Response{StatusCode: 200, Request: req("https://api.example.com/api/ResponderList")}},
+		{name: "unauthorized", res: &http.Response{StatusCode: 401, Request: req("https://api.example.com/api/Member")},
+			want: true},
+		{name: "login redirect", res: &http.Response{StatusCode: 200,
+			Request: req("https://auth.example.com/login/member?ReturnUrl=%2F")}, want: true},
+		{name: "forbidden", res: &http.Response{StatusCode: 403, Request: req("https://api.example.com/api/Member")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.sessionExpired(tt.res); got != tt.want {
+				t.Errorf("sessionExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
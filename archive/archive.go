@@ -0,0 +1,601 @@
+// Package archive keeps a local copy of IamResponding incidents, along with snapshots of the responder board taken
+// while incidents are active, so the history remains available for reporting and during service outages.
+//
+// The archive is a directory of append-only JSON Lines files, loaded into memory when opened.  Later records for an
+// incident replace earlier ones, and Compact rewrites the incident log keeping only the latest record of each.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	incidentFile = "incidents.jsonl"
+	snapshotFile = "snapshots.jsonl"
+	stateFile    = "state.json"
+
+	// DefaultLookback is how far back the first sync of an empty archive searches
+	DefaultLookback = 30 * 24 * time.Hour
+
+	// DefaultActiveWindow is how long after arriving an incident is considered active for responder snapshots
+	DefaultActiveWindow = 2 * time.Hour
+
+	searchPageSize = 100
+
+	// maxSearchPages bounds a sync's search, at searchPageSize incidents per page
+	maxSearchPages = 100
+)
+
+// ErrSearchTruncated is returned by Sync when the incident search has more than maxSearchPages pages.  Nothing is
+// stored and the sync state is left as it was, since the missing incidents would otherwise be skipped for good.
+var ErrSearchTruncated = errors.New("incident search truncated")
+
+// Source is the subset of the iarapi.Client methods used to sync the archive
+type Source interface {
+	SearchIncidents(*iarapi.IncidentSearchRequest) (*iarapi.IncidentList, error)
+	ResponderList() (*iarapi.ResponderList, error)
+}
+
+// Snapshot is the responder board captured at a point in time, and the incidents which were active at that time
+type Snapshot struct {
+	Time        time.Time            `json:"time"`
+	IncidentIds []int                `json:"incidentIds"`
+	Responders  iarapi.ResponderList `json:"responders"`
+}
+
+// State records the progress of incremental syncs
+type State struct {
+	LastUpdated time.Time `json:"lastUpdated"`
+	LastSync    time.Time `json:"lastSync"`
+}
+
+// SyncResult summarizes the changes made by a sync
+type SyncResult struct {
+	Added    int
+	Updated  int
+	Snapshot bool
+}
+
+type Archive struct {
+	// Lookback is how far back the first sync searches, DefaultLookback if 0
+	Lookback time.Duration
+
+	// ActiveWindow is how long after arriving an incident has responder snapshots taken, DefaultActiveWindow if 0
+	ActiveWindow time.Duration
+
+	// Location is the agency's time zone, used for incident times without a zone offset, time.Local if nil
+	Location *time.Location
+
+	dir       string
+	mu        sync.RWMutex
+	incidents map[int]*iarapi.Incident
+	snapshots []*Snapshot
+	state     State
+	incFile   *os.File
+	snapFile  *os.File
+	now       func() time.Time
+}
+
+// Open loads the archive in dir, creating the directory and files if needed.  The caller must Close the archive.
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	a := &Archive{dir: dir, incidents: make(map[int]*iarapi.Incident), now: time.Now}
+
+	if err := a.loadState(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if a.incFile, err = openLog(filepath.Join(dir, incidentFile), a.loadIncident); err != nil {
+		return nil, err
+	}
+
+	if a.snapFile, err = openLog(filepath.Join(dir, snapshotFile), a.loadSnapshot); err != nil {
+		_ = a.incFile.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.incFile.Close()
+	if e := a.snapFile.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// State returns the sync state
+func (a *Archive) State() State {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.state
+}
+
+// Sync fetches incidents updated since the last sync, starting one day before the last seen update to catch
+// changes made close to the previous sync, and stores any which are new or changed.  If any incident is still
+// active, a snapshot of the responder board is stored as well.
+func (a *Archive) Sync(src Source) (*SyncResult, error) {
+	now := a.now()
+	st := a.State()
+
+	start := now.Add(-a.lookback())
+	if !st.LastUpdated.IsZero() {
+		start = st.LastUpdated.AddDate(0, 0, -1)
+	}
+
+	fetched, err := searchAll(src, start, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.store(fetched)
+	if err != nil {
+		return res, err
+	}
+
+	if res.Snapshot, err = a.snapshot(src, now); err != nil {
+		return res, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.state.LastSync = now
+	return res, a.saveState()
+}
+
+// searchAll fetches every page of incidents between start and end.  Paging stops at a short page, or a page repeating
+// the previous one, which a server ignoring the page number returns.  ErrSearchTruncated is returned if there are
+// more than maxSearchPages pages.
+func searchAll(src Source, start, end time.Time) (iarapi.IncidentList, error) {
+	fetched := make(iarapi.IncidentList, 0)
+
+	var prev iarapi.IncidentList
+	for page := 1; page <= maxSearchPages; page++ {
+		isr := &iarapi.IncidentSearchRequest{StartTime: start, EndTime: end, Page: page, PageSize: searchPageSize}
+
+		il, err := src.SearchIncidents(isr)
+		if err != nil {
+			return nil, fmt.Errorf("searching incidents: %v", err)
+		}
+
+		if samePage(*il, prev) {
+			return fetched, nil
+		}
+
+		fetched = append(fetched, *il...)
+		if len(*il) < searchPageSize {
+			return fetched, nil
+		}
+		prev = *il
+	}
+	return nil, ErrSearchTruncated
+}
+
+func samePage(a, b iarapi.IncidentList) bool {
+	if len(a) < 1 || len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Id != b[i].Id {
+			return false
+		}
+	}
+	return true
+}
+
+// store adds the incidents which are new or changed to the archive
+func (a *Archive) store(il iarapi.IncidentList) (*SyncResult, error) {
+	res := new(SyncResult)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, inc := range il {
+		cur, ok := a.incidents[inc.Id]
+		if ok && cur.UpdatedOn == inc.UpdatedOn {
+			continue
+		}
+
+		if err := a.appendIncident(inc); err != nil {
+			return res, err
+		}
+
+		if ok {
+			res.Updated++
+		} else {
+			res.Added++
+		}
+	}
+	return res, nil
+}
+
+// Snapshot stores a snapshot of the responder board if any archived incident is active, without searching for new
+// incidents.  It reports whether a snapshot was stored.
+func (a *Archive) Snapshot(src Source) (bool, error) {
+	return a.snapshot(src, a.now())
+}
+
+// snapshot stores a snapshot of the responder board if any incident is active at now, and there are responders.  The
+// board is fetched without holding the lock.
+func (a *Archive) snapshot(src Source, now time.Time) (bool, error) {
+	a.mu.RLock()
+	active := a.activeIncidents(now)
+	a.mu.RUnlock()
+
+	if len(active) < 1 {
+		return false, nil
+	}
+
+	rl, err := src.ResponderList()
+	if err != nil {
+		return false, fmt.Errorf("fetching responders: %v", err)
+	}
+
+	if len(*rl) < 1 {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snap := &Snapshot{Time: now, IncidentIds: active, Responders: *rl}
+	if err = appendLog(a.snapFile, snap); err != nil {
+		return false, err
+	}
+	a.snapshots = append(a.snapshots, snap)
+	return true, nil
+}
+
+// Active returns the ids of the archived incidents which are currently active
+func (a *Archive) Active() []int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.activeIncidents(a.now())
+}
+
+// Get returns the archived incident with the id
+func (a *Archive) Get(id int) (*iarapi.Incident, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	inc, ok := a.incidents[id]
+	return inc, ok
+}
+
+// Incidents returns all archived incidents, ordered by arrival time
+func (a *Archive) Incidents() iarapi.IncidentList {
+	return a.filter(func(*iarapi.Incident) bool { return true })
+}
+
+// ByDate returns the incidents which arrived at or after start, and before end, ordered by arrival time
+func (a *Archive) ByDate(start, end time.Time) iarapi.IncidentList {
+	return a.filter(func(inc *iarapi.Incident) bool {
+		t, err := a.arrivedTime(inc)
+		return err == nil && !t.Before(start) && t.Before(end)
+	})
+}
+
+// ByAddress returns the incidents with address, verified address, or location containing addr, ignoring case
+func (a *Archive) ByAddress(addr string) iarapi.IncidentList {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	return a.filter(func(inc *iarapi.Incident) bool {
+		verified := strings.Join([]string{inc.VerifiedStreetNumber, inc.VerifiedStreetName, inc.VerifiedCity}, " ")
+		for _, s := range []string{inc.Address, verified, inc.Location} {
+			if strings.Contains(strings.ToLower(s), addr) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Search returns the incidents where every word of text is found in the message body, address or location,
+// ignoring case
+func (a *Archive) Search(text string) iarapi.IncidentList {
+	words := strings.Fields(strings.ToLower(text))
+	return a.filter(func(inc *iarapi.Incident) bool {
+		s := strings.ToLower(strings.Join([]string{inc.MessageBody, inc.Address, inc.Location}, "\n"))
+		for _, w := range words {
+			if !strings.Contains(s, w) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Snapshots returns the responder snapshots taken while the incident was active, oldest first
+func (a *Archive) Snapshots(incidentId int) []*Snapshot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	snaps := make([]*Snapshot, 0)
+	for _, s := range a.snapshots {
+		for _, id := range s.IncidentIds {
+			if id == incidentId {
+				snaps = append(snaps, s)
+				break
+			}
+		}
+	}
+	return snaps
+}
+
+// SnapshotsBetween returns the responder snapshots taken at or after start, and before end, oldest first
+func (a *Archive) SnapshotsBetween(start, end time.Time) []*Snapshot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	snaps := make([]*Snapshot, 0)
+	for _, s := range a.snapshots {
+		if !s.Time.Before(start) && s.Time.Before(end) {
+			snaps = append(snaps, s)
+		}
+	}
+	return snaps
+}
+
+// Compact rewrites the incident log keeping only the latest record of each incident
+func (a *Archive) Compact() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	path := filepath.Join(a.dir, incidentFile)
+	tmp, err := os.CreateTemp(a.dir, incidentFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ids := make([]int, 0, len(a.incidents))
+	for id := range a.incidents {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		inc := a.incidents[id]
+		if err = appendLog(tmp, inc); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = a.incFile.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	a.incFile, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+func (a *Archive) lookback() time.Duration {
+	if a.Lookback > 0 {
+		return a.Lookback
+	}
+	return DefaultLookback
+}
+
+func (a *Archive) activeWindow() time.Duration {
+	if a.ActiveWindow > 0 {
+		return a.ActiveWindow
+	}
+	return DefaultActiveWindow
+}
+
+// Zone returns the location incident times without a zone offset are read in: Location, or time.Local if nil
+func (a *Archive) Zone() *time.Location {
+	if a.Location != nil {
+		return a.Location
+	}
+	return time.Local
+}
+
+// arrivedTime parses the incident arrival time in the archive's zone
+func (a *Archive) arrivedTime(inc *iarapi.Incident) (time.Time, error) {
+	return inc.ArrivedTimeIn(a.Zone())
+}
+
+// activeIncidents returns the ids of the incidents which arrived within the active window before now
+func (a *Archive) activeIncidents(now time.Time) []int {
+	ids := make([]int, 0)
+	for id, inc := range a.incidents {
+		t, err := a.arrivedTime(inc)
+		if err == nil && !t.After(now) && now.Sub(t) < a.activeWindow() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (a *Archive) filter(match func(*iarapi.Incident) bool) iarapi.IncidentList {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	il := make(iarapi.IncidentList, 0)
+	for _, inc := range a.incidents {
+		if match(inc) {
+			il = append(il, inc)
+		}
+	}
+
+	sort.Slice(il, func(i, j int) bool {
+		ti, _ := a.arrivedTime(il[i])
+		tj, _ := a.arrivedTime(il[j])
+		if ti.Equal(tj) {
+			return il[i].Id < il[j].Id
+		}
+		return ti.Before(tj)
+	})
+	return il
+}
+
+// appendIncident writes the incident to the log and updates the in-memory index and sync state.  The caller must
+// hold the write lock.
+func (a *Archive) appendIncident(inc *iarapi.Incident) error {
+	if err := appendLog(a.incFile, inc); err != nil {
+		return err
+	}
+	a.trackIncident(inc)
+	return nil
+}
+
+func (a *Archive) trackIncident(inc *iarapi.Incident) {
+	a.incidents[inc.Id] = inc
+
+	if t, err := inc.UpdatedTime(); err == nil && t.After(a.state.LastUpdated) {
+		a.state.LastUpdated = t
+	}
+}
+
+// legacyIncidentPrefix starts the records of archives written before incidents encoded their extra fields, which
+// wrapped the incident and kept the extra fields beside it
+var legacyIncidentPrefix = []byte(`{"incident":`)
+
+func (a *Archive) loadIncident(data []byte) error {
+	inc := new(iarapi.Incident)
+
+	if bytes.HasPrefix(data, legacyIncidentPrefix) {
+		var rec struct {
+			Incident json.RawMessage            `json:"incident"`
+			Extra    map[string]json.RawMessage `json:"extra"`
+		}
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(rec.Incident, inc); err != nil {
+			return err
+		}
+		inc.Extra = rec.Extra
+	} else if err := json.Unmarshal(data, inc); err != nil {
+		return err
+	}
+
+	if inc.Id == 0 {
+		return fmt.Errorf("record has no incident id")
+	}
+
+	a.trackIncident(inc)
+	return nil
+}
+
+func (a *Archive) loadSnapshot(data []byte) error {
+	s := new(Snapshot)
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+
+	a.snapshots = append(a.snapshots, s)
+	return nil
+}
+
+func (a *Archive) loadState() error {
+	data, err := os.ReadFile(filepath.Join(a.dir, stateFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &a.state)
+}
+
+// saveState writes the state file, replacing it atomically.  The caller must hold the write lock.
+func (a *Archive) saveState() error {
+	data, err := json.Marshal(&a.state)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(a.dir, stateFile)
+	if err = os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// openLog reads each line of the log file at path with load, then returns the file opened for appending.  A
+// truncated final line, left by a crash mid-write, is ignored.
+func openLog(path string, load func([]byte) error) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	var offset int64
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				err = f.Truncate(offset)
+			}
+			if err == io.EOF {
+				err = nil
+			}
+
+			if err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+			break
+		} else if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		if err = load(line); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s line %d: %v", filepath.Base(path), n, err)
+		}
+		offset += int64(len(line))
+	}
+
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func appendLog(f *os.File, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
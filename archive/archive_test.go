@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/iartest"
+)
+
+const apiTimeFmt = "2006-01-02T15:04:05"
+
+func TestArchive_Sync(t *testing.T) {
+	now := time.Date(2022, 11, 4, 12, 0, 0, 0, time.UTC)
+
+	s := iartest.NewServer()
+	defer s.Close()
+
+	s.Update(func(f *iartest.Fixtures) {
+		f.Incidents = iarapi.IncidentList{
+			{Id: 1, ArrivedOn: now.AddDate(0, 0, -3).Format(apiTimeFmt), UpdatedOn: now.AddDate(0, 0, -3).Format(apiTimeFmt),
+				MessageBody: "MVA WITH INJURIES RT 1 AND OAK RD", Address: "RT 1 AND OAK RD"},
+			{Id: 2, ArrivedOn: now.Add(-30 * time.Minute).Format(apiTimeFmt), UpdatedOn: now.Add(-30 * time.Minute).Format(apiTimeFmt),
+				MessageBody: "STRUCTURE FIRE 100 MAIN ST", Address: "100 MAIN ST", VerifiedCity: "Anytown"},
+		}
+	})
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Location = time.UTC
+	a.now = func() time.Time { return now }
+
+	res, err := a.Sync(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Added != 2 || res.Updated != 0 || !res.Snapshot {
+		t.Errorf("first Sync() = %+v", res)
+	}
+
+	if st := a.State(); !st.LastUpdated.Equal(now.Add(-30 * time.Minute)) {
+		t.Errorf("State() = %+v", st)
+	}
+
+	// an update to the active incident, and a new one
+	s.Update(func(f *iartest.Fixtures) {
+		f.Incidents[1].UpdatedOn = now.Add(-10 * time.Minute).Format(apiTimeFmt)
+		f.Incidents = append(f.Incidents, &iarapi.Incident{Id: 3, ArrivedOn: now.Add(-5 * time.Minute).Format(apiTimeFmt),
+			UpdatedOn: now.Add(-5 * time.Minute).Format(apiTimeFmt), MessageBody: "ALARM ACTIVATION 5 OAK RD"})
+	})
+
+	if res, err = a.Sync(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Added != 1 || res.Updated != 1 {
+		t.Errorf("incremental Sync() = %+v", res)
+	}
+
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// everything must survive reopening, including after compaction
+	if a, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Location = time.UTC
+
+	if n := len(a.Incidents()); n != 3 {
+		t.Errorf("Incidents() returned %d, want 3", n)
+	}
+
+	if inc, ok := a.Get(2); !ok || inc.UpdatedOn != now.Add(-10*time.Minute).Format(apiTimeFmt) {
+		t.Errorf("Get(2) = %+v", inc)
+	}
+
+	if snaps := a.Snapshots(2); len(snaps) != 2 || len(snaps[0].Responders) != 1 {
+		t.Errorf("Snapshots(2) = %+v", snaps)
+	}
+
+	if snaps := a.Snapshots(1); len(snaps) != 0 {
+		t.Errorf("Snapshots(1) = %+v, want none for inactive incident", snaps)
+	}
+
+	if snaps := a.SnapshotsBetween(now.Add(-time.Minute), now.Add(time.Minute)); len(snaps) != 2 {
+		t.Errorf("SnapshotsBetween() returned %d, want 2", len(snaps))
+	}
+
+	tests := []struct {
+		name string
+		got  iarapi.IncidentList
+		want []int
+	}{
+		{name: "ByDate", got: a.ByDate(now.Add(-time.Hour), now), want: []int{2, 3}},
+		{name: "ByAddress", got: a.ByAddress("oak rd"), want: []int{1}},
+		{name: "ByAddress verified", got: a.ByAddress("anytown"), want: []int{2}},
+		{name: "Search", got: a.Search("oak alarm"), want: []int{3}},
+		{name: "Search none", got: a.Search("hazmat"), want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := make([]int, 0)
+			for _, inc := range tt.got {
+				ids = append(ids, inc.Id)
+			}
+
+			if len(ids) != len(tt.want) {
+				t.Fatalf("got ids %v, want %v", ids, tt.want)
+			}
+
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("got ids %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestArchive_Sync_RepeatedPage(t *testing.T) {
+	now := time.Date(2022, 11, 4, 12, 0, 0, 0, time.UTC)
+
+	// a server which ignores the page number returns the same full page forever
+	src := new(fakeSource)
+	for i := 1; i <= searchPageSize; i++ {
+		src.incidents = append(src.incidents, &iarapi.Incident{Id: i, ArrivedOn: now.AddDate(0, 0, -3).Format(apiTimeFmt)})
+	}
+
+	a, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.now = func() time.Time { return now }
+
+	res, err := a.Sync(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Added != searchPageSize || res.Updated != 0 {
+		t.Errorf("Sync() = %+v", res)
+	}
+}
+
+// pagingSource returns a full page of new incidents for every page number
+type pagingSource struct {
+	fakeSource
+}
+
+func (p *pagingSource) SearchIncidents(isr *iarapi.IncidentSearchRequest) (*iarapi.IncidentList, error) {
+	il := make(iarapi.IncidentList, 0, isr.PageSize)
+	for i := 0; i < isr.PageSize; i++ {
+		il = append(il, &iarapi.Incident{Id: (isr.Page-1)*isr.PageSize + i + 1})
+	}
+	return &il, nil
+}
+
+func TestArchive_Sync_Truncated(t *testing.T) {
+	a, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if _, err = a.Sync(new(pagingSource)); !errors.Is(err, ErrSearchTruncated) {
+		t.Fatalf("Sync() error = %v, want %v", err, ErrSearchTruncated)
+	}
+
+	if n := len(a.Incidents()); n != 0 {
+		t.Errorf("stored %d incidents from a truncated search", n)
+	}
+
+	if st := a.State(); !st.LastUpdated.IsZero() || !st.LastSync.IsZero() {
+		t.Errorf("State() = %+v, want unchanged", st)
+	}
+}
+
+func TestOpen_TruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"incident":{"id":1,"arrivedOn":"2022-11-01T10:00:00"}}` + "\n" + `{"incident":{"id":2,"arr`
+
+	if err := os.WriteFile(filepath.Join(dir, incidentFile), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.appendIncident(&iarapi.Incident{Id: 3}); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Close()
+
+	if a, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if _, ok := a.Get(1); !ok || len(a.Incidents()) != 2 {
+		t.Errorf("Incidents() = %v, want ids 1 and 3", a.Incidents())
+	}
+}
+
+func TestOpen_IncidentExtra(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first record is in the format written before incidents encoded their extra fields
+	data := `{"incident":{"id":1,"arrivedOn":"2022-11-01T10:00:00"},"extra":{"priority":"high"}}` + "\n" +
+		`{"id":2,"arrivedOn":"2022-11-02T10:00:00","priority":"low"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, incidentFile), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		for id, want := range map[int]string{1: `"high"`, 2: `"low"`} {
+			if inc, ok := a.Get(id); !ok || string(inc.Extra["priority"]) != want {
+				t.Errorf("Get(%d) = %+v, want priority %s", id, inc, want)
+			}
+		}
+	}
+	check()
+
+	if err = a.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Close()
+
+	if a, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	check()
+}
@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	// DefaultSyncInterval is how often a Correlator searches for new incidents
+	DefaultSyncInterval = 5 * time.Minute
+
+	// DefaultSnapshotInterval is how often a Correlator captures the responder board while an incident is active
+	DefaultSnapshotInterval = 30 * time.Second
+
+	// callLead allows for responders who are called shortly before the incident is recorded as arriving
+	callLead = 5 * time.Minute
+)
+
+// RosterEntry is a responder attributed to an incident.  The destination, ETA and response code are from the latest
+// snapshot the responder was seen in.
+type RosterEntry struct {
+	MemberId       int       `json:"memberId"`
+	ResponderId    string    `json:"responderId"`
+	Name           string    `json:"name"`
+	SubscriberName string    `json:"subscriberName,omitempty"`
+	RespondingTo   string    `json:"respondingTo"`
+	CalledAt       time.Time `json:"calledAt"`
+	EtaBefore      time.Time `json:"etaBefore"`
+	Expired        time.Time `json:"expired"`
+	IsMutualAid    bool      `json:"isMutualAid"`
+	ResponseCodeId int       `json:"responseCodeId"`
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+// Roster is the list of members who responded to an incident, ordered by the time they were called
+type Roster struct {
+	Incident   *iarapi.Incident `json:"incident"`
+	Responders []*RosterEntry   `json:"responders"`
+}
+
+// Roster returns the responders attributed to the incident from the snapshots taken while it was active.  A responder
+// seen while several incidents were active is attributed to the latest incident which arrived before they were called.
+func (a *Archive) Roster(incidentId int) (*Roster, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	inc, ok := a.incidents[incidentId]
+	if !ok {
+		return nil, false
+	}
+	return a.roster(inc), true
+}
+
+// Rosters returns the rosters of the incidents which arrived at or after start, and before end, ordered by arrival time
+func (a *Archive) Rosters(start, end time.Time) []*Roster {
+	il := a.ByDate(start, end)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rosters := make([]*Roster, 0, len(il))
+	for _, inc := range il {
+		rosters = append(rosters, a.roster(inc))
+	}
+	return rosters
+}
+
+// roster builds the roster for the incident.  The caller must hold the read lock.
+func (a *Archive) roster(inc *iarapi.Incident) *Roster {
+	entries := make(map[string]*RosterEntry)
+
+	for _, s := range a.snapshots {
+		if !containsId(s.IncidentIds, inc.Id) {
+			continue
+		}
+
+		for _, r := range s.Responders {
+			if a.attribute(r, s.IncidentIds) != inc.Id {
+				continue
+			}
+
+			key := responderKey(r)
+			e, ok := entries[key]
+			if !ok {
+				e = &RosterEntry{MemberId: r.MemberId, ResponderId: r.Id, CalledAt: r.CalledAt, FirstSeen: s.Time}
+				entries[key] = e
+			}
+
+			e.Name = r.Name
+			e.SubscriberName = r.SubscriberName
+			e.RespondingTo = r.RespondingTo
+			e.EtaBefore = r.EtaBefore
+			e.Expired = r.Expired
+			e.IsMutualAid = r.IsMutualAid
+			e.ResponseCodeId = r.ResponseCodeId
+			e.LastSeen = s.Time
+		}
+	}
+
+	ro := &Roster{Incident: inc, Responders: make([]*RosterEntry, 0, len(entries))}
+	for _, e := range entries {
+		ro.Responders = append(ro.Responders, e)
+	}
+
+	sort.Slice(ro.Responders, func(i, j int) bool {
+		ri, rj := ro.Responders[i], ro.Responders[j]
+		if ri.CalledAt.Equal(rj.CalledAt) {
+			return ri.Name < rj.Name
+		}
+		return ri.CalledAt.Before(rj.CalledAt)
+	})
+	return ro
+}
+
+// attribute returns the id of the incident, of those active when the responder was seen, the responder was called
+// to, or 0 if their call time is outside the window of every one.  The caller must hold the read lock.
+func (a *Archive) attribute(r *iarapi.Responder, active []int) int {
+	var id int
+	var latest time.Time
+
+	for _, incId := range active {
+		inc, ok := a.incidents[incId]
+		if !ok {
+			continue
+		}
+
+		arrived, err := a.arrivedTime(inc)
+		if err != nil || r.CalledAt.Before(arrived.Add(-callLead)) || !r.CalledAt.Before(arrived.Add(a.activeWindow())) {
+			continue
+		}
+
+		if id == 0 || arrived.After(latest) {
+			id = incId
+			latest = arrived
+		}
+	}
+	return id
+}
+
+func responderKey(r *iarapi.Responder) string {
+	if r.MemberId != 0 {
+		return strconv.Itoa(r.MemberId)
+	}
+	return r.Id
+}
+
+func containsId(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Correlator keeps an archive up to date, capturing the responder board at a short interval while incidents are
+// active so that each incident's roster can be built after the responder entries expire.
+type Correlator struct {
+	Archive *Archive
+	Source  Source
+
+	// SyncInterval is how often new incidents are searched for, DefaultSyncInterval if 0
+	SyncInterval time.Duration
+
+	// SnapshotInterval is how often the responder board is captured while an incident is active,
+	// DefaultSnapshotInterval if 0
+	SnapshotInterval time.Duration
+
+	// OnError is called with sync and snapshot errors, which do not stop Run
+	OnError func(error)
+}
+
+// Run syncs the archive immediately, then syncs and captures snapshots at the configured intervals until ctx is done
+func (c *Correlator) Run(ctx context.Context) error {
+	syncEvery := c.SyncInterval
+	if syncEvery <= 0 {
+		syncEvery = DefaultSyncInterval
+	}
+
+	snapEvery := c.SnapshotInterval
+	if snapEvery <= 0 {
+		snapEvery = DefaultSnapshotInterval
+	}
+
+	t := time.NewTicker(snapEvery)
+	defer t.Stop()
+
+	var lastSync time.Time
+	for {
+		var err error
+		if now := time.Now(); now.Sub(lastSync) >= syncEvery {
+			_, err = c.Archive.Sync(c.Source)
+			lastSync = now
+		} else {
+			_, err = c.Archive.Snapshot(c.Source)
+		}
+
+		if err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+type fakeSource struct {
+	incidents  iarapi.IncidentList
+	responders iarapi.ResponderList
+	err        error
+}
+
+func (f *fakeSource) SearchIncidents(*iarapi.IncidentSearchRequest) (*iarapi.IncidentList, error) {
+	return &f.incidents, f.err
+}
+
+func (f *fakeSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &f.responders, f.err
+}
+
+func TestArchive_Roster(t *testing.T) {
+	base := time.Date(2022, 11, 4, 10, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+
+	src := &fakeSource{incidents: iarapi.IncidentList{
+		{Id: 1, ArrivedOn: at(0).Format(apiTimeFmt), UpdatedOn: at(0).Format(apiTimeFmt)},
+		{Id: 2, ArrivedOn: at(20).Format(apiTimeFmt), UpdatedOn: at(20).Format(apiTimeFmt)},
+	}}
+
+	a, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Location = time.UTC
+
+	now := at(5)
+	a.now = func() time.Time { return now }
+
+	src.responders = iarapi.ResponderList{
+		{Id: "a", MemberId: 10, Name: "Able", CalledAt: at(1), EtaBefore: at(9), RespondingTo: "Station"},
+		{Id: "old", MemberId: 99, Name: "Stale", CalledAt: at(-180)},
+	}
+	if _, err = a.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+
+	now = at(25)
+	src.responders = iarapi.ResponderList{
+		{Id: "a", MemberId: 10, Name: "Able", CalledAt: at(1), EtaBefore: at(12), RespondingTo: "Scene"},
+		{Id: "b", MemberId: 20, Name: "Baker", CalledAt: at(21), EtaBefore: at(30), RespondingTo: "Station"},
+		{Id: "c", Name: "Charlie", CalledAt: at(-2), IsMutualAid: true, SubscriberName: "Other FD"},
+	}
+	if ok, err := a.Snapshot(src); err != nil || !ok {
+		t.Fatalf("Snapshot() = %v, %v", ok, err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		want []*RosterEntry
+	}{
+		{
+			name: "first incident",
+			id:   1,
+			want: []*RosterEntry{
+				{ResponderId: "c", Name: "Charlie", SubscriberName: "Other FD", CalledAt: at(-2), IsMutualAid: true,
+					FirstSeen: at(25), LastSeen: at(25)},
+				{MemberId: 10, ResponderId: "a", Name: "Able", CalledAt: at(1), EtaBefore: at(12), RespondingTo: "Scene",
+					FirstSeen: at(5), LastSeen: at(25)},
+			},
+		},
+		{
+			name: "second incident",
+			id:   2,
+			want: []*RosterEntry{
+				{MemberId: 20, ResponderId: "b", Name: "Baker", CalledAt: at(21), EtaBefore: at(30), RespondingTo: "Station",
+					FirstSeen: at(25), LastSeen: at(25)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ro, ok := a.Roster(tt.id)
+			if !ok {
+				t.Fatalf("Roster(%d) not found", tt.id)
+			}
+
+			if len(ro.Responders) != len(tt.want) {
+				t.Fatalf("Roster(%d) has %d responders, want %d", tt.id, len(ro.Responders), len(tt.want))
+			}
+
+			for i, e := range ro.Responders {
+				if *e != *tt.want[i] {
+					t.Errorf("Roster(%d) entry %d = %+v, want %+v", tt.id, i, e, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, ok := a.Roster(3); ok {
+		t.Error("Roster() found unknown incident")
+	}
+
+	if rs := a.Rosters(at(-60), at(60)); len(rs) != 2 || rs[0].Incident.Id != 1 || rs[1].Incident.Id != 2 {
+		t.Errorf("Rosters() = %+v", rs)
+	}
+}
+
+func TestArchive_Roster_Location(t *testing.T) {
+	// the API reports arrival in the agency's local time, without an offset, while call times are absolute
+	est := time.FixedZone("EST", -5*60*60)
+	arrived := time.Date(2022, 11, 4, 10, 0, 0, 0, est)
+
+	src := &fakeSource{
+		incidents: iarapi.IncidentList{
+			{Id: 1, ArrivedOn: arrived.Format(apiTimeFmt), UpdatedOn: arrived.Format(apiTimeFmt)},
+		},
+		responders: iarapi.ResponderList{
+			{Id: "a", MemberId: 10, Name: "Able", CalledAt: arrived.Add(time.Minute).UTC(), RespondingTo: "Station"},
+		},
+	}
+
+	a, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Location = est
+	a.now = func() time.Time { return arrived.Add(5 * time.Minute) }
+
+	if res, err := a.Sync(src); err != nil || !res.Snapshot {
+		t.Fatalf("Sync() = %+v, %v", res, err)
+	}
+
+	if ro, ok := a.Roster(1); !ok || len(ro.Responders) != 1 || ro.Responders[0].Name != "Able" {
+		t.Errorf("Roster(1) = %+v", ro)
+	}
+
+	if rs := a.Rosters(arrived.Add(-time.Minute), arrived.Add(time.Minute)); len(rs) != 1 {
+		t.Errorf("Rosters() returned %d, want 1", len(rs))
+	}
+}
+
+func TestCorrelator_Run(t *testing.T) {
+	a, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	c := &Correlator{Archive: a, Source: &fakeSource{err: errors.New("unavailable")}, SnapshotInterval: time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+			cancel()
+		},
+	}
+
+	if err = c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if err = <-errs; err == nil {
+		t.Error("OnError not called")
+	}
+}
@@ -0,0 +1,152 @@
+package iarapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls the response cache enabled by WithCache.  Only GET endpoints are cached, keyed by their API
+// path (like "/Member").  Endpoints without an entry in TTLs use DefaultTTL, and a TTL of 0 disables caching.
+//
+// Once an entry expires it is revalidated using the ETag or Last-Modified value of the cached response, if the
+// server provided one.  With StaleIfError set, an expired entry is returned when the request to refresh it fails.
+type CacheConfig struct {
+	DefaultTTL   time.Duration
+	TTLs         map[string]time.Duration
+	StaleIfError bool
+}
+
+// DefaultCacheConfig caches the slow changing agency and member data, and nothing related to active incidents
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		TTLs: map[string]time.Duration{
+			"/Subscriber":     time.Hour,
+			"/Member":         15 * time.Minute,
+			"/ResponderCodes": time.Hour,
+			"/OnDutyAtCodes":  time.Hour,
+			"/DispatcherContent/AssociatedDispatchers": time.Hour,
+		},
+		StaleIfError: true,
+	}
+}
+
+// WithCache enables caching of API responses
+func WithCache(cfg CacheConfig) ClientOption {
+	return func(c *Client) {
+		c.cache = &responseCache{cfg: cfg, entries: make(map[string]*cacheEntry), now: time.Now}
+	}
+}
+
+// InvalidateCache removes the cached responses for the API paths, or all cached responses if no paths are given
+func (c *Client) InvalidateCache(paths ...string) {
+	if c.cache == nil {
+		return
+	}
+
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+
+	if len(paths) < 1 {
+		c.cache.entries = make(map[string]*cacheEntry)
+		return
+	}
+
+	for _, p := range paths {
+		delete(c.cache.entries, p)
+	}
+}
+
+type cacheEntry struct {
+	body         []byte
+	etag         string
+	lastModified string
+	expires      time.Time
+}
+
+type responseCache struct {
+	cfg     CacheConfig
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	now     func() time.Time
+}
+
+func (rc *responseCache) ttl(path string) time.Duration {
+	if ttl, ok := rc.cfg.TTLs[path]; ok {
+		return ttl
+	}
+	return rc.cfg.DefaultTTL
+}
+
+func (rc *responseCache) get(path string) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	e, ok := rc.entries[path]
+	if !ok {
+		return nil
+	}
+
+	cp := *e
+	return &cp
+}
+
+func (rc *responseCache) put(path string, e *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[path] = e
+}
+
+func (c *Client) cachedGet(ctx context.Context, path string, t interface{}) error {
+	rc := c.cache
+	now := rc.now()
+
+	entry := rc.get(path)
+	if entry != nil && now.Before(entry.expires) {
+		return c.decodeApiResponse(path, entry.body, t)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl()+path, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		if len(entry.etag) > 0 {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+
+		if len(entry.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+
+	res, b, err := c.sendApiRequest(req)
+	switch {
+	case err == nil && res.StatusCode == http.StatusNotModified && entry != nil:
+		entry.expires = now.Add(rc.ttl(path))
+		rc.put(path, entry)
+		return c.decodeApiResponse(path, entry.body, t)
+	case err == nil && res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices:
+		if err = c.decodeApiResponse(path, b, t); err != nil {
+			return err
+		}
+
+		rc.put(path, &cacheEntry{
+			body:         b,
+			etag:         res.Header.Get("ETag"),
+			lastModified: res.Header.Get("Last-Modified"),
+			expires:      now.Add(rc.ttl(path)),
+		})
+		return nil
+	case err == nil:
+		err = fmt.Errorf("HTTP Status %d", res.StatusCode)
+	}
+
+	if rc.cfg.StaleIfError && entry != nil {
+		return c.decodeApiResponse(path, entry.body, t)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package iarapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Cache(t *testing.T) {
+	var hits, notModified int
+	var fail bool
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if fail {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.URL.Path == "/IncidentList" {
+			sendResponse(w, r, &incidentListGood)
+			return
+		}
+		sendResponse(w, r, &memberInfoGood)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cfg := DefaultCacheConfig()
+
+	c := &Client{httpClient: *ts.Client()}
+	WithEndpoints("", "", ts.URL)(c)
+	WithCache(cfg)(c)
+	c.cache.now = func() time.Time { return now }
+
+	get := func() {
+		t.Helper()
+		mi, err := c.Member()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mi.Id != memberInfoGood.Id {
+			t.Fatalf("Member() = %+v", mi)
+		}
+	}
+
+	get()
+	get()
+	if hits != 1 {
+		t.Errorf("fresh entry: got %d requests, want 1", hits)
+	}
+
+	now = now.Add(cfg.TTLs["/Member"] + time.Second)
+	get()
+	if hits != 2 || notModified != 1 {
+		t.Errorf("expired entry: got %d requests and %d not modified, want 2 and 1", hits, notModified)
+	}
+
+	get()
+	if hits != 2 {
+		t.Errorf("revalidated entry: got %d requests, want 2", hits)
+	}
+
+	fail = true
+	now = now.Add(cfg.TTLs["/Member"] + time.Second)
+	get()
+	if hits != 3 {
+		t.Errorf("stale entry: got %d requests, want 3", hits)
+	}
+
+	c.InvalidateCache("/Member")
+	if _, err := c.Member(); err == nil {
+		t.Error("expected error after invalidation with server down")
+	}
+
+	// endpoints without a TTL are not cached
+	fail = false
+	if _, err := c.Incidents(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Incidents(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits != 6 {
+		t.Errorf("uncached endpoint: got %d requests, want 6", hits)
+	}
+}
+
+func TestClient_CacheInvalidatedByWrites(t *testing.T) {
+	hits := make(map[string]int)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			hits[r.URL.Path]++
+			sendResponse(w, r, []interface{}{})
+			return
+		}
+		sendResponse(w, r, map[string]interface{}{})
+	}))
+	defer ts.Close()
+
+	c := &Client{httpClient: *ts.Client()}
+	WithEndpoints("", "", ts.URL)(c)
+	WithCache(CacheConfig{DefaultTTL: time.Hour})(c)
+
+	tests := []struct {
+		name  string
+		path  string
+		list  func() error
+		write func() error
+	}{
+		{"CreateHydrant", "/Hydrants", func() error { _, err := c.Hydrants(); return err },
+			func() error { _, err := c.CreateHydrant(&Hydrant{}); return err }},
+		{"UpdateHydrant", "/Hydrants", func() error { _, err := c.Hydrants(); return err },
+			func() error { _, err := c.UpdateHydrant(&Hydrant{Id: 1}); return err }},
+		{"DeleteHydrant", "/Hydrants", func() error { _, err := c.Hydrants(); return err },
+			func() error { return c.DeleteHydrant(1) }},
+		{"CreateMarker", "/Markers", func() error { _, err := c.Markers(); return err },
+			func() error { _, err := c.CreateMarker(&Marker{}); return err }},
+		{"UpdateMarker", "/Markers", func() error { _, err := c.Markers(); return err },
+			func() error { _, err := c.UpdateMarker(&Marker{Id: 1}); return err }},
+		{"DeleteMarker", "/Markers", func() error { _, err := c.Markers(); return err },
+			func() error { return c.DeleteMarker(1) }},
+		{"CreateGeofence", "/Geofences", func() error { _, err := c.Geofences(); return err },
+			func() error { _, err := c.CreateGeofence(&Geofence{}); return err }},
+		{"UpdateGeofence", "/Geofences", func() error { _, err := c.Geofences(); return err },
+			func() error { _, err := c.UpdateGeofence(&Geofence{Id: 1}); return err }},
+		{"DeleteGeofence", "/Geofences", func() error { _, err := c.Geofences(); return err },
+			func() error { return c.DeleteGeofence(1) }},
+		{"CreateEvent", "/Events", func() error { _, err := c.Events(); return err },
+			func() error { _, err := c.CreateEvent(&Event{}); return err }},
+		{"UpdateEvent", "/Events", func() error { _, err := c.Events(); return err },
+			func() error { _, err := c.UpdateEvent(&Event{Id: 1}); return err }},
+		{"DeleteEvent", "/Events", func() error { _, err := c.Events(); return err },
+			func() error { return c.DeleteEvent(1) }},
+		{"UpdateApparatusStatus", "/ApparatusList", func() error { _, err := c.ApparatusList(); return err },
+			func() error { _, err := c.UpdateApparatusStatus(1, ApparatusInService); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.InvalidateCache()
+			hits[tt.path] = 0
+
+			for i := 0; i < 2; i++ {
+				if err := tt.list(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.list(); err != nil {
+				t.Fatal(err)
+			}
+
+			if hits[tt.path] != 2 {
+				t.Errorf("got %d requests for %s, want 2", hits[tt.path], tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Command iardisplay serves the station display dashboard.
+//
+// The agency login is read from the IAR_AGENCY, IAR_USERNAME and IAR_PASSWORD environment variables.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/dashboard"
+	"github.com/mmmorris1975/iarapi/live"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to serve the dashboard on")
+	interval := flag.Duration("interval", iarapi.DefaultWatchInterval, "time between polls of IamResponding")
+	tz := flag.String("tz", "", "agency time zone, like America/New_York, the host's zone if empty")
+	flag.Parse()
+
+	loc := time.Local
+	if len(*tz) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	c, err := iarapi.NewClient(os.Getenv("IAR_AGENCY"), os.Getenv("IAR_USERNAME"), os.Getenv("IAR_PASSWORD"),
+		iarapi.WithCache(iarapi.DefaultCacheConfig()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	w := iarapi.NewWatcher(c)
+	w.Interval = *interval
+	w.OnError = func(err error) {
+		log.Print(err)
+	}
+
+	// the first poll records the current state for the feed's snapshot
+	if _, err = w.Poll(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	feed := live.NewFeed()
+	go func() {
+		_ = feed.Run(ctx, w)
+	}()
+
+	go func() {
+		_ = w.Run(ctx)
+	}()
+
+	log.Printf("serving the dashboard on %s", *listen)
+	d := dashboard.New(c, feed)
+	d.Location = loc
+
+	// no write timeout, the event stream stays open
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           d,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,79 @@
+// Command iarproxy logs in to IamResponding once, and serves the proxy API to internal consumers authenticated with
+// API keys.
+//
+// The agency login is read from the IAR_AGENCY, IAR_USERNAME and IAR_PASSWORD environment variables.  The keys file
+// is a JSON array of keys:
+//
+//	[{"name": "station-display", "hash": "...", "scopes": ["incidents", "responders"], "rate": 0.5, "burst": 5}]
+//
+// Run "iarproxy -hash-key" to read a key from stdin and print its hash.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/proxy"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to serve the API on")
+	keysFile := flag.String("keys", "keys.json", "JSON file of API keys")
+	ttl := flag.Duration("ttl", 15*time.Second, "cache time for incidents, responders and messages")
+	hashKey := flag.Bool("hash-key", false, "print the hash of the key read from stdin, and exit")
+	flag.Parse()
+
+	if *hashKey {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if len(line) < 1 && err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(proxy.HashKey(strings.TrimSpace(line)))
+		return
+	}
+
+	f, err := os.Open(*keysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := proxy.LoadKeys(f)
+	_ = f.Close()
+	if err != nil {
+		log.Fatalf("loading %s: %v", *keysFile, err)
+	}
+
+	cfg := iarapi.DefaultCacheConfig()
+	for _, p := range []string{"/IncidentList", "/ResponderList", "/MessageList"} {
+		cfg.TTLs[p] = *ttl
+	}
+
+	c, err := iarapi.NewClient(os.Getenv("IAR_AGENCY"), os.Getenv("IAR_USERNAME"), os.Getenv("IAR_PASSWORD"),
+		iarapi.WithCache(cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := proxy.NewServer(c, keys)
+	s.OnError = func(err error) {
+		log.Print(err)
+	}
+
+	log.Printf("serving %d keys on %s", len(keys), *listen)
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,114 @@
+//go:build !windows
+// +build !windows
+
+// Command iartui runs the terminal dashboard.
+//
+// The agency login is read from the IAR_AGENCY, IAR_USERNAME and IAR_PASSWORD environment variables.  The terminal
+// is switched to cbreak mode using stty while the dashboard runs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/tui"
+)
+
+func main() {
+	interval := flag.Duration("interval", iarapi.DefaultWatchInterval, "time between polls of IamResponding")
+	flag.Parse()
+
+	c, err := iarapi.NewClient(os.Getenv("IAR_AGENCY"), os.Getenv("IAR_USERNAME"), os.Getenv("IAR_PASSWORD"),
+		iarapi.WithCache(iarapi.DefaultCacheConfig()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := iarapi.NewWatcher(c)
+	w.Interval = *interval
+	if _, err = w.Poll(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		_ = w.Run(ctx)
+	}()
+
+	saved, err := stty("-g")
+	if err != nil {
+		log.Fatalf("reading terminal settings: %v", err)
+	}
+
+	if _, err = stty("cbreak", "-echo"); err != nil {
+		log.Fatalf("setting terminal mode: %v", err)
+	}
+
+	// alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+
+	app := tui.NewApp(c, w, os.Stdin, os.Stdout)
+	app.Size = terminalSize()
+	app.Responder = c
+	err = app.Run(ctx)
+
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	_, _ = stty(saved)
+
+	if err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns a function reporting the terminal size, read again when the terminal is resized
+func terminalSize() func() (int, int) {
+	var mu sync.Mutex
+	width, height := 80, 24
+
+	read := func() {
+		out, err := stty("size")
+		if err != nil {
+			return
+		}
+
+		var h, w int
+		if _, err = fmt.Sscan(out, &h, &w); err == nil {
+			mu.Lock()
+			width, height = w, h
+			mu.Unlock()
+		}
+	}
+	read()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		for range ch {
+			read()
+		}
+	}()
+
+	return func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return width, height
+	}
+}
@@ -0,0 +1,164 @@
+// Package dashboard serves a self-hosted station display: the latest incident with its location on a map, the
+// responder board with ETAs and destinations, the members on duty, and the recent messages.
+//
+// The web UI is embedded in the binary.  It is pushed changes by a live.Feed over Server-Sent Events, and fetches
+// the slower changing state from the dashboard's /state endpoint when an incident or message arrives.
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/live"
+)
+
+// DefaultMessages is the number of recent messages shown
+const DefaultMessages = 10
+
+//go:embed static
+var static embed.FS
+
+// Source is the subset of the iarapi.Client methods used by the dashboard
+type Source interface {
+	Subscriber() (*iarapi.SubscriberInfo, error)
+	Incidents() (*iarapi.IncidentList, error)
+	Messages() (*iarapi.MessageList, error)
+	ResponderCodes() (*iarapi.ResponderCodes, error)
+	OnDutyAtCodes() (*iarapi.OnDutyAtCodeList, error)
+}
+
+// State is the response of the /state endpoint
+type State struct {
+	Agency string `json:"agency"`
+
+	// Incident is the latest incident, and Location its coordinates if they could be found
+	Incident *iarapi.Incident    `json:"incident"`
+	Location *iarapi.Coordinates `json:"location,omitempty"`
+
+	// Arrived is the incident's arrival time with its zone offset, if it could be parsed
+	Arrived *time.Time `json:"arrived,omitempty"`
+
+	// ResponseCodes name the response code ids of the responders
+	ResponseCodes map[int]string `json:"responseCodes"`
+
+	// OnDuty are the destinations of members on duty rather than responding to an incident
+	OnDuty []string `json:"onDuty"`
+
+	// Messages are the most recent messages, newest first
+	Messages iarapi.MessageList `json:"messages"`
+}
+
+// Dashboard is an http.Handler serving the UI at /, the feed at /events, and the state at /state
+type Dashboard struct {
+	// Messages is the number of recent messages shown, DefaultMessages if 0
+	Messages int
+
+	// Location is the agency's time zone, which incident times without a zone offset are in, time.Local if nil
+	Location *time.Location
+
+	src Source
+	mux *http.ServeMux
+}
+
+func New(src Source, feed *live.Feed) *Dashboard {
+	d := &Dashboard{src: src, mux: http.NewServeMux()}
+
+	files, _ := fs.Sub(static, "static")
+	d.mux.Handle("/", http.FileServer(http.FS(files)))
+	d.mux.Handle("/events", feed.SSE())
+	d.mux.HandleFunc("/state", d.serveState)
+	return d
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+func (d *Dashboard) serveState(w http.ResponseWriter, _ *http.Request) {
+	s, err := d.State()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// State fetches the current dashboard state from the source
+func (d *Dashboard) State() (*State, error) {
+	si, err := d.src.Subscriber()
+	if err != nil {
+		return nil, err
+	}
+
+	il, err := d.src.Incidents()
+	if err != nil {
+		return nil, err
+	}
+
+	ml, err := d.src.Messages()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := d.src.ResponderCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	onDuty, err := d.src.OnDutyAtCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{
+		Agency:        si.Name,
+		ResponseCodes: make(map[int]string),
+		OnDuty:        make([]string, 0, len(*onDuty)),
+		Messages:      make(iarapi.MessageList, 0),
+	}
+
+	for _, inc := range *il {
+		if s.Incident == nil || inc.Id > s.Incident.Id {
+			s.Incident = inc
+		}
+	}
+
+	if s.Incident != nil {
+		s.Location, _ = s.Incident.Coordinates()
+
+		if t, err := s.Incident.ArrivedTimeIn(d.Location); err == nil {
+			s.Arrived = &t
+		}
+	}
+
+	for _, c := range codes.ResponseCodes {
+		s.ResponseCodes[c.Id] = c.KeyEntry
+	}
+
+	for _, c := range *onDuty {
+		s.OnDuty = append(s.OnDuty, c.KeyEntry)
+	}
+
+	s.Messages = append(s.Messages, *ml...)
+	sort.SliceStable(s.Messages, func(i, j int) bool {
+		return s.Messages[i].CreatedDate.After(s.Messages[j].CreatedDate)
+	})
+
+	n := d.Messages
+	if n <= 0 {
+		n = DefaultMessages
+	}
+
+	if len(s.Messages) > n {
+		s.Messages = s.Messages[:n]
+	}
+	return s, nil
+}
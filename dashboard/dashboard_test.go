@@ -0,0 +1,137 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/iartest"
+	"github.com/mmmorris1975/iarapi/live"
+)
+
+func newTestDashboard(t *testing.T) (*Dashboard, *iartest.Server) {
+	t.Helper()
+
+	is := iartest.NewServer()
+	t.Cleanup(is.Close)
+
+	c, err := is.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(c, live.NewFeed()), is
+}
+
+func TestDashboard_static(t *testing.T) {
+	d, _ := newTestDashboard(t)
+
+	tests := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{path: "/", contentType: "text/html", contains: `<script src="app.js">`},
+		{path: "/app.js", contentType: "javascript", contains: "new EventSource('events')"},
+		{path: "/style.css", contentType: "text/css", contains: "#map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+
+			if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+				t.Errorf("Content-Type = %s, want %s", ct, tt.contentType)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body does not contain %q", tt.contains)
+			}
+		})
+	}
+}
+
+func TestDashboard_State(t *testing.T) {
+	d, is := newTestDashboard(t)
+	d.Messages = 2
+	d.Location = time.FixedZone("EST", -5*3600)
+
+	// incident times are the agency's wall time
+	now := time.Now().In(d.Location).Truncate(time.Second)
+	is.Update(func(f *iartest.Fixtures) {
+		f.Incidents = append(f.Incidents, &iarapi.Incident{
+			Id:          f.Incidents[0].Id + 1,
+			ArrivedOn:   now.Format("2006-01-02T15:04:05"),
+			MessageBody: "MVA RT 30 LAT: 40.0123 LON: -75.9876",
+			UpdatedOn:   now.Format("2006-01-02T15:04:05"),
+		})
+
+		f.Messages = append(f.Messages,
+			&iarapi.Message{Id: "msg-2", Message: "Newest", CreatedDate: now},
+			&iarapi.Message{Id: "msg-3", Message: "Older", CreatedDate: now.Add(-time.Hour)},
+		)
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/state", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	s := new(State)
+	if err := json.Unmarshal(w.Body.Bytes(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Agency != "Test Fire Company" {
+		t.Errorf("Agency = %s", s.Agency)
+	}
+
+	if s.Incident == nil || !strings.HasPrefix(s.Incident.MessageBody, "MVA") {
+		t.Errorf("Incident = %+v, want the latest", s.Incident)
+	}
+
+	if s.Arrived == nil || !s.Arrived.Equal(now) {
+		t.Errorf("Arrived = %v, want %v", s.Arrived, now)
+	}
+
+	if want := (&iarapi.Coordinates{Lat: 40.0123, Lng: -75.9876}); !reflect.DeepEqual(s.Location, want) {
+		t.Errorf("Location = %+v, want %+v", s.Location, want)
+	}
+
+	if want := []string{"Station 1"}; !reflect.DeepEqual(s.OnDuty, want) {
+		t.Errorf("OnDuty = %v, want %v", s.OnDuty, want)
+	}
+
+	if want := map[int]string{1: "Station", 2: "Scene", 3: "Not Responding"}; !reflect.DeepEqual(s.ResponseCodes, want) {
+		t.Errorf("ResponseCodes = %v, want %v", s.ResponseCodes, want)
+	}
+
+	var msgs []string
+	for _, m := range s.Messages {
+		msgs = append(msgs, m.Message)
+	}
+
+	if want := []string{"Newest", "Older"}; !reflect.DeepEqual(msgs, want) {
+		t.Errorf("Messages = %v, want %v", msgs, want)
+	}
+}
+
+func TestDashboard_StateError(t *testing.T) {
+	d, is := newTestDashboard(t)
+	is.InjectFault(iartest.ApiPath+"/OnDutyAtCodes", iartest.Fault{Status: http.StatusInternalServerError, Count: 1})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/state", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,175 @@
+'use strict';
+
+// How long after an incident it is highlighted as active
+const activeWindow = 60 * 60 * 1000;
+
+const state = {
+  responders: new Map(),
+  responseCodes: {},
+  onDuty: new Set(),
+  incident: null,
+  arrived: null,
+};
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  if (className) e.className = className;
+  return e;
+}
+
+// Times from the server carry a zone offset
+function parseTime(s) {
+  if (!s) return null;
+  const t = new Date(s);
+  return isNaN(t) ? null : t;
+}
+
+function formatEta(eta, now) {
+  if (!eta || eta.getFullYear() < 2000) return '';
+  const mins = Math.round((eta - now) / 60000);
+  return mins <= 0 ? 'arrived' : mins + ' min';
+}
+
+function renderBoard() {
+  const now = new Date();
+  const responding = [];
+  const onDuty = [];
+
+  for (const r of state.responders.values()) {
+    (state.onDuty.has(r.respondingTo) ? onDuty : responding).push(r);
+  }
+
+  responding.sort((a, b) => new Date(a.etaBefore) - new Date(b.etaBefore));
+
+  const rows = responding.map(r => {
+    const eta = parseTime(r.etaBefore);
+    const tr = el('tr');
+    tr.appendChild(el('td', r.name));
+    tr.appendChild(el('td', r.respondingTo));
+    tr.appendChild(el('td', state.responseCodes[r.responseCodeId] || ''));
+    tr.appendChild(el('td', formatEta(eta, now), 'eta'));
+    if (eta && eta <= now) tr.classList.add('arrived');
+    if (r.isMutualAid) tr.classList.add('mutual-aid');
+    return tr;
+  });
+  $('responders').replaceChildren(...rows);
+
+  onDuty.sort((a, b) => a.name.localeCompare(b.name));
+  $('on-duty').replaceChildren(...onDuty.map(r => el('li', r.name + ' — ' + r.respondingTo)));
+}
+
+function renderIncident() {
+  const inc = state.incident;
+  if (!inc) return;
+
+  // arrivedOn may lack a zone offset, the server resolves it in the agency's zone
+  const arrived = parseTime(state.arrived);
+  $('incident-time').textContent = arrived ? arrived.toLocaleString() : '';
+  $('incident-address').textContent = inc.address || '';
+  $('incident-body').textContent = inc.messageBody;
+  $('incident').classList.toggle('active', arrived && new Date() - arrived < activeWindow);
+}
+
+function renderMap(loc) {
+  const map = $('map');
+  if (!loc) {
+    map.hidden = true;
+    map.removeAttribute('src');
+    $('coordinates').textContent = '';
+    return;
+  }
+
+  const d = 0.01;
+  const bbox = [loc.lng - d, loc.lat - d, loc.lng + d, loc.lat + d].join(',');
+  const src = 'https://www.openstreetmap.org/export/embed.html?layer=mapnik&bbox=' + bbox +
+    '&marker=' + loc.lat + ',' + loc.lng;
+  if (map.src !== src) map.src = src;
+  map.hidden = false;
+  $('coordinates').textContent = loc.lat.toFixed(5) + ', ' + loc.lng.toFixed(5);
+}
+
+function renderMessages(messages) {
+  $('messages').replaceChildren(...messages.map(m => el('span', m.message)));
+}
+
+async function refreshState() {
+  try {
+    const res = await fetch('state');
+    if (!res.ok) return;
+    const s = await res.json();
+
+    $('agency').textContent = s.agency || 'Station Display';
+    document.title = $('agency').textContent;
+    state.responseCodes = s.responseCodes || {};
+    state.onDuty = new Set(s.onDuty || []);
+    state.incident = s.incident;
+    state.arrived = s.arrived;
+
+    renderIncident();
+    renderMap(s.location);
+    renderMessages(s.messages || []);
+    renderBoard();
+  } catch (e) {
+    console.error('refreshing state', e);
+  }
+}
+
+function handleFrame(f) {
+  switch (f.type) {
+    case 'snapshot':
+      state.responders = new Map(f.snapshot.responders.map(r => [r.id, r]));
+      renderBoard();
+      refreshState();
+      break;
+    case 'responder.added':
+    case 'responder.updated':
+      state.responders.set(f.event.responder.id, f.event.responder);
+      renderBoard();
+      break;
+    case 'responder.removed':
+      state.responders.delete(f.event.responder.id);
+      renderBoard();
+      break;
+    case 'incident.added':
+    case 'incident.updated':
+    case 'message.added':
+      refreshState();
+      break;
+  }
+}
+
+function connect() {
+  const events = new EventSource('events');
+  const types = ['snapshot', 'heartbeat', 'incident.added', 'incident.updated', 'responder.added',
+    'responder.updated', 'responder.removed', 'message.added'];
+
+  for (const t of types) {
+    events.addEventListener(t, e => handleFrame(JSON.parse(e.data)));
+  }
+
+  events.onopen = () => {
+    $('status').textContent = 'live';
+    $('status').classList.remove('offline');
+  };
+
+  // EventSource reconnects by itself, sending the id of the last event received
+  events.onerror = () => {
+    $('status').textContent = 'reconnecting';
+    $('status').classList.add('offline');
+  };
+}
+
+function tick() {
+  $('clock').textContent = new Date().toLocaleTimeString([], {hour: '2-digit', minute: '2-digit'});
+  renderBoard();
+  renderIncident();
+}
+
+setInterval(tick, 15000);
+tick();
+connect();
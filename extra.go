@@ -0,0 +1,381 @@
+package iarapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Response types keep any fields the service returns which are not mapped to a struct field in their Extra map, so
+// new data is accessible before the library is updated, and encode them again alongside the mapped fields.  FindSchemaDrift reports these unmapped fields, and a
+// Client can be configured to report them as responses are received using WithSchemaDriftHandler.
+
+// SchemaDrift describes the fields of an API response which were not mapped to a Go type
+type SchemaDrift struct {
+	Endpoint string
+	Type     string
+	Fields   []string
+}
+
+var extraType = reflect.TypeOf(map[string]json.RawMessage{})
+
+func (si *SubscriberInfo) UnmarshalJSON(data []byte) error {
+	type subscriberInfo SubscriberInfo
+	return decodeWithExtra(data, (*subscriberInfo)(si), &si.Extra)
+}
+
+func (si SubscriberInfo) MarshalJSON() ([]byte, error) {
+	type subscriberInfo SubscriberInfo
+	return encodeWithExtra(subscriberInfo(si), si.Extra)
+}
+
+func (mi *MemberInfo) UnmarshalJSON(data []byte) error {
+	type memberInfo MemberInfo
+	return decodeWithExtra(data, (*memberInfo)(mi), &mi.Extra)
+}
+
+func (mi MemberInfo) MarshalJSON() ([]byte, error) {
+	type memberInfo MemberInfo
+	return encodeWithExtra(memberInfo(mi), mi.Extra)
+}
+
+func (i *Incident) UnmarshalJSON(data []byte) error {
+	type incident Incident
+	return decodeWithExtra(data, (*incident)(i), &i.Extra)
+}
+
+func (i Incident) MarshalJSON() ([]byte, error) {
+	type incident Incident
+	return encodeWithExtra(incident(i), i.Extra)
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	return decodeWithExtra(data, (*message)(m), &m.Extra)
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return encodeWithExtra(message(m), m.Extra)
+}
+
+func (d *Dispatcher) UnmarshalJSON(data []byte) error {
+	type dispatcher Dispatcher
+	return decodeWithExtra(data, (*dispatcher)(d), &d.Extra)
+}
+
+func (d Dispatcher) MarshalJSON() ([]byte, error) {
+	type dispatcher Dispatcher
+	return encodeWithExtra(dispatcher(d), d.Extra)
+}
+
+func (d *Dispatchers) UnmarshalJSON(data []byte) error {
+	type dispatchers Dispatchers
+	return decodeWithExtra(data, (*dispatchers)(d), &d.Extra)
+}
+
+func (d Dispatchers) MarshalJSON() ([]byte, error) {
+	type dispatchers Dispatchers
+	return encodeWithExtra(dispatchers(d), d.Extra)
+}
+
+func (rc *ResponderCode) UnmarshalJSON(data []byte) error {
+	type responderCode ResponderCode
+	return decodeWithExtra(data, (*responderCode)(rc), &rc.Extra)
+}
+
+func (rc ResponderCode) MarshalJSON() ([]byte, error) {
+	type responderCode ResponderCode
+	return encodeWithExtra(responderCode(rc), rc.Extra)
+}
+
+func (rc *ResponderCodes) UnmarshalJSON(data []byte) error {
+	type responderCodes ResponderCodes
+	return decodeWithExtra(data, (*responderCodes)(rc), &rc.Extra)
+}
+
+func (rc ResponderCodes) MarshalJSON() ([]byte, error) {
+	type responderCodes ResponderCodes
+	return encodeWithExtra(responderCodes(rc), rc.Extra)
+}
+
+func (r *Responder) UnmarshalJSON(data []byte) error {
+	type responder Responder
+	return decodeWithExtra(data, (*responder)(r), &r.Extra)
+}
+
+func (r Responder) MarshalJSON() ([]byte, error) {
+	type responder Responder
+	return encodeWithExtra(responder(r), r.Extra)
+}
+
+func (oc *OnDutyAtCode) UnmarshalJSON(data []byte) error {
+	type onDutyAtCode OnDutyAtCode
+	return decodeWithExtra(data, (*onDutyAtCode)(oc), &oc.Extra)
+}
+
+func (oc OnDutyAtCode) MarshalJSON() ([]byte, error) {
+	type onDutyAtCode OnDutyAtCode
+	return encodeWithExtra(onDutyAtCode(oc), oc.Extra)
+}
+
+func (h *Hydrant) UnmarshalJSON(data []byte) error {
+	type hydrant Hydrant
+	return decodeWithExtra(data, (*hydrant)(h), &h.Extra)
+}
+
+func (h Hydrant) MarshalJSON() ([]byte, error) {
+	type hydrant Hydrant
+	return encodeWithExtra(hydrant(h), h.Extra)
+}
+
+func (ma *MarkerAttachment) UnmarshalJSON(data []byte) error {
+	type markerAttachment MarkerAttachment
+	return decodeWithExtra(data, (*markerAttachment)(ma), &ma.Extra)
+}
+
+func (ma MarkerAttachment) MarshalJSON() ([]byte, error) {
+	type markerAttachment MarkerAttachment
+	return encodeWithExtra(markerAttachment(ma), ma.Extra)
+}
+
+func (m *Marker) UnmarshalJSON(data []byte) error {
+	type marker Marker
+	return decodeWithExtra(data, (*marker)(m), &m.Extra)
+}
+
+func (m Marker) MarshalJSON() ([]byte, error) {
+	type marker Marker
+	return encodeWithExtra(marker(m), m.Extra)
+}
+
+func (gt *GeofenceTrigger) UnmarshalJSON(data []byte) error {
+	type geofenceTrigger GeofenceTrigger
+	return decodeWithExtra(data, (*geofenceTrigger)(gt), &gt.Extra)
+}
+
+func (gt GeofenceTrigger) MarshalJSON() ([]byte, error) {
+	type geofenceTrigger GeofenceTrigger
+	return encodeWithExtra(geofenceTrigger(gt), gt.Extra)
+}
+
+func (g *Geofence) UnmarshalJSON(data []byte) error {
+	type geofence Geofence
+	return decodeWithExtra(data, (*geofence)(g), &g.Extra)
+}
+
+func (g Geofence) MarshalJSON() ([]byte, error) {
+	type geofence Geofence
+	return encodeWithExtra(geofence(g), g.Extra)
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type event Event
+	return decodeWithExtra(data, (*event)(e), &e.Extra)
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return encodeWithExtra(event(e), e.Extra)
+}
+
+func (acm *ApparatusCrewMember) UnmarshalJSON(data []byte) error {
+	type apparatusCrewMember ApparatusCrewMember
+	return decodeWithExtra(data, (*apparatusCrewMember)(acm), &acm.Extra)
+}
+
+func (acm ApparatusCrewMember) MarshalJSON() ([]byte, error) {
+	type apparatusCrewMember ApparatusCrewMember
+	return encodeWithExtra(apparatusCrewMember(acm), acm.Extra)
+}
+
+// decodeWithExtra decodes data into v, which must not implement json.Unmarshaler, and sets extra to the unmapped fields
+func decodeWithExtra(data []byte, v interface{}, extra *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var err error
+	*extra, err = unknownFields(data, v)
+	return err
+}
+
+// encodeWithExtra encodes v, which must not implement json.Marshaler, and appends the extra fields which don't map to
+// a field of v, in name order
+func encodeWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) < 1 {
+		return data, err
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		if !known[strings.ToLower(k)] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for i, k := range keys {
+		name, _ := json.Marshal(k)
+		value, err := json.Marshal(extra[k])
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 || len(data) > 2 {
+			buf.WriteByte(',')
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// FindSchemaDrift walks v, a decoded API response, and returns the unmapped fields found in the Extra map of each
+// type.  Fields are merged across all values of the same type, and the results are sorted by type name.
+func FindSchemaDrift(v interface{}) []*SchemaDrift {
+	fields := make(map[string]map[string]bool)
+	collectExtra(reflect.ValueOf(v), fields)
+
+	drift := make([]*SchemaDrift, 0, len(fields))
+	for t, f := range fields {
+		d := &SchemaDrift{Type: t, Fields: make([]string, 0, len(f))}
+		for k := range f {
+			d.Fields = append(d.Fields, k)
+		}
+		sort.Strings(d.Fields)
+		drift = append(drift, d)
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Type < drift[j].Type })
+	return drift
+}
+
+func collectExtra(v reflect.Value, fields map[string]map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectExtra(v.Elem(), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			collectExtra(v.Index(i), fields)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+
+			if f.Name == "Extra" && f.Type == extraType {
+				extra := v.Field(i)
+				if extra.Len() < 1 {
+					continue
+				}
+
+				if fields[t.Name()] == nil {
+					fields[t.Name()] = make(map[string]bool)
+				}
+
+				for _, k := range extra.MapKeys() {
+					fields[t.Name()][k.String()] = true
+				}
+				continue
+			}
+			collectExtra(v.Field(i), fields)
+		}
+	}
+}
+
+// lenientInt decodes a JSON number, a string holding a number, or null (as 0)
+type lenientInt int
+
+func (i *lenientInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if s == "null" || len(s) < 1 {
+		*i = 0
+		return nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+
+	*i = lenientInt(n)
+	return nil
+}
+
+// unknownFields returns the members of the JSON object in data which don't map to a field of the struct v, or nil if
+// there are none.  Names are compared case-insensitively, the same as encoding/json does when decoding.
+func unknownFields(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	m := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	for k := range m {
+		if known[strings.ToLower(k)] {
+			delete(m, k)
+		}
+	}
+
+	if len(m) < 1 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// jsonFieldNames returns the lower-cased JSON names of the fields of struct type t, including promoted fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && len(name) < 1 {
+			for k := range jsonFieldNames(f.Type) {
+				names[k] = true
+			}
+			continue
+		}
+
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+
+		if len(name) < 1 {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+
+	return names
+}
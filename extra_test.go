@@ -0,0 +1,148 @@
+package iarapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeWithExtra(t *testing.T) {
+	data := `{"memberId": 1, "FIRSTNAME": "Test", "badgeNumber": "B-12", "certifications": ["EMT", "FF1"]}`
+
+	mi := new(MemberInfo)
+	if err := json.Unmarshal([]byte(data), mi); err != nil {
+		t.Fatal(err)
+	}
+
+	if mi.Id != 1 || mi.FirstName != "Test" {
+		t.Errorf("mapped fields not decoded: %+v", mi)
+	}
+
+	want := map[string]json.RawMessage{
+		"badgeNumber":    json.RawMessage(`"B-12"`),
+		"certifications": json.RawMessage(`["EMT", "FF1"]`),
+	}
+	if !reflect.DeepEqual(mi.Extra, want) {
+		t.Errorf("Extra = %v, want %v", mi.Extra, want)
+	}
+
+	// decoding again into the same value must not keep stale extra fields
+	if err := json.Unmarshal([]byte(`{"memberId": 2}`), mi); err != nil {
+		t.Fatal(err)
+	}
+
+	if mi.Extra != nil {
+		t.Errorf("Extra = %v, want nil", mi.Extra)
+	}
+}
+
+func TestEncodeWithExtra(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{
+			name: "extra fields",
+			v: &Hydrant{Id: 1, Extra: map[string]json.RawMessage{"pressure": json.RawMessage(`{"psi": 60}`),
+				"flow": json.RawMessage(`1000`)}},
+			want: `"flow":1000,"pressure":{"psi":60}}`,
+		},
+		{
+			name: "mapped fields win",
+			v:    Message{Id: "m1", Extra: map[string]json.RawMessage{"ID": json.RawMessage(`"other"`)}},
+			want: `"createdDate":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name: "nested",
+			v:    IncidentList{{Id: 1, Extra: map[string]json.RawMessage{"priority": json.RawMessage(`"high"`)}}},
+			want: `"priority":"high"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(data); !strings.HasSuffix(got, tt.want) {
+				t.Errorf("json.Marshal() = %s, want it to end %s", got, tt.want)
+			}
+		})
+	}
+
+	// extra fields survive a round trip
+	data := `{"memberId":1,"firstName":"Test","badgeNumber":"B-12"}`
+	mi := new(MemberInfo)
+	if err := json.Unmarshal([]byte(data), mi); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again := new(MemberInfo)
+	if err = json.Unmarshal(out, again); err != nil {
+		t.Fatal(err)
+	}
+
+	if again.FirstName != mi.FirstName || !reflect.DeepEqual(again.Extra, mi.Extra) {
+		t.Errorf("round trip Extra = %v, want %v", again.Extra, mi.Extra)
+	}
+}
+
+func TestFindSchemaDrift(t *testing.T) {
+	data := `{
+		"responseCodes": [{"id": 1, "color": "red"}, {"id": 2, "icon": "truck"}],
+		"telephoneKeys": [{"id": 3}],
+		"version": 2
+	}`
+
+	rc := new(ResponderCodes)
+	if err := json.Unmarshal([]byte(data), rc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*SchemaDrift{
+		{Type: "ResponderCode", Fields: []string{"color", "icon"}},
+		{Type: "ResponderCodes", Fields: []string{"version"}},
+	}
+
+	if got := FindSchemaDrift(rc); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSchemaDrift() = %v, want %v", got, want)
+	}
+
+	if got := FindSchemaDrift(&responseCodesGood); len(got) != 0 {
+		t.Errorf("FindSchemaDrift() = %v, want empty", got)
+	}
+}
+
+func TestClient_SchemaDriftHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id": "1", "message": "hello", "priority": "high"}]`))
+	}))
+	defer ts.Close()
+
+	var got []*SchemaDrift
+	c := &Client{httpClient: *ts.Client()}
+	WithSchemaDriftHandler(func(d *SchemaDrift) { got = append(got, d) })(c)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/MessageList", http.NoBody)
+	ml := new(MessageList)
+	if err := c.doApiRequest(req, ml); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*SchemaDrift{{Endpoint: "/MessageList", Type: "Message", Fields: []string{"priority"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("drift = %v, want %v", got, want)
+	}
+}
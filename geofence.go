@@ -0,0 +1,59 @@
+package iarapi
+
+import "math"
+
+// mean earth radius, in meters
+const earthRadius = 6371008.8
+
+// DistanceTo returns the great circle distance, in meters, between the coordinates
+func (c Coordinates) DistanceTo(o Coordinates) float64 {
+	lat1 := c.Lat * math.Pi / 180
+	lat2 := o.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (o.Lng - c.Lng) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Contains reports whether the coordinates are inside the geofence.  Circle geofences use the great circle distance
+// from the center, and polygon geofences use an even-odd ray cast treating latitude and longitude as planar, which is
+// accurate enough at the scale of a station or first due area.  Points on a polygon edge may report either way.
+func (g *Geofence) Contains(p Coordinates) bool {
+	switch g.Shape {
+	case GeofenceCircle:
+		return g.Center.DistanceTo(p) <= g.Radius
+	case GeofencePolygon:
+		return polygonContains(g.Points, p)
+	}
+	return false
+}
+
+// Containing returns the geofences which contain the coordinates
+func (l GeofenceList) Containing(p Coordinates) GeofenceList {
+	gl := make(GeofenceList, 0)
+	for _, g := range l {
+		if g.Contains(p) {
+			gl = append(gl, g)
+		}
+	}
+	return gl
+}
+
+func polygonContains(points []Coordinates, p Coordinates) bool {
+	if len(points) < 3 {
+		return false
+	}
+
+	inside := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, b := points[i], points[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) {
+			x := (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat) + a.Lng
+			if p.Lng < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
@@ -0,0 +1,59 @@
+package iarapi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoordinates_DistanceTo(t *testing.T) {
+	// one degree of latitude is roughly 111.2 km
+	d := Coordinates{Lat: 40, Lng: -75}.DistanceTo(Coordinates{Lat: 41, Lng: -75})
+	if math.Abs(d-111195) > 100 {
+		t.Errorf("DistanceTo() = %f, want ~111195", d)
+	}
+}
+
+func TestGeofence_Contains(t *testing.T) {
+	square := &Geofence{
+		Shape: GeofencePolygon,
+		Points: []Coordinates{
+			{Lat: 40.0, Lng: -75.0},
+			{Lat: 40.0, Lng: -74.9},
+			{Lat: 40.1, Lng: -74.9},
+			{Lat: 40.1, Lng: -75.0},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		fence *Geofence
+		point Coordinates
+		want  bool
+	}{
+		{name: "circle inside", fence: &geofenceGood, point: Coordinates{Lat: 40.001, Lng: -75.0}, want: true},
+		{name: "circle outside", fence: &geofenceGood, point: Coordinates{Lat: 40.002, Lng: -75.0}},
+		{name: "polygon inside", fence: square, point: Coordinates{Lat: 40.05, Lng: -74.95}, want: true},
+		{name: "polygon outside", fence: square, point: Coordinates{Lat: 40.05, Lng: -74.85}},
+		{name: "degenerate polygon", fence: &Geofence{Shape: GeofencePolygon, Points: square.Points[:2]}, point: Coordinates{Lat: 40.05, Lng: -74.95}},
+		{name: "unknown shape", fence: &Geofence{Center: geofenceGood.Center, Radius: 1000}, point: geofenceGood.Center},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fence.Contains(tt.point); got != tt.want {
+				t.Errorf("Geofence.Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeofenceList_Containing(t *testing.T) {
+	got := geofenceListGood.Containing(geofenceGood.Center)
+	if len(got) != 1 || got[0] != &geofenceGood {
+		t.Errorf("Containing() = %v, want %v", got, geofenceListGood)
+	}
+
+	if got = geofenceListGood.Containing(Coordinates{}); len(got) != 0 {
+		t.Errorf("Containing() = %v, want empty", got)
+	}
+}
@@ -0,0 +1,95 @@
+package iarapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// GeoJSON (RFC 7946) types used when importing and exporting map layers.  Feature properties are kept as raw JSON
+// so the values of a layer item survive a round trip without loss of type information.
+
+type GeoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                     `json:"type"`
+	Geometry   *GeoJSONGeometry           `json:"geometry"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []*GeoJSONFeature `json:"features"`
+}
+
+// GeoJSON positions are ordered longitude, latitude
+func pointGeometry(c Coordinates) *GeoJSONGeometry {
+	data, _ := json.Marshal([]float64{c.Lng, c.Lat})
+	return &GeoJSONGeometry{Type: "Point", Coordinates: data}
+}
+
+func (g *GeoJSONGeometry) point() (Coordinates, error) {
+	if g == nil || g.Type != "Point" {
+		return Coordinates{}, fmt.Errorf("expected Point geometry")
+	}
+
+	var pos []float64
+	if err := json.Unmarshal(g.Coordinates, &pos); err != nil {
+		return Coordinates{}, err
+	}
+
+	if len(pos) < 2 {
+		return Coordinates{}, fmt.Errorf("invalid Point coordinates")
+	}
+	return Coordinates{Lat: pos[1], Lng: pos[0]}, nil
+}
+
+// newFeature builds a Feature using the JSON representation of v, less the location field, as the feature properties
+func newFeature(v interface{}, geom *GeoJSONGeometry) (*GeoJSONFeature, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(data, &props); err != nil {
+		return nil, err
+	}
+	delete(props, "location")
+
+	return &GeoJSONFeature{Type: "Feature", Geometry: geom, Properties: props}, nil
+}
+
+// decodeProperties populates v with the values found in the feature properties
+func (f *GeoJSONFeature) decodeProperties(v interface{}) error {
+	data, err := json.Marshal(f.Properties)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeFeatureCollection(w io.Writer, features []*GeoJSONFeature) error {
+	if features == nil {
+		features = []*GeoJSONFeature{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
+
+func readFeatureCollection(r io.Reader) (*GeoJSONFeatureCollection, error) {
+	fc := new(GeoJSONFeatureCollection)
+	if err := json.NewDecoder(r).Decode(fc); err != nil {
+		return nil, err
+	}
+
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("unsupported GeoJSON type %q", fc.Type)
+	}
+	return fc, nil
+}
@@ -0,0 +1,221 @@
+package iarapi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var hydrantCsvHeader = []string{"id", "name", "address", "lat", "lng", "type", "color", "flowRate", "staticPressure",
+	"residualPressure", "outOfService", "lastTested", "notes"}
+
+// WriteGeoJSON writes the hydrants as a GeoJSON FeatureCollection of Point features
+func (l HydrantList) WriteGeoJSON(w io.Writer) error {
+	features := make([]*GeoJSONFeature, 0, len(l))
+	for _, h := range l {
+		f, err := newFeature(h, pointGeometry(h.Location))
+		if err != nil {
+			return err
+		}
+		features = append(features, f)
+	}
+
+	return writeFeatureCollection(w, features)
+}
+
+// ReadHydrantGeoJSON reads hydrants from a GeoJSON FeatureCollection of Point features.  Feature properties are
+// matched to the Hydrant JSON field names, the location is taken from the feature geometry.
+func ReadHydrantGeoJSON(r io.Reader) (HydrantList, error) {
+	fc, err := readFeatureCollection(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hl := make(HydrantList, 0, len(fc.Features))
+	for i, f := range fc.Features {
+		h := new(Hydrant)
+		if err = f.decodeProperties(h); err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+
+		if h.Location, err = f.Geometry.point(); err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+		hl = append(hl, h)
+	}
+
+	return hl, nil
+}
+
+// WriteCSV writes the hydrants as CSV, with a header row
+func (l HydrantList) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(hydrantCsvHeader); err != nil {
+		return err
+	}
+
+	for _, h := range l {
+		var tested string
+		if !h.LastTested.IsZero() {
+			tested = h.LastTested.Format(time.RFC3339)
+		}
+
+		rec := []string{
+			strconv.Itoa(h.Id),
+			h.Name,
+			h.Address,
+			strconv.FormatFloat(h.Location.Lat, 'f', -1, 64),
+			strconv.FormatFloat(h.Location.Lng, 'f', -1, 64),
+			h.Type,
+			h.Color,
+			strconv.Itoa(h.FlowRate),
+			strconv.FormatFloat(h.StaticPressure, 'f', -1, 64),
+			strconv.FormatFloat(h.ResidualPressure, 'f', -1, 64),
+			strconv.FormatBool(h.OutOfService),
+			tested,
+			h.Notes,
+		}
+
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadHydrantCSV reads hydrants from CSV data.  The first row must be a header using the column names written by
+// WriteCSV (matched case-insensitively), however only the columns of interest need to be present.  Missing and empty
+// columns are left as zero values, use MergeHydrantCSV to apply partial data to existing hydrants.
+func ReadHydrantCSV(r io.Reader) (HydrantList, error) {
+	return readHydrantCsv(r, func(int) (*Hydrant, error) { return new(Hydrant), nil })
+}
+
+// MergeHydrantCSV reads CSV data like ReadHydrantCSV, applying each row to a copy of the hydrant in existing with the
+// same id, so that the missing and empty columns keep their current values.  This allows things like flow test results
+// keyed by hydrant id to be sent back with UpdateHydrant.  Every row must have the id of an existing hydrant.
+func MergeHydrantCSV(r io.Reader, existing HydrantList) (HydrantList, error) {
+	byId := make(map[int]*Hydrant, len(existing))
+	for _, h := range existing {
+		byId[h.Id] = h
+	}
+
+	return readHydrantCsv(r, func(id int) (*Hydrant, error) {
+		cur, ok := byId[id]
+		if !ok {
+			return nil, fmt.Errorf("hydrant %d not found", id)
+		}
+
+		h := *cur
+		return &h, nil
+	})
+}
+
+// readHydrantCsv reads the CSV rows, applying each to the hydrant returned by base for the row's id
+func readHydrantCsv(r io.Reader, base func(id int) (*Hydrant, error)) (HydrantList, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	hl := make(HydrantList, 0)
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		h, err := hydrantFromCsv(cols, rec, base)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		hl = append(hl, h)
+	}
+
+	return hl, nil
+}
+
+func hydrantFromCsv(cols map[string]int, rec []string, base func(id int) (*Hydrant, error)) (*Hydrant, error) {
+	var id int
+	if i, ok := cols["id"]; ok && i < len(rec) && len(strings.TrimSpace(rec[i])) > 0 {
+		var err error
+		if id, err = strconv.Atoi(strings.TrimSpace(rec[i])); err != nil {
+			return nil, fmt.Errorf("column id: %v", err)
+		}
+	}
+
+	h, err := base(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range hydrantCsvHeader {
+		i, ok := cols[strings.ToLower(name)]
+		if !ok || i >= len(rec) {
+			continue
+		}
+
+		val := strings.TrimSpace(rec[i])
+		if len(val) < 1 {
+			continue
+		}
+
+		var err error
+		switch name {
+		case "id":
+			h.Id, err = strconv.Atoi(val)
+		case "name":
+			h.Name = val
+		case "address":
+			h.Address = val
+		case "lat":
+			h.Location.Lat, err = strconv.ParseFloat(val, 64)
+		case "lng":
+			h.Location.Lng, err = strconv.ParseFloat(val, 64)
+		case "type":
+			h.Type = val
+		case "color":
+			h.Color = val
+		case "flowRate":
+			h.FlowRate, err = strconv.Atoi(val)
+		case "staticPressure":
+			h.StaticPressure, err = strconv.ParseFloat(val, 64)
+		case "residualPressure":
+			h.ResidualPressure, err = strconv.ParseFloat(val, 64)
+		case "outOfService":
+			h.OutOfService, err = strconv.ParseBool(val)
+		case "lastTested":
+			h.LastTested, err = parseCsvTime(val)
+		case "notes":
+			h.Notes = val
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", name, err)
+		}
+	}
+
+	return h, nil
+}
+
+// parseCsvTime accepts either a full RFC 3339 timestamp, or a plain date as commonly found in spreadsheets
+func parseCsvTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", val)
+}
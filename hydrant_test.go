@@ -0,0 +1,122 @@
+package iarapi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHydrantList_GeoJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := hydrantListGood.WriteGeoJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `"coordinates": [`) {
+		t.Errorf("missing point coordinates in %s", buf.String())
+	}
+
+	got, err := ReadHydrantGeoJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, hydrantListGood) {
+		t.Errorf("ReadHydrantGeoJSON() = %v, want %v", got, hydrantListGood)
+	}
+}
+
+func TestReadHydrantGeoJSON_Bad(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not json", data: "hydrants"},
+		{name: "not collection", data: `{"type": "Feature"}`},
+		{name: "not point", data: `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[1, 2], [3, 4]]}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadHydrantGeoJSON(strings.NewReader(tt.data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestHydrantList_CSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := hydrantListGood.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadHydrantCSV(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subscriber id is not part of the CSV data
+	want := hydrantGood
+	want.SubscriberId = 0
+
+	if !reflect.DeepEqual(got, HydrantList{&want}) {
+		t.Errorf("ReadHydrantCSV() = %+v, want %+v", got[0], want)
+	}
+}
+
+func TestReadHydrantCSV_Partial(t *testing.T) {
+	data := "ID, FlowRate, LastTested\n2001, 1250, 2022-07-04\n2002,,\n"
+
+	got, err := ReadHydrantCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d hydrants, want 2", len(got))
+	}
+
+	if got[0].Id != 2001 || got[0].FlowRate != 1250 || got[0].LastTested.Format("2006-01-02") != "2022-07-04" {
+		t.Errorf("unexpected hydrant %+v", got[0])
+	}
+
+	if got[1].Id != 2002 || got[1].FlowRate != 0 {
+		t.Errorf("unexpected hydrant %+v", got[1])
+	}
+
+	if _, err = ReadHydrantCSV(strings.NewReader("id,flowRate\nx,1\n")); err == nil {
+		t.Error("expected error for invalid id")
+	}
+}
+
+func TestMergeHydrantCSV(t *testing.T) {
+	existing := HydrantList{
+		{Id: 2001, Name: "H-1", Address: "100 MAIN ST", Location: Coordinates{Lat: 40.1, Lng: -75.1}, FlowRate: 900},
+		{Id: 2002, Name: "H-2", Address: "200 MAIN ST", Location: Coordinates{Lat: 40.2, Lng: -75.2}, FlowRate: 1000},
+	}
+	data := "ID, FlowRate, LastTested\n2001, 1250, 2022-07-04\n2002,,\n"
+
+	got, err := MergeHydrantCSV(strings.NewReader(data), existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want0 := *existing[0]
+	want0.FlowRate = 1250
+	want0.LastTested = time.Date(2022, 7, 4, 0, 0, 0, 0, time.UTC)
+
+	if !reflect.DeepEqual(got, HydrantList{&want0, existing[1]}) {
+		t.Errorf("MergeHydrantCSV() = %+v, %+v", got[0], got[1])
+	}
+
+	if existing[0].FlowRate != 900 {
+		t.Error("existing hydrant was modified")
+	}
+
+	if _, err = MergeHydrantCSV(strings.NewReader("id,flowRate\n3001,1\n"), existing); err == nil {
+		t.Error("expected error for unknown hydrant")
+	}
+}
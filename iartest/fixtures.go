@@ -0,0 +1,125 @@
+package iartest
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	SubscriberId = 654321
+	MemberId     = 123456
+)
+
+// DefaultFixtures returns a small, self-consistent data set for a single agency with one member, a recent incident,
+// and one responder on the board.  Each call returns new values, which are safe to modify.
+func DefaultFixtures() Fixtures {
+	now := time.Now().UTC().Truncate(time.Second)
+	arrived := now.Add(-5 * time.Minute)
+
+	return Fixtures{
+		Subscriber: &iarapi.SubscriberInfo{
+			Id:            SubscriberId,
+			StatusID:      1,
+			Name:          "Test Fire Company",
+			AssignedPhone: "555-0100",
+			City:          "Anytown",
+			State:         "PA",
+			Country:       "US",
+			IsActive:      true,
+		},
+		Member: &iarapi.MemberInfo{
+			Id:                                 MemberId,
+			SubscriberId:                       SubscriberId,
+			FirstName:                          "Test",
+			LastName:                           "User",
+			Position:                           "Firefighter",
+			PermittedToVerifyIncidentAddresses: true,
+			AllowManageHydrants:                true,
+			AllowManageMarkers:                 true,
+			CanManageEvents:                    true,
+			DeviceToken:                        json.RawMessage(`null`),
+		},
+		Incidents: iarapi.IncidentList{
+			{
+				Id:                    1000001,
+				SubscriberId:          SubscriberId,
+				ArrivedOn:             arrived.Format("2006-01-02T15:04:05"),
+				MessageBody:           "STRUCTURE FIRE 100 MAIN ST ANYTOWN",
+				Address:               "100 MAIN ST",
+				VerifiedAddressStatus: iarapi.AddressNotVerified,
+				Direction:             json.RawMessage(`null`),
+				AddedBy:               json.RawMessage(`null`),
+				LastUpdatedBy:         json.RawMessage(`null`),
+				UpdatedOn:             arrived.Format("2006-01-02T15:04:05"),
+			},
+		},
+		Messages: iarapi.MessageList{
+			{
+				Id:           "msg-1",
+				MessageId:    2000001,
+				SubscriberId: SubscriberId,
+				Message:      "Monthly meeting Tuesday 1930",
+				CreatedDate:  now.Add(-24 * time.Hour),
+			},
+		},
+		Dispatchers: &iarapi.Dispatchers{
+			SubscriberId: SubscriberId,
+			Dispatchers:  []*iarapi.Dispatcher{{CentralizedId: 1, DispatcherId: 10, DispatcherName: "County 911"}},
+		},
+		ResponderCodes: &iarapi.ResponderCodes{
+			ResponseCodes: []*iarapi.ResponderCode{
+				{Id: 1, SubscriberId: SubscriberId, KeyEntry: "Station", IsDefaultKey: true, CustomSortOrder: 1},
+				{Id: 2, SubscriberId: SubscriberId, KeyEntry: "Scene", CustomSortOrder: 2},
+				{Id: 3, SubscriberId: SubscriberId, KeyEntry: "Not Responding", CustomSortOrder: 3},
+			},
+			TelephoneKeys: []*iarapi.ResponderCode{
+				{Id: 11, SubscriberId: SubscriberId, KeyEntry: "1", IsTelephoneKey: true, IsDefaultKey: true},
+			},
+		},
+		OnDutyAtCodes: iarapi.OnDutyAtCodeList{
+			{Id: "od-1", SubscriberId: SubscriberId, KeyEntry: "Station 1"},
+		},
+		Responders: iarapi.ResponderList{
+			{
+				Id:             "r-1",
+				Name:           "Test User",
+				LastName:       "User",
+				Position:       "Firefighter",
+				RespondingTo:   "Station",
+				CalledAt:       arrived.Add(time.Minute),
+				EtaBefore:      arrived.Add(8 * time.Minute),
+				SubscriberName: "Test Fire Company",
+				SubscriberId:   SubscriberId,
+				Order:          1,
+				MemberId:       MemberId,
+				Expired:        arrived.Add(time.Hour),
+				ResponseCodeId: 1,
+			},
+		},
+		Apparatus: iarapi.ApparatusList{
+			{Id: 1, SubscriberId: SubscriberId, Name: "Engine 1", Type: "Engine", Status: iarapi.ApparatusInService},
+		},
+		Hydrants: iarapi.HydrantList{
+			{Id: 1, SubscriberId: SubscriberId, Name: "H-1", Location: iarapi.Coordinates{Lat: 40.0, Lng: -75.0}, FlowRate: 1000},
+		},
+		Markers:   iarapi.MarkerList{},
+		Geofences: iarapi.GeofenceList{},
+		Events:    iarapi.EventList{},
+	}
+}
+
+func (f Fixtures) copy() Fixtures {
+	c := f
+	c.Incidents = append(iarapi.IncidentList(nil), f.Incidents...)
+	c.Messages = append(iarapi.MessageList(nil), f.Messages...)
+	c.OnDutyAtCodes = append(iarapi.OnDutyAtCodeList(nil), f.OnDutyAtCodes...)
+	c.Responders = append(iarapi.ResponderList(nil), f.Responders...)
+	c.Apparatus = append(iarapi.ApparatusList(nil), f.Apparatus...)
+	c.Hydrants = append(iarapi.HydrantList(nil), f.Hydrants...)
+	c.Markers = append(iarapi.MarkerList(nil), f.Markers...)
+	c.Geofences = append(iarapi.GeofenceList(nil), f.Geofences...)
+	c.Events = append(iarapi.EventList(nil), f.Events...)
+	return c
+}
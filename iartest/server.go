@@ -0,0 +1,642 @@
+// Package iartest provides a fake IamResponding service for testing code which uses the iarapi Client.
+//
+// The server implements the login page and form login flow used by iarapi.NewClient, tracks sessions with cookies,
+// and serves the API endpoints from a set of fixtures which may be changed while the server is running.  Faults can
+// be injected for any path to exercise error handling.
+//
+//	s := iartest.NewServer()
+//	defer s.Close()
+//
+//	c, err := s.NewClient()
+package iartest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	DefaultAgency   = "testagency"
+	DefaultUsername = "testuser"
+	DefaultPassword = "testpassword"
+
+	LoginPath          = "/login/member"
+	DashboardLoginPath = "/system/login"
+	ApiPath            = "/api"
+
+	sessionCookie = "iartest_session"
+)
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>IamResponding Login</title></head>
+<body>
+<form class="iar-form__form" method="post" action="` + LoginPath + `">
+  <input name="__RequestVerificationToken" type="hidden" value="{{ .Token }}">
+  <input name="Input.Agency" type="text">
+  <input name="Input.Username" type="text">
+  <input name="Input.Password" type="password">
+  <input name="Input.RememberLogin" type="hidden" value="false">
+  <input name="Input.ReturnUrl" type="hidden" value="">
+  <button name="Input.button" value="login">Login</button>
+  {{- if .Error }}
+  <div class="validation-summary-errors"><ul><li>{{ .Error }}</li></ul></div>
+  {{- end }}
+</form>
+</body>
+</html>
+`))
+
+// Fixtures is the data served by the API endpoints.  Items created through the API are assigned an Id if they
+// don't have one.
+type Fixtures struct {
+	Subscriber     *iarapi.SubscriberInfo
+	Member         *iarapi.MemberInfo
+	Incidents      iarapi.IncidentList
+	Messages       iarapi.MessageList
+	Dispatchers    *iarapi.Dispatchers
+	ResponderCodes *iarapi.ResponderCodes
+	OnDutyAtCodes  iarapi.OnDutyAtCodeList
+	Responders     iarapi.ResponderList
+	Apparatus      iarapi.ApparatusList
+	Hydrants       iarapi.HydrantList
+	Markers        iarapi.MarkerList
+	Geofences      iarapi.GeofenceList
+	Events         iarapi.EventList
+}
+
+// Fault describes how to fail requests for a path.  A Status of 0 only applies the Delay, and Body replaces the
+// default status text.  Count limits the fault to that many requests, 0 applies it to every request.
+type Fault struct {
+	Status int
+	Body   string
+	Delay  time.Duration
+	Count  int
+}
+
+type Server struct {
+	*httptest.Server
+
+	Agency   string
+	Username string
+	Password string
+
+	mu       sync.Mutex
+	fixtures Fixtures
+	faults   map[string]*Fault
+	tokens   map[string]bool
+	sessions map[string]bool
+	requests map[string]int
+	nextId   int
+}
+
+// NewServer starts a server using the default credentials and fixtures.  The caller should Close the server when done.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server which isn't listening yet, so the credentials or fixtures may be changed
+// before calling Start or StartTLS
+func NewUnstartedServer() *Server {
+	s := &Server{
+		Agency:   DefaultAgency,
+		Username: DefaultUsername,
+		Password: DefaultPassword,
+		fixtures: DefaultFixtures(),
+		faults:   make(map[string]*Fault),
+		tokens:   make(map[string]bool),
+		sessions: make(map[string]bool),
+		requests: make(map[string]int),
+		nextId:   100000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(LoginPath, s.loginHandler)
+	mux.HandleFunc(DashboardLoginPath, s.dashboardHandler)
+	mux.HandleFunc(ApiPath+"/", s.apiHandler)
+
+	s.Server = httptest.NewUnstartedServer(s.faultHandler(mux))
+	return s
+}
+
+// ClientOptions returns the options needed for an iarapi.Client to use this server
+func (s *Server) ClientOptions() []iarapi.ClientOption {
+	return []iarapi.ClientOption{
+		iarapi.WithHTTPClient(s.Client()),
+		iarapi.WithEndpoints(s.URL+LoginPath, s.URL, s.URL+ApiPath),
+	}
+}
+
+// NewClient returns a Client logged in to the server with the configured credentials.  Additional options are
+// applied after those returned by ClientOptions.
+func (s *Server) NewClient(opts ...iarapi.ClientOption) (*iarapi.Client, error) {
+	return iarapi.NewClient(s.Agency, s.Username, s.Password, append(s.ClientOptions(), opts...)...)
+}
+
+// Fixtures returns a copy of the current fixtures.  The lists are copied, the items they point to are not.
+func (s *Server) Fixtures() Fixtures {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fixtures.copy()
+}
+
+// SetFixtures replaces all fixtures
+func (s *Server) SetFixtures(f Fixtures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = f.copy()
+}
+
+// Update calls f with the fixtures while holding the server lock, so they can be changed safely while the server
+// is handling requests, for example to add an incident or change the responder board
+func (s *Server) Update(f func(*Fixtures)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.fixtures)
+}
+
+// InjectFault applies the fault to requests for path, which is the full URL path on the server (API endpoints are
+// under ApiPath, like "/api/Member")
+func (s *Server) InjectFault(path string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[path] = &f
+}
+
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+}
+
+// ExpireSessions logs out every client, so the next API request from each gets a 401 status and must log in again
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]bool)
+}
+
+// Requests returns the number of requests received for path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) faultHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+
+		var f Fault
+		if cur, ok := s.faults[r.URL.Path]; ok {
+			f = *cur
+			if cur.Count > 0 {
+				if cur.Count--; cur.Count < 1 {
+					delete(s.faults, r.URL.Path)
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if f.Status > 0 {
+			body := f.Body
+			if len(body) < 1 {
+				body = http.StatusText(f.Status)
+			}
+			http.Error(w, body, f.Status)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderLogin(w, "")
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f := r.PostForm
+
+		s.mu.Lock()
+		tokenOk := s.tokens[f.Get("__RequestVerificationToken")]
+		delete(s.tokens, f.Get("__RequestVerificationToken"))
+		s.mu.Unlock()
+
+		if !tokenOk {
+			http.Error(w, "invalid request verification token", http.StatusBadRequest)
+			return
+		}
+
+		if !strings.EqualFold(f.Get("Input.Agency"), s.Agency) || f.Get("Input.Username") != s.Username ||
+			f.Get("Input.Password") != s.Password {
+			s.renderLogin(w, "Invalid agency, username or password")
+			return
+		}
+
+		id := randomId()
+		s.mu.Lock()
+		s.sessions[id] = true
+		s.mu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", HttpOnly: true})
+		http.Redirect(w, r, DashboardLoginPath+"?returnUrl=/", http.StatusFound)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, msg string) {
+	token := randomId()
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(w, struct{ Token, Error string }{token, msg})
+}
+
+func (s *Server) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		http.Redirect(w, r, LoginPath, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte("<html><body>dashboard</body></html>"))
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[c.Value]
+}
+
+func (s *Server) apiHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("X-CSRF") != "1" {
+		http.Error(w, "missing X-CSRF header", http.StatusBadRequest)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, ApiPath)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := &s.fixtures
+
+	if r.Method == http.MethodGet && len(parts) < 3 {
+		// unset pointer fixtures are left as a nil interface, so they're not found rather than null
+		var v interface{}
+		switch path {
+		case "/Subscriber":
+			if f.Subscriber != nil {
+				v = f.Subscriber
+			}
+		case "/Member":
+			if f.Member != nil {
+				v = f.Member
+			}
+		case "/IncidentList":
+			v = f.Incidents
+		case "/MessageList":
+			v = f.Messages
+		case "/DispatcherContent/AssociatedDispatchers":
+			if f.Dispatchers != nil {
+				v = f.Dispatchers
+			}
+		case "/ResponderCodes":
+			if f.ResponderCodes != nil {
+				v = f.ResponderCodes
+			}
+		case "/OnDutyAtCodes":
+			v = f.OnDutyAtCodes
+		case "/ResponderList":
+			v = f.Responders
+		case "/ApparatusList":
+			v = f.Apparatus
+		}
+
+		if v != nil {
+			writeJSON(w, http.StatusOK, v)
+			return
+		}
+	}
+
+	switch {
+	case path == "/SearchIncidents" && r.Method == http.MethodPost:
+		s.searchIncidents(w, r)
+	case path == "/Respond" && r.Method == http.MethodPost:
+		s.respond(w, r)
+	case parts[0] == "Incident" && len(parts) == 3 && parts[2] == "VerifyAddress" && r.Method == http.MethodPost:
+		s.verifyAddress(w, r, parts[1])
+	case parts[0] == "Apparatus" && len(parts) == 3 && parts[2] == "Status" && r.Method == http.MethodPost:
+		s.apparatusStatus(w, r, parts[1])
+	case parts[0] == "Hydrants":
+		s.crud(w, r, &f.Hydrants, parts[1:])
+	case parts[0] == "Markers":
+		s.crud(w, r, &f.Markers, parts[1:])
+	case parts[0] == "Geofences":
+		s.crud(w, r, &f.Geofences, parts[1:])
+	case parts[0] == "Events":
+		s.crud(w, r, &f.Events, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) searchIncidents(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		Page      int    `json:"page"`
+		PageSize  int    `json:"pageSize"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		http.Error(w, "invalid startDate", http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		http.Error(w, "invalid endDate", http.StatusBadRequest)
+		return
+	}
+	end = end.AddDate(0, 0, 1)
+
+	// end date is inclusive
+	matches := make(iarapi.IncidentList, 0)
+	for _, inc := range s.fixtures.Incidents {
+		t, err := inc.ArrivedTime()
+		if err != nil {
+			continue
+		}
+
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if !day.Before(start) && day.Before(end) {
+			matches = append(matches, inc)
+		}
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	if req.PageSize < 1 {
+		req.PageSize = 100
+	}
+
+	lo := (req.Page - 1) * req.PageSize
+	if lo > len(matches) {
+		lo = len(matches)
+	}
+
+	hi := lo + req.PageSize
+	if hi > len(matches) {
+		hi = len(matches)
+	}
+
+	writeJSON(w, http.StatusOK, matches[lo:hi])
+}
+
+func (s *Server) verifyAddress(w http.ResponseWriter, r *http.Request, id string) {
+	v := new(iarapi.AddressVerification)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, inc := range s.fixtures.Incidents {
+		if strconv.Itoa(inc.Id) != id {
+			continue
+		}
+
+		inc.VerifiedStreetNumber = v.StreetNumber
+		inc.VerifiedStreetName = v.StreetName
+		inc.VerifiedCity = v.City
+		inc.VerifiedState = v.State
+		inc.VerifiedCountry = v.Country
+		inc.VerifiedAddressStatus = iarapi.AddressManuallyVerified
+		inc.IsVerifiedAndActive = true
+
+		writeJSON(w, http.StatusOK, inc)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// respond sets the member's board entry to the response code, adding an entry if the member has none
+func (s *Server) respond(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ResponseCodeId int `json:"responseCodeId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f := &s.fixtures
+	var code *iarapi.ResponderCode
+	if f.ResponderCodes != nil {
+		for _, c := range f.ResponderCodes.ResponseCodes {
+			if c.Id == body.ResponseCodeId {
+				code = c
+			}
+		}
+	}
+
+	if code == nil {
+		http.Error(w, "unknown response code", http.StatusBadRequest)
+		return
+	}
+
+	if f.Member == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var entry *iarapi.Responder
+	for _, resp := range f.Responders {
+		if resp.MemberId == f.Member.Id {
+			entry = resp
+		}
+	}
+
+	if entry == nil {
+		entry = &iarapi.Responder{
+			Id:           randomId(),
+			Name:         f.Member.FirstName + " " + f.Member.LastName,
+			LastName:     f.Member.LastName,
+			Position:     f.Member.Position,
+			SubscriberId: f.Member.SubscriberId,
+			MemberId:     f.Member.Id,
+		}
+		f.Responders = append(f.Responders, entry)
+	}
+
+	entry.RespondingTo = code.KeyEntry
+	entry.ResponseCodeId = code.Id
+	entry.CalledAt = time.Now().UTC().Truncate(time.Second)
+
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (s *Server) apparatusStatus(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Status iarapi.ApparatusStatus `json:"status"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, a := range s.fixtures.Apparatus {
+		if strconv.Itoa(a.Id) == id {
+			a.Status = body.Status
+			writeJSON(w, http.StatusOK, a)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// crud implements list, create, update and delete for a fixture list.  list is a pointer to a slice of pointers to
+// structs with an int Id field, like *iarapi.HydrantList.
+func (s *Server) crud(w http.ResponseWriter, r *http.Request, list interface{}, parts []string) {
+	lv := reflect.ValueOf(list).Elem()
+
+	if len(parts) < 1 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, lv.Interface())
+		case http.MethodPost:
+			item := reflect.New(lv.Type().Elem().Elem())
+			if err := json.NewDecoder(r.Body).Decode(item.Interface()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if id := item.Elem().FieldByName("Id"); id.Int() < 1 {
+				s.nextId++
+				id.SetInt(int64(s.nextId))
+			}
+
+			lv.Set(reflect.Append(lv, item))
+			writeJSON(w, http.StatusCreated, item.Interface())
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	idx := -1
+	for i := 0; i < lv.Len(); i++ {
+		if lv.Index(i).Elem().FieldByName("Id").Int() == int64(id) {
+			idx = i
+			break
+		}
+	}
+
+	if idx < 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, lv.Index(idx).Interface())
+	case http.MethodPut:
+		item := reflect.New(lv.Type().Elem().Elem())
+		if err = json.NewDecoder(r.Body).Decode(item.Interface()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		item.Elem().FieldByName("Id").SetInt(int64(id))
+		lv.Index(idx).Set(item)
+		writeJSON(w, http.StatusOK, item.Interface())
+	case http.MethodDelete:
+		lv.Set(reflect.AppendSlice(lv.Slice(0, idx), lv.Slice(idx+1, lv.Len())))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	// the service returns empty lists, not null
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		v = []struct{}{}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func randomId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("iartest: reading random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,321 @@
+package iartest
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+func TestServer_Login(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		agency   string
+		user     string
+		password string
+		wantErr  bool
+	}{
+		{name: "good", agency: DefaultAgency, user: DefaultUsername, password: DefaultPassword},
+		{name: "agency case", agency: strings.ToUpper(DefaultAgency), user: DefaultUsername, password: DefaultPassword},
+		{name: "bad agency", agency: "other", user: DefaultUsername, password: DefaultPassword, wantErr: true},
+		{name: "bad password", agency: DefaultAgency, user: DefaultUsername, password: "wrong", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := iarapi.NewClient(tt.agency, tt.user, tt.password, s.ClientOptions()...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr && !errors.Is(err, iarapi.ErrLoginFailed) {
+				t.Errorf("NewClient() error = %v, want ErrLoginFailed", err)
+			}
+		})
+	}
+}
+
+func TestServer_Endpoints(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.Fixtures()
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+		want interface{}
+	}{
+		{name: "Subscriber", call: func() (interface{}, error) { return c.Subscriber() }, want: f.Subscriber},
+		{name: "Member", call: func() (interface{}, error) { return c.Member() }, want: f.Member},
+		{name: "Incidents", call: func() (interface{}, error) { return c.Incidents() }, want: &f.Incidents},
+		{name: "Messages", call: func() (interface{}, error) { return c.Messages() }, want: &f.Messages},
+		{name: "Dispatchers", call: func() (interface{}, error) { return c.Dispatchers() }, want: f.Dispatchers},
+		{name: "ResponderCodes", call: func() (interface{}, error) { return c.ResponderCodes() }, want: f.ResponderCodes},
+		{name: "OnDutyAtCodes", call: func() (interface{}, error) { return c.OnDutyAtCodes() }, want: &f.OnDutyAtCodes},
+		{name: "ResponderList", call: func() (interface{}, error) { return c.ResponderList() }, want: &f.Responders},
+		{name: "ApparatusList", call: func() (interface{}, error) { return c.ApparatusList() }, want: &f.Apparatus},
+		{name: "Hydrants", call: func() (interface{}, error) { return c.Hydrants() }, want: &f.Hydrants},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_UnsetFixtures(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Update(func(f *Fixtures) {
+		f.Subscriber = nil
+		f.Member = nil
+		f.Dispatchers = nil
+		f.ResponderCodes = nil
+	})
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+	}{
+		{name: "Subscriber", call: func() (interface{}, error) { return c.Subscriber() }},
+		{name: "Member", call: func() (interface{}, error) { return c.Member() }},
+		{name: "Dispatchers", call: func() (interface{}, error) { return c.Dispatchers() }},
+		{name: "ResponderCodes", call: func() (interface{}, error) { return c.ResponderCodes() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.call(); err == nil || !strings.Contains(err.Error(), "404") {
+				t.Errorf("got %+v, error = %v, want 404", got, err)
+			}
+		})
+	}
+}
+
+func TestServer_SearchIncidents(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Update(func(f *Fixtures) {
+		f.Incidents = iarapi.IncidentList{
+			{Id: 1, ArrivedOn: "2022-10-01T10:00:00"},
+			{Id: 2, ArrivedOn: "2022-10-02T23:59:00"},
+			{Id: 3, ArrivedOn: "2022-10-03T00:01:00"},
+			{Id: 4, ArrivedOn: "2022-10-04T12:00:00"},
+		}
+	})
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isr := &iarapi.IncidentSearchRequest{
+		StartTime: time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2022, 10, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	il, err := c.SearchIncidents(isr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*il) != 2 || (*il)[0].Id != 2 || (*il)[1].Id != 3 {
+		t.Errorf("SearchIncidents() = %v, want ids 2 and 3", *il)
+	}
+
+	isr.PageSize = 1
+	isr.Page = 2
+	if il, err = c.SearchIncidents(isr); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*il) != 1 || (*il)[0].Id != 3 {
+		t.Errorf("SearchIncidents() page 2 = %v, want id 3", *il)
+	}
+}
+
+func TestServer_Respond(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Respond(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.MemberId != MemberId || r.RespondingTo != "Scene" || r.ResponseCodeId != 2 {
+		t.Errorf("Respond() = %+v, want member %d responding to Scene", r, MemberId)
+	}
+
+	if rl := s.Fixtures().Responders; len(rl) != 1 || rl[0].RespondingTo != "Scene" {
+		t.Errorf("responders = %v, want the existing entry updated", rl)
+	}
+
+	s.Update(func(f *Fixtures) {
+		f.Responders = nil
+	})
+
+	if _, err = c.Respond(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if rl := s.Fixtures().Responders; len(rl) != 1 || rl[0].MemberId != MemberId || rl[0].RespondingTo != "Station" {
+		t.Errorf("responders = %v, want a new entry for the member", rl)
+	}
+
+	if _, err = c.Respond(42); err == nil {
+		t.Error("Respond() with an unknown code did not fail")
+	}
+
+	s.Update(func(f *Fixtures) {
+		f.Member = nil
+	})
+
+	if _, err = c.Respond(1); err == nil {
+		t.Error("Respond() without a member did not fail")
+	}
+}
+
+func TestServer_Crud(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := c.CreateMarker(&iarapi.Marker{Name: "Knox Box", Category: "Access"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Id < 1 {
+		t.Fatalf("CreateMarker() did not assign an id")
+	}
+
+	m.Notes = "Key for side door"
+	if _, err = c.UpdateMarker(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Fixtures().Markers; len(got) != 1 || got[0].Notes != m.Notes {
+		t.Errorf("markers after update = %v", got)
+	}
+
+	if err = c.DeleteMarker(m.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Fixtures().Markers; len(got) != 0 {
+		t.Errorf("markers after delete = %v", got)
+	}
+
+	if err = c.DeleteMarker(m.Id); err == nil {
+		t.Error("expected error deleting unknown marker")
+	}
+
+	a, err := c.UpdateApparatusStatus(1, iarapi.ApparatusEnRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Status != iarapi.ApparatusEnRoute {
+		t.Errorf("apparatus status = %v, want EnRoute", a.Status)
+	}
+
+	inc, err := c.VerifyIncidentAddress(&iarapi.AddressVerification{IncidentId: 1000001, StreetNumber: "100", StreetName: "Main St"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inc.VerifiedAddressStatus != iarapi.AddressManuallyVerified || inc.VerifiedStreetName != "Main St" {
+		t.Errorf("verified incident = %+v", inc)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.InjectFault(ApiPath+"/Member", Fault{Status: http.StatusServiceUnavailable, Count: 1})
+	if _, err = c.Member(); err == nil {
+		t.Error("expected error from injected fault")
+	}
+
+	if _, err = c.Member(); err != nil {
+		t.Errorf("fault not cleared after count reached: %v", err)
+	}
+
+	if n := s.Requests(ApiPath + "/Member"); n != 2 {
+		t.Errorf("Requests() = %d, want 2", n)
+	}
+
+	s.InjectFault(LoginPath, Fault{Status: http.StatusInternalServerError})
+	if _, err = s.NewClient(); err == nil {
+		t.Error("expected login error from injected fault")
+	}
+	s.ClearFaults()
+
+	// the client logs in again when its session expires, and fails if it can't
+	s.ExpireSessions()
+	logins := s.Requests(LoginPath)
+	if _, err = c.Subscriber(); err != nil {
+		t.Errorf("Subscriber() after session expiry error = %v", err)
+	}
+
+	if s.Requests(LoginPath) <= logins {
+		t.Error("client did not log in again after session expiry")
+	}
+
+	// a request with a body is sent again in full
+	s.ExpireSessions()
+	isr := &iarapi.IncidentSearchRequest{StartTime: time.Now().AddDate(0, 0, -1), EndTime: time.Now(), Page: 1, PageSize: 10}
+	if _, err = c.SearchIncidents(isr); err != nil {
+		t.Errorf("SearchIncidents() after session expiry error = %v", err)
+	}
+
+	s.ExpireSessions()
+	s.InjectFault(LoginPath, Fault{Status: http.StatusInternalServerError})
+	if _, err = c.Subscriber(); err == nil || !strings.Contains(err.Error(), "session expired") {
+		t.Errorf("expected login error after session expiry, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package iarapi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	icsDateFmt     = "20060102"
+	icsDateTimeFmt = "20060102T150405Z"
+	icsLineLimit   = 75
+)
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// WriteICS writes the events as an RFC 5545 iCalendar object, suitable for serving as a calendar subscription.
+// Timed events are written in UTC, all day events as floating dates.  The calendar name is optional.
+func (l EventList) WriteICS(w io.Writer, name string) error {
+	bw := bufio.NewWriter(w)
+	lw := &icsWriter{w: bw}
+
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:-//mmmorris1975//iarapi//EN")
+	lw.line("CALSCALE:GREGORIAN")
+	lw.line("METHOD:PUBLISH")
+	if len(name) > 0 {
+		lw.line("X-WR-CALNAME:" + icsEscaper.Replace(name))
+	}
+
+	now := time.Now()
+	for _, e := range l {
+		e.writeICS(lw, now)
+	}
+
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+func (e *Event) writeICS(lw *icsWriter, now time.Time) {
+	stamp := e.UpdatedOn
+	if stamp.IsZero() {
+		stamp = now
+	}
+
+	lw.line("BEGIN:VEVENT")
+	lw.line(fmt.Sprintf("UID:event-%d-%d@iamresponding.com", e.SubscriberId, e.Id))
+	lw.line("DTSTAMP:" + stamp.UTC().Format(icsDateTimeFmt))
+
+	if e.AllDay {
+		// DTEND is exclusive for dates, a single day event ends the following day
+		end := e.End
+		if !end.After(e.Start) {
+			end = e.Start
+		}
+		end = end.AddDate(0, 0, 1)
+
+		lw.line("DTSTART;VALUE=DATE:" + e.Start.Format(icsDateFmt))
+		lw.line("DTEND;VALUE=DATE:" + end.Format(icsDateFmt))
+	} else {
+		lw.line("DTSTART:" + e.Start.UTC().Format(icsDateTimeFmt))
+		if e.End.After(e.Start) {
+			lw.line("DTEND:" + e.End.UTC().Format(icsDateTimeFmt))
+		}
+	}
+
+	lw.line("SUMMARY:" + icsEscaper.Replace(e.Title))
+	if len(e.Description) > 0 {
+		lw.line("DESCRIPTION:" + icsEscaper.Replace(e.Description))
+	}
+
+	if len(e.Location) > 0 {
+		lw.line("LOCATION:" + icsEscaper.Replace(e.Location))
+	}
+
+	if len(e.Category) > 0 {
+		lw.line("CATEGORIES:" + icsEscaper.Replace(e.Category))
+	}
+	lw.line("END:VEVENT")
+}
+
+// icsWriter writes CRLF terminated content lines, folding them at 75 octets without splitting a UTF-8 sequence
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (lw *icsWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+
+	limit := icsLineLimit
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+
+		lw.write(s[:i] + "\r\n ")
+		s = s[i:]
+
+		// continuation lines lose an octet to the leading space
+		limit = icsLineLimit - 1
+	}
+	lw.write(s + "\r\n")
+}
+
+func (lw *icsWriter) write(s string) {
+	if lw.err == nil {
+		_, lw.err = lw.w.WriteString(s)
+	}
+}
@@ -0,0 +1,81 @@
+package iarapi
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventList_WriteICS(t *testing.T) {
+	allDay := &Event{
+		Id:          5002,
+		Title:       "Open House; food, games",
+		Description: "Bring the kids\nAll welcome",
+		Start:       time.Date(2022, 10, 8, 0, 0, 0, 0, time.UTC),
+		AllDay:      true,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := (EventList{&eventGood, allDay}).WriteICS(buf, "Training"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Training\r\n",
+		"UID:event-654321-5001@iamresponding.com\r\n",
+		"DTSTAMP:20221101T120000Z\r\n",
+		"DTSTART:20221107T233000Z\r\n",
+		"DTEND:20221108T020000Z\r\n",
+		"CATEGORIES:Drill\r\n",
+		"DTSTART;VALUE=DATE:20221008\r\n",
+		"DTEND;VALUE=DATE:20221009\r\n",
+		`SUMMARY:Open House\; food\, games` + "\r\n",
+		`DESCRIPTION:Bring the kids\nAll welcome` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	if strings.Count(out, "BEGIN:VEVENT") != 2 {
+		t.Errorf("expected 2 events in\n%s", out)
+	}
+}
+
+func TestIcsWriter_Fold(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lw := &icsWriter{w: bufio.NewWriter(buf)}
+
+	long := "DESCRIPTION:" + strings.Repeat("é", 60)
+	lw.line(long)
+	_ = lw.w.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected folded line, got %q", buf.String())
+	}
+
+	var unfolded string
+	for i, l := range lines {
+		if len(l) > icsLineLimit {
+			t.Errorf("line %d is %d octets", i, len(l))
+		}
+
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Errorf("continuation line %d missing leading space", i)
+			}
+			l = l[1:]
+		}
+		unfolded += l
+	}
+
+	if unfolded != long {
+		t.Errorf("unfolded = %q, want %q", unfolded, long)
+	}
+}
@@ -0,0 +1,380 @@
+// Package live pushes the changes seen by an iarapi.Watcher to browsers, as a Server-Sent Events stream and over a
+// WebSocket, for station displays.
+//
+// Both endpoints send the same JSON frames.  A new connection first receives a snapshot of the incidents,
+// responders and messages, then a frame for each event, and a heartbeat frame when idle.  Event frames have increasing ids, and a
+// client reconnecting with the id of the last frame it received, in the Last-Event-ID header for SSE (which browsers
+// send automatically) or the lastEventId query parameter for the WebSocket, is sent the events it missed instead of
+// a snapshot, if they are still held in the feed's history.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// DefaultHeartbeat is the time between heartbeat frames
+	DefaultHeartbeat = 15 * time.Second
+
+	// DefaultHistory is the number of events kept for reconnecting clients
+	DefaultHistory = 256
+
+	// DefaultClientBuffer is the number of frames queued for a client before it is disconnected as too slow
+	DefaultClientBuffer = 64
+)
+
+// Frame types besides the watcher event types
+const (
+	FrameSnapshot  = "snapshot"
+	FrameHeartbeat = "heartbeat"
+)
+
+// Snapshot is the current state sent to new connections
+type Snapshot struct {
+	Incidents  iarapi.IncidentList  `json:"incidents"`
+	Responders iarapi.ResponderList `json:"responders"`
+	Messages   iarapi.MessageList   `json:"messages"`
+}
+
+// Frame is a message sent to clients.  Only the field matching the type is set.  A snapshot frame has the id of the
+// last event included in it.
+type Frame struct {
+	Id       uint64             `json:"id,omitempty"`
+	Type     string             `json:"type"`
+	Time     time.Time          `json:"time"`
+	Snapshot *Snapshot          `json:"snapshot,omitempty"`
+	Event    *iarapi.WatchEvent `json:"event,omitempty"`
+}
+
+type feedClient struct {
+	ch     chan *Frame
+	closed bool
+}
+
+// Feed tracks the watcher state and serves it to connected clients
+type Feed struct {
+	// Heartbeat is the time between heartbeat frames, DefaultHeartbeat if 0
+	Heartbeat time.Duration
+
+	// History is the number of events kept for reconnecting clients, DefaultHistory if 0
+	History int
+
+	// ClientBuffer is the number of frames queued for a client before it is disconnected, DefaultClientBuffer if 0.
+	// A disconnected client can reconnect and resume from its last event.
+	ClientBuffer int
+
+	mu         sync.Mutex
+	clients    map[*feedClient]bool
+	history    []*Frame
+	lastId     uint64
+	incidents  map[int]*iarapi.Incident
+	responders map[string]*iarapi.Responder
+	messages   map[string]*iarapi.Message
+	now        func() time.Time
+}
+
+func NewFeed() *Feed {
+	f := &Feed{
+		clients:    make(map[*feedClient]bool),
+		incidents:  make(map[int]*iarapi.Incident),
+		responders: make(map[string]*iarapi.Responder),
+		messages:   make(map[string]*iarapi.Message),
+		now:        time.Now,
+	}
+
+	// ids continue from the start time, so a client reconnecting after a restart is not sent the wrong events
+	f.lastId = uint64(f.now().UnixNano() / int64(time.Millisecond))
+	return f
+}
+
+// Run syncs the feed with the watcher's current state, then applies its events until ctx is done, when all clients
+// are disconnected.  The watcher must be run separately.
+func (f *Feed) Run(ctx context.Context, w *iarapi.Watcher) error {
+	ch, stop := w.Subscribe(16)
+	defer stop()
+	defer f.disconnectAll()
+
+	il, rl := w.Current()
+	f.Sync(il, rl, w.CurrentMessages())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-ch:
+			f.Handle(e)
+
+			// the watcher has no event for messages going away, so drop them from its list instead
+			if e.Type == iarapi.EventMessageAdded {
+				f.syncMessages(w.CurrentMessages())
+			}
+		}
+	}
+}
+
+// Sync replaces the feed state with the incidents, responders and messages.  Connected clients are not sent a new
+// snapshot.
+func (f *Feed) Sync(il iarapi.IncidentList, rl iarapi.ResponderList, ml iarapi.MessageList) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.incidents = make(map[int]*iarapi.Incident, len(il))
+	for _, inc := range il {
+		f.incidents[inc.Id] = inc
+	}
+
+	f.responders = make(map[string]*iarapi.Responder, len(rl))
+	for _, r := range rl {
+		f.responders[r.Id] = r
+	}
+
+	f.setMessages(ml)
+}
+
+func (f *Feed) syncMessages(ml iarapi.MessageList) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setMessages(ml)
+}
+
+// setMessages replaces the feed messages.  The caller must hold the lock.
+func (f *Feed) setMessages(ml iarapi.MessageList) {
+	f.messages = make(map[string]*iarapi.Message, len(ml))
+	for _, m := range ml {
+		f.messages[m.Id] = m
+	}
+}
+
+// Handle applies a watcher event to the feed state, and sends it to the connected clients
+func (f *Feed) Handle(e *iarapi.WatchEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch e.Type {
+	case iarapi.EventIncidentAdded, iarapi.EventIncidentUpdated:
+		f.incidents[e.Incident.Id] = e.Incident
+	case iarapi.EventResponderAdded, iarapi.EventResponderUpdated:
+		f.responders[e.Responder.Id] = e.Responder
+	case iarapi.EventResponderRemoved:
+		delete(f.responders, e.Responder.Id)
+	case iarapi.EventMessageAdded:
+		f.messages[e.Message.Id] = e.Message
+	}
+
+	f.lastId++
+	fr := &Frame{Id: f.lastId, Type: string(e.Type), Time: e.Time, Event: e}
+
+	f.history = append(f.history, fr)
+	if n := len(f.history) - f.historySize(); n > 0 {
+		f.history = append(f.history[:0:0], f.history[n:]...)
+	}
+
+	for c := range f.clients {
+		select {
+		case c.ch <- fr:
+		default:
+			f.disconnect(c)
+		}
+	}
+}
+
+// connect registers a client, returning it with the frames to send first: the events after lastEventId if they
+// are all in the history, otherwise a snapshot
+func (f *Feed) connect(lastEventId string) (*feedClient, []*Frame) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	size := f.ClientBuffer
+	if size <= 0 {
+		size = DefaultClientBuffer
+	}
+
+	c := &feedClient{ch: make(chan *Frame, size)}
+	f.clients[c] = true
+
+	if id, err := strconv.ParseUint(lastEventId, 10, 64); err == nil && id <= f.lastId {
+		missed := f.lastId - id
+		if missed == 0 {
+			return c, nil
+		}
+
+		if missed <= uint64(len(f.history)) {
+			return c, append([]*Frame(nil), f.history[uint64(len(f.history))-missed:]...)
+		}
+	}
+
+	return c, []*Frame{{Id: f.lastId, Type: FrameSnapshot, Time: f.now(), Snapshot: f.snapshot()}}
+}
+
+// snapshot returns the current state.  The caller must hold the lock.
+func (f *Feed) snapshot() *Snapshot {
+	s := &Snapshot{
+		Incidents:  make(iarapi.IncidentList, 0, len(f.incidents)),
+		Responders: make(iarapi.ResponderList, 0, len(f.responders)),
+		Messages:   make(iarapi.MessageList, 0, len(f.messages)),
+	}
+
+	for _, inc := range f.incidents {
+		s.Incidents = append(s.Incidents, inc)
+	}
+
+	for _, r := range f.responders {
+		s.Responders = append(s.Responders, r)
+	}
+
+	for _, m := range f.messages {
+		s.Messages = append(s.Messages, m)
+	}
+
+	sort.Slice(s.Incidents, func(i, j int) bool { return s.Incidents[i].Id < s.Incidents[j].Id })
+	sort.Slice(s.Responders, func(i, j int) bool { return s.Responders[i].Id < s.Responders[j].Id })
+	sort.Slice(s.Messages, func(i, j int) bool {
+		if s.Messages[i].CreatedDate.Equal(s.Messages[j].CreatedDate) {
+			return s.Messages[i].Id < s.Messages[j].Id
+		}
+		return s.Messages[i].CreatedDate.Before(s.Messages[j].CreatedDate)
+	})
+	return s
+}
+
+func (f *Feed) remove(c *feedClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disconnect(c)
+}
+
+// disconnect closes the client's channel, ending its connection.  The caller must hold the lock.
+func (f *Feed) disconnect(c *feedClient) {
+	if !c.closed {
+		c.closed = true
+		close(c.ch)
+	}
+	delete(f.clients, c)
+}
+
+func (f *Feed) disconnectAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for c := range f.clients {
+		f.disconnect(c)
+	}
+}
+
+func (f *Feed) heartbeat() time.Duration {
+	if f.Heartbeat > 0 {
+		return f.Heartbeat
+	}
+	return DefaultHeartbeat
+}
+
+func (f *Feed) historySize() int {
+	if f.History > 0 {
+		return f.History
+	}
+	return DefaultHistory
+}
+
+// stream sends the initial frames, then the client's frames and heartbeats until done is closed, the client is
+// disconnected, or send fails
+func (f *Feed) stream(c *feedClient, initial []*Frame, done <-chan struct{}, send func(*Frame) error) {
+	defer f.remove(c)
+
+	for _, fr := range initial {
+		if err := send(fr); err != nil {
+			return
+		}
+	}
+
+	t := time.NewTicker(f.heartbeat())
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case fr, ok := <-c.ch:
+			if !ok {
+				return
+			}
+
+			if err := send(fr); err != nil {
+				return
+			}
+		case <-t.C:
+			if err := send(&Frame{Type: FrameHeartbeat, Time: f.now()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// SSE returns a handler serving the feed as a Server-Sent Events stream.  The SSE event name is the frame type.
+func (f *Feed) SSE() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		c, initial := f.connect(r.Header.Get("Last-Event-ID"))
+		f.stream(c, initial, r.Context().Done(), func(fr *Frame) error {
+			data, err := json.Marshal(fr)
+			if err != nil {
+				return err
+			}
+
+			if fr.Id > 0 {
+				if _, err = fmt.Fprintf(w, "id: %d\n", fr.Id); err != nil {
+					return err
+				}
+			}
+
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", fr.Type, data); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+	})
+}
+
+// WebSocket returns a handler serving the feed over a WebSocket, as a JSON text message for each frame.  Messages
+// from the client are ignored.
+func (f *Feed) WebSocket() http.Handler {
+	return websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// read until the client goes away, since that is the only way to notice
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			var msg []byte
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+		}()
+
+		c, initial := f.connect(ws.Request().URL.Query().Get("lastEventId"))
+		f.stream(c, initial, done, func(fr *Frame) error {
+			return websocket.JSON.Send(ws, fr)
+		})
+	})
+}
@@ -0,0 +1,274 @@
+package live
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"golang.org/x/net/websocket"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestFeed() *Feed {
+	f := NewFeed()
+	f.now = func() time.Time { return testTime }
+	f.Sync(iarapi.IncidentList{{Id: 2}, {Id: 1}}, iarapi.ResponderList{{Id: "r-1", Name: "Smith"}},
+		iarapi.MessageList{{Id: "m-2", CreatedDate: testTime}, {Id: "m-1", CreatedDate: testTime.Add(-time.Hour)}})
+	return f
+}
+
+func responderEvent(typ iarapi.EventType, id string) *iarapi.WatchEvent {
+	return &iarapi.WatchEvent{Type: typ, Time: testTime, Responder: &iarapi.Responder{Id: id}}
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	frame *Frame
+}
+
+// readSSE reads the next event from the stream
+func readSSE(t *testing.T, r *bufio.Reader) *sseEvent {
+	t.Helper()
+
+	e := new(sseEvent)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case len(line) == 0 && len(e.event) > 0:
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.frame = new(Frame)
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), e.frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func openSSE(t *testing.T, url, lastEventId string) *bufio.Reader {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if len(lastEventId) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %s", ct)
+	}
+	return bufio.NewReader(res.Body)
+}
+
+// waitClients waits for the feed to have n clients, so events handled afterwards are sent to them
+func waitClients(t *testing.T, f *Feed, n int) {
+	t.Helper()
+
+	for i := 0; i < 200; i++ {
+		f.mu.Lock()
+		got := len(f.clients)
+		f.mu.Unlock()
+
+		if got == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("feed does not have %d clients", n)
+}
+
+func TestFeed_SSE(t *testing.T) {
+	f := newTestFeed()
+	ts := httptest.NewServer(f.SSE())
+	t.Cleanup(ts.Close)
+
+	r := openSSE(t, ts.URL, "")
+	e := readSSE(t, r)
+	if e.event != FrameSnapshot || e.id != strconv.FormatUint(f.lastId, 10) {
+		t.Fatalf("first event = %s, id %s", e.event, e.id)
+	}
+
+	want := &Snapshot{
+		Incidents:  iarapi.IncidentList{{Id: 1}, {Id: 2}},
+		Responders: iarapi.ResponderList{{Id: "r-1", Name: "Smith"}},
+		Messages:   iarapi.MessageList{{Id: "m-1"}, {Id: "m-2"}},
+	}
+	if got := e.frame.Snapshot; len(got.Incidents) != 2 || got.Incidents[0].Id != 1 || got.Responders[0].Name != "Smith" ||
+		len(got.Messages) != 2 || got.Messages[0].Id != "m-1" {
+		t.Errorf("snapshot = %+v, want %+v", got, want)
+	}
+
+	waitClients(t, f, 1)
+	f.Handle(responderEvent(iarapi.EventResponderAdded, "r-2"))
+
+	e = readSSE(t, r)
+	if e.event != string(iarapi.EventResponderAdded) || e.frame.Event.Responder.Id != "r-2" {
+		t.Errorf("event = %s %+v", e.event, e.frame)
+	}
+	lastId := e.id
+
+	f.Handle(responderEvent(iarapi.EventResponderRemoved, "r-1"))
+	f.Handle(responderEvent(iarapi.EventResponderUpdated, "r-2"))
+
+	t.Run("resume", func(t *testing.T) {
+		r := openSSE(t, ts.URL, lastId)
+
+		got := []string{readSSE(t, r).event, readSSE(t, r).event}
+		want := []string{string(iarapi.EventResponderRemoved), string(iarapi.EventResponderUpdated)}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replayed = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("resume beyond history", func(t *testing.T) {
+		e := readSSE(t, openSSE(t, ts.URL, "1"))
+		if e.event != FrameSnapshot {
+			t.Fatalf("event = %s, want snapshot", e.event)
+		}
+
+		var ids []string
+		for _, r := range e.frame.Snapshot.Responders {
+			ids = append(ids, r.Id)
+		}
+
+		if want := []string{"r-2"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("responders = %v, want %v", ids, want)
+		}
+	})
+}
+
+func TestFeed_heartbeat(t *testing.T) {
+	f := newTestFeed()
+	f.Heartbeat = 10 * time.Millisecond
+
+	ts := httptest.NewServer(f.SSE())
+	t.Cleanup(ts.Close)
+
+	r := openSSE(t, ts.URL, strconv.FormatUint(f.lastId, 10))
+	if e := readSSE(t, r); e.event != FrameHeartbeat || len(e.id) > 0 {
+		t.Errorf("event = %s, id %q, want heartbeat without id", e.event, e.id)
+	}
+}
+
+func TestFeed_WebSocket(t *testing.T) {
+	f := newTestFeed()
+	ts := httptest.NewServer(f.WebSocket())
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := new(Frame)
+	if err = websocket.JSON.Receive(ws, fr); err != nil || fr.Type != FrameSnapshot {
+		t.Fatalf("first frame = %+v, error %v", fr, err)
+	}
+
+	waitClients(t, f, 1)
+	f.Handle(responderEvent(iarapi.EventResponderAdded, "r-2"))
+
+	fr = new(Frame)
+	if err = websocket.JSON.Receive(ws, fr); err != nil || fr.Type != string(iarapi.EventResponderAdded) {
+		t.Fatalf("frame = %+v, error %v", fr, err)
+	}
+	lastId := fr.Id
+
+	f.Handle(responderEvent(iarapi.EventResponderUpdated, "r-2"))
+	ws.Close()
+	waitClients(t, f, 0)
+
+	ws, err = websocket.Dial(url+"?lastEventId="+strconv.FormatUint(lastId, 10), "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	fr = new(Frame)
+	if err = websocket.JSON.Receive(ws, fr); err != nil || fr.Type != string(iarapi.EventResponderUpdated) {
+		t.Errorf("replayed frame = %+v, error %v", fr, err)
+	}
+}
+
+func TestFeed_connect(t *testing.T) {
+	f := newTestFeed()
+	f.History = 2
+	start := f.lastId
+
+	for _, id := range []string{"r-2", "r-3", "r-4"} {
+		f.Handle(responderEvent(iarapi.EventResponderAdded, id))
+	}
+
+	tests := []struct {
+		name        string
+		lastEventId string
+		want        []string
+	}{
+		{name: "new", want: []string{FrameSnapshot}},
+		{name: "invalid", lastEventId: "abc", want: []string{FrameSnapshot}},
+		{name: "current", lastEventId: strconv.FormatUint(start+3, 10), want: []string{}},
+		{name: "in history", lastEventId: strconv.FormatUint(start+1, 10), want: []string{"r-3", "r-4"}},
+		{name: "beyond history", lastEventId: strconv.FormatUint(start, 10), want: []string{FrameSnapshot}},
+		{name: "ahead", lastEventId: strconv.FormatUint(start+10, 10), want: []string{FrameSnapshot}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := f.connect(tt.lastEventId)
+			defer f.remove(c)
+
+			got := make([]string, 0, len(frames))
+			for _, fr := range frames {
+				if fr.Event != nil {
+					got = append(got, fr.Event.Responder.Id)
+				} else {
+					got = append(got, fr.Type)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("connect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeed_slowClient(t *testing.T) {
+	f := newTestFeed()
+	f.ClientBuffer = 1
+
+	c, _ := f.connect("")
+	f.Handle(responderEvent(iarapi.EventResponderAdded, "r-2"))
+	f.Handle(responderEvent(iarapi.EventResponderAdded, "r-3"))
+
+	if _, ok := <-c.ch; !ok {
+		t.Fatal("queued frame not received")
+	}
+
+	if _, ok := <-c.ch; ok {
+		t.Error("slow client not disconnected")
+	}
+}
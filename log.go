@@ -0,0 +1,91 @@
+package iarapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Logger receives debug logs of the client's login steps and API requests, as a message followed by key, value
+// pairs.  It is satisfied by *slog.Logger, and PrintfLogger adapts a *log.Logger.  Credentials, the login request
+// token and cookies are redacted before logging.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// WithLogger sends debug logs to l
+func WithLogger(l Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+type printfLogger struct {
+	l *log.Logger
+}
+
+// PrintfLogger returns a Logger writing each message and its key, value pairs as a single line to l
+func PrintfLogger(l *log.Logger) Logger {
+	return &printfLogger{l: l}
+}
+
+func (p *printfLogger) Debug(msg string, args ...interface{}) {
+	var sb strings.Builder
+	sb.WriteString(msg)
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", args[i])
+		}
+	}
+	p.l.Print(sb.String())
+}
+
+// debug logs msg and the key, value pairs if the client has a logger, redacting sensitive values
+func (c *Client) debug(msg string, args ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		args[i] = redactLogValue(fmt.Sprint(args[i-1]), args[i])
+	}
+	c.logger.Debug(msg, args...)
+}
+
+// redactLogValue replaces the value of sensitive keys, and sensitive entries of headers and form values
+func redactLogValue(key string, v interface{}) interface{} {
+	for _, k := range []string{"password", "token", "cookie", "authorization"} {
+		if strings.Contains(strings.ToLower(key), k) {
+			return Redacted
+		}
+	}
+
+	switch val := v.(type) {
+	case http.Header:
+		h := val.Clone()
+		for _, k := range sensitiveHeaders {
+			if _, ok := h[http.CanonicalHeaderKey(k)]; ok {
+				h.Set(k, Redacted)
+			}
+		}
+		return h
+	case url.Values:
+		form := url.Values{}
+		for k, vals := range val {
+			form[k] = append([]string(nil), vals...)
+		}
+
+		for _, k := range sensitiveFormFields {
+			if _, ok := form[k]; ok {
+				form.Set(k, Redacted)
+			}
+		}
+		return form
+	}
+	return v
+}
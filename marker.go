@@ -0,0 +1,187 @@
+package iarapi
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"kml"`
+	Xmlns    string   `xml:"xmlns,attr,omitempty"`
+	Document struct {
+		Name       string          `xml:"name,omitempty"`
+		Placemarks []*kmlPlacemark `xml:"Placemark"`
+		Folders    []struct {
+			Placemarks []*kmlPlacemark `xml:"Placemark"`
+		} `xml:"Folder"`
+	} `xml:"Document"`
+}
+
+type kmlPlacemark struct {
+	Name         string     `xml:"name"`
+	Description  string     `xml:"description,omitempty"`
+	Address      string     `xml:"address,omitempty"`
+	ExtendedData []*kmlData `xml:"ExtendedData>Data"`
+	Point        struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// WriteGeoJSON writes the markers as a GeoJSON FeatureCollection of Point features
+func (l MarkerList) WriteGeoJSON(w io.Writer) error {
+	features := make([]*GeoJSONFeature, 0, len(l))
+	for _, m := range l {
+		f, err := newFeature(m, pointGeometry(m.Location))
+		if err != nil {
+			return err
+		}
+		features = append(features, f)
+	}
+
+	return writeFeatureCollection(w, features)
+}
+
+// ReadMarkerGeoJSON reads markers from a GeoJSON FeatureCollection of Point features.  Feature properties are
+// matched to the Marker JSON field names, the location is taken from the feature geometry.
+func ReadMarkerGeoJSON(r io.Reader) (MarkerList, error) {
+	fc, err := readFeatureCollection(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ml := make(MarkerList, 0, len(fc.Features))
+	for i, f := range fc.Features {
+		m := new(Marker)
+		if err = f.decodeProperties(m); err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+
+		if m.Location, err = f.Geometry.point(); err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+		ml = append(ml, m)
+	}
+
+	return ml, nil
+}
+
+// WriteKML writes the markers as a KML document of Placemarks.  The notes are used as the placemark description,
+// and the marker id, category and attachments are carried as ExtendedData so they survive a round trip.
+func (l MarkerList) WriteKML(w io.Writer) error {
+	doc := kmlDocument{Xmlns: kmlNamespace}
+	doc.Document.Name = "Markers"
+
+	for _, m := range l {
+		pm := &kmlPlacemark{Name: m.Name, Description: m.Notes, Address: m.Address}
+		pm.Point.Coordinates = fmt.Sprintf("%s,%s,0",
+			strconv.FormatFloat(m.Location.Lng, 'f', -1, 64), strconv.FormatFloat(m.Location.Lat, 'f', -1, 64))
+
+		pm.ExtendedData = append(pm.ExtendedData, &kmlData{Name: "id", Value: strconv.Itoa(m.Id)})
+		if len(m.Category) > 0 {
+			pm.ExtendedData = append(pm.ExtendedData, &kmlData{Name: "category", Value: m.Category})
+		}
+
+		if len(m.Attachments) > 0 {
+			data, err := json.Marshal(m.Attachments)
+			if err != nil {
+				return err
+			}
+			pm.ExtendedData = append(pm.ExtendedData, &kmlData{Name: "attachments", Value: string(data)})
+		}
+
+		doc.Document.Placemarks = append(doc.Document.Placemarks, pm)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadMarkerKML reads markers from the Point Placemarks of a KML document, including those nested one level down
+// inside a Folder.  Placemarks with other geometry types are skipped.
+func ReadMarkerKML(r io.Reader) (MarkerList, error) {
+	doc := new(kmlDocument)
+	if err := xml.NewDecoder(r).Decode(doc); err != nil {
+		return nil, err
+	}
+
+	placemarks := doc.Document.Placemarks
+	for _, f := range doc.Document.Folders {
+		placemarks = append(placemarks, f.Placemarks...)
+	}
+
+	ml := make(MarkerList, 0, len(placemarks))
+	for i, pm := range placemarks {
+		coords := strings.TrimSpace(pm.Point.Coordinates)
+		if len(coords) < 1 {
+			continue
+		}
+
+		m, err := markerFromPlacemark(pm)
+		if err != nil {
+			return nil, fmt.Errorf("placemark %d: %v", i, err)
+		}
+		ml = append(ml, m)
+	}
+
+	return ml, nil
+}
+
+func markerFromPlacemark(pm *kmlPlacemark) (*Marker, error) {
+	m := &Marker{
+		Name:    strings.TrimSpace(pm.Name),
+		Notes:   strings.TrimSpace(pm.Description),
+		Address: strings.TrimSpace(pm.Address),
+	}
+
+	pos := strings.Split(strings.TrimSpace(pm.Point.Coordinates), ",")
+	if len(pos) < 2 {
+		return nil, fmt.Errorf("invalid Point coordinates")
+	}
+
+	var err error
+	if m.Location.Lng, err = strconv.ParseFloat(strings.TrimSpace(pos[0]), 64); err != nil {
+		return nil, err
+	}
+
+	if m.Location.Lat, err = strconv.ParseFloat(strings.TrimSpace(pos[1]), 64); err != nil {
+		return nil, err
+	}
+
+	for _, d := range pm.ExtendedData {
+		switch d.Name {
+		case "id":
+			m.Id, err = strconv.Atoi(strings.TrimSpace(d.Value))
+		case "category":
+			m.Category = d.Value
+		case "attachments":
+			err = json.Unmarshal([]byte(d.Value), &m.Attachments)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("extended data %s: %v", d.Name, err)
+		}
+	}
+
+	return m, nil
+}
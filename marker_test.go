@@ -0,0 +1,76 @@
+package iarapi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarkerList_GeoJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := markerListGood.WriteGeoJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadMarkerGeoJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, markerListGood) {
+		t.Errorf("ReadMarkerGeoJSON() = %v, want %v", got, markerListGood)
+	}
+}
+
+func TestMarkerList_KML(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := markerListGood.WriteKML(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "<coordinates>-75.3,40.2,0</coordinates>") {
+		t.Errorf("missing placemark coordinates in %s", buf.String())
+	}
+
+	got, err := ReadMarkerKML(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subscriber id is not part of the KML data
+	want := markerGood
+	want.SubscriberId = 0
+
+	if !reflect.DeepEqual(got, MarkerList{&want}) {
+		t.Errorf("ReadMarkerKML() = %+v, want %+v", got[0], want)
+	}
+}
+
+func TestReadMarkerKML_Folder(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <Folder>
+      <Placemark>
+        <name>Knox Box</name>
+        <Point><coordinates> -75.1, 40.05 </coordinates></Point>
+      </Placemark>
+      <Placemark>
+        <name>Response Area</name>
+        <Polygon/>
+      </Placemark>
+    </Folder>
+  </Document>
+</kml>`
+
+	got, err := ReadMarkerKML(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := MarkerList{{Name: "Knox Box", Location: Coordinates{Lat: 40.05, Lng: -75.1}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMarkerKML() = %+v, want %+v", got, want)
+	}
+}
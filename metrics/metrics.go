@@ -0,0 +1,318 @@
+// Package metrics exposes Prometheus metrics about IamResponding activity and the API client.
+//
+// An Exporter is both an iarapi.Observer, recording API request, login and session renewal measurements when passed
+// to NewClient using iarapi.WithObserver, and an http.Handler serving the metrics in the Prometheus text format.  Incident and
+// responder metrics are refreshed from the Client when scraped, no more often than MinInterval.
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// DefaultMinInterval is the minimum time between refreshes of the incident and responder metrics
+const DefaultMinInterval = 15 * time.Second
+
+// DefaultBuckets are the upper bounds, in seconds, of the API request duration histogram buckets
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Source is the subset of the iarapi.Client methods used to refresh metrics
+type Source interface {
+	Incidents() (*iarapi.IncidentList, error)
+	ResponderList() (*iarapi.ResponderList, error)
+	ResponderCodes() (*iarapi.ResponderCodes, error)
+}
+
+type requestKey struct {
+	method   string
+	endpoint string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Exporter collects the metrics
+type Exporter struct {
+	// MinInterval is the minimum time between refreshes from the source, DefaultMinInterval if 0
+	MinInterval time.Duration
+
+	// Buckets are the request duration histogram buckets, DefaultBuckets if nil.  They must be set before any
+	// requests are observed.
+	Buckets []float64
+
+	mu          sync.Mutex
+	src         Source
+	requests    map[requestKey]map[int]uint64
+	durations   map[requestKey]*histogram
+	logins      map[string]uint64
+	relogins    map[string]uint64
+	refreshes   map[string]uint64
+	seen        map[int]bool
+	incidents   uint64
+	byDest      map[string]int
+	byCode      map[string]int
+	lastRefresh time.Time
+	now         func() time.Time
+}
+
+func New() *Exporter {
+	return &Exporter{
+		requests:  make(map[requestKey]map[int]uint64),
+		durations: make(map[requestKey]*histogram),
+		logins:    make(map[string]uint64),
+		relogins:  make(map[string]uint64),
+		refreshes: make(map[string]uint64),
+		seen:      make(map[int]bool),
+		byDest:    make(map[string]int),
+		byCode:    make(map[string]int),
+		now:       time.Now,
+	}
+}
+
+// SetSource sets the client incident and responder metrics are refreshed from.  This is separate from New since the
+// exporter must be passed to NewClient to observe the login.
+func (e *Exporter) SetSource(src Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.src = src
+}
+
+var idSegment = regexp.MustCompile(`/\d+(/|$)`)
+
+// ObserveRequest implements iarapi.Observer.  Numeric ids in the endpoint path are replaced with {id} to limit the
+// number of series.
+func (e *Exporter) ObserveRequest(method, endpoint string, status int, d time.Duration) {
+	endpoint = idSegment.ReplaceAllString(endpoint, "/{id}$1")
+	k := requestKey{method: method, endpoint: endpoint}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.requests[k] == nil {
+		e.requests[k] = make(map[int]uint64)
+	}
+	e.requests[k][status]++
+
+	h, ok := e.durations[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(e.buckets()))}
+		e.durations[k] = h
+	}
+
+	secs := d.Seconds()
+	for i, b := range e.buckets() {
+		if secs <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// ObserveLogin implements iarapi.Observer
+func (e *Exporter) ObserveLogin(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.logins[result(err)]++
+}
+
+// ObserveRelogin implements iarapi.Observer
+func (e *Exporter) ObserveRelogin(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.relogins[result(err)]++
+}
+
+// Refresh fetches the incidents, responder board and response codes from the source, if the last refresh was more
+// than MinInterval ago.  Incidents already in the list on the first refresh are not counted as new.
+func (e *Exporter) Refresh() error {
+	e.mu.Lock()
+	src := e.src
+	due := e.now().Sub(e.lastRefresh) >= e.minInterval()
+	e.mu.Unlock()
+
+	if src == nil || !due {
+		return nil
+	}
+
+	il, err := src.Incidents()
+
+	var rl *iarapi.ResponderList
+	if err == nil {
+		rl, err = src.ResponderList()
+	}
+
+	var codes *iarapi.ResponderCodes
+	if err == nil {
+		codes, err = src.ResponderCodes()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.refreshes[result(err)]++
+	if err != nil {
+		return err
+	}
+	first := e.lastRefresh.IsZero()
+	e.lastRefresh = e.now()
+
+	// only the ids in the current list are kept, so seen doesn't grow with every incident
+	seen := make(map[int]bool, len(*il))
+	for _, inc := range *il {
+		seen[inc.Id] = true
+		if !first && !e.seen[inc.Id] {
+			e.incidents++
+		}
+	}
+	e.seen = seen
+
+	names := make(map[int]string)
+	for _, c := range codes.ResponseCodes {
+		names[c.Id] = c.KeyEntry
+	}
+
+	e.byDest = make(map[string]int)
+	e.byCode = make(map[string]int)
+	for _, r := range *rl {
+		e.byDest[r.RespondingTo]++
+
+		code, ok := names[r.ResponseCodeId]
+		if !ok {
+			code = strconv.Itoa(r.ResponseCodeId)
+		}
+		e.byCode[code]++
+	}
+	return nil
+}
+
+// ServeHTTP refreshes the metrics if due, and writes them in the Prometheus text format.  A failed refresh is counted
+// in iar_refreshes_total and the previous values are served.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	_ = e.Refresh()
+
+	buf := new(bytes.Buffer)
+	e.write(buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (e *Exporter) write(buf *bytes.Buffer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p := &promWriter{buf: buf}
+
+	p.header("iar_incidents_total", "counter", "Incidents seen since the exporter started.")
+	p.sample("iar_incidents_total", nil, float64(e.incidents))
+
+	p.header("iar_responders", "gauge", "Responders on the board by destination.")
+	for _, k := range sortedKeys(e.byDest) {
+		p.sample("iar_responders", []string{"responding_to", k}, float64(e.byDest[k]))
+	}
+
+	p.header("iar_responders_by_code", "gauge", "Responders on the board by response code.")
+	for _, k := range sortedKeys(e.byCode) {
+		p.sample("iar_responders_by_code", []string{"code", k}, float64(e.byCode[k]))
+	}
+
+	keys := make([]requestKey, 0, len(e.requests))
+	for k := range e.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint == keys[j].endpoint {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].endpoint < keys[j].endpoint
+	})
+
+	p.header("iar_api_requests_total", "counter", "API requests by method, endpoint and HTTP status, 0 if no response.")
+	for _, k := range keys {
+		statuses := make([]int, 0, len(e.requests[k]))
+		for s := range e.requests[k] {
+			statuses = append(statuses, s)
+		}
+		sort.Ints(statuses)
+
+		for _, s := range statuses {
+			labels := []string{"method", k.method, "endpoint", k.endpoint, "status", strconv.Itoa(s)}
+			p.sample("iar_api_requests_total", labels, float64(e.requests[k][s]))
+		}
+	}
+
+	p.header("iar_api_request_duration_seconds", "histogram", "API request duration.")
+	for _, k := range keys {
+		h := e.durations[k]
+		labels := []string{"method", k.method, "endpoint", k.endpoint}
+
+		for i, b := range e.buckets() {
+			le := strconv.FormatFloat(b, 'g', -1, 64)
+			p.sample("iar_api_request_duration_seconds_bucket", append(labels, "le", le), float64(h.counts[i]))
+		}
+		p.sample("iar_api_request_duration_seconds_bucket", append(labels, "le", "+Inf"), float64(h.count))
+		p.sample("iar_api_request_duration_seconds_sum", labels, h.sum)
+		p.sample("iar_api_request_duration_seconds_count", labels, float64(h.count))
+	}
+
+	p.header("iar_logins_total", "counter", "Login attempts by result.")
+	for _, k := range []string{"success", "failure"} {
+		p.sample("iar_logins_total", []string{"result", k}, float64(e.logins[k]))
+	}
+
+	p.header("iar_session_renewals_total", "counter", "Logins to renew an expired API session by result.")
+	for _, k := range []string{"success", "failure"} {
+		p.sample("iar_session_renewals_total", []string{"result", k}, float64(e.relogins[k]))
+	}
+
+	p.header("iar_refreshes_total", "counter", "Refreshes of the incident and responder metrics by result.")
+	for _, k := range []string{"success", "failure"} {
+		p.sample("iar_refreshes_total", []string{"result", k}, float64(e.refreshes[k]))
+	}
+
+	if !e.lastRefresh.IsZero() {
+		p.header("iar_last_refresh_timestamp_seconds", "gauge", "Time of the last successful refresh.")
+		p.sample("iar_last_refresh_timestamp_seconds", nil, float64(e.lastRefresh.UnixNano())/1e9)
+	}
+}
+
+func (e *Exporter) buckets() []float64 {
+	if e.Buckets != nil {
+		return e.Buckets
+	}
+	return DefaultBuckets
+}
+
+func (e *Exporter) minInterval() time.Duration {
+	if e.MinInterval > 0 {
+		return e.MinInterval
+	}
+	return DefaultMinInterval
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
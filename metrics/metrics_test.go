@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/iartest"
+)
+
+func scrape(t *testing.T, e *Exporter) string {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestExporter(t *testing.T) {
+	s := iartest.NewServer()
+	defer s.Close()
+
+	e := New()
+	c, err := s.NewClient(iarapi.WithObserver(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetSource(c)
+
+	if _, err = c.Member(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.InjectFault("/api/Member", iartest.Fault{Status: 500, Count: 1})
+	if _, err = c.Member(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	out := scrape(t, e)
+
+	for _, want := range []string{
+		"# TYPE iar_incidents_total counter\niar_incidents_total 0\n",
+		`iar_responders{responding_to="Station"} 1`,
+		`iar_responders_by_code{code="Station"} 1`,
+		`iar_api_requests_total{method="GET",endpoint="/Member",status="200"} 1`,
+		`iar_api_requests_total{method="GET",endpoint="/Member",status="500"} 1`,
+		`iar_api_request_duration_seconds_bucket{method="GET",endpoint="/Member",le="+Inf"} 2`,
+		`iar_api_request_duration_seconds_count{method="GET",endpoint="/IncidentList"} 1`,
+		`iar_logins_total{result="success"} 1`,
+		`iar_logins_total{result="failure"} 0`,
+		`iar_session_renewals_total{result="success"} 0`,
+		`iar_refreshes_total{result="success"} 1`,
+		"iar_last_refresh_timestamp_seconds ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q in:\n%s", want, out)
+		}
+	}
+
+	// a new incident is counted once, and scrapes within MinInterval don't refresh
+	s.Update(func(f *iartest.Fixtures) {
+		f.Incidents = append(f.Incidents, &iarapi.Incident{Id: 2})
+	})
+
+	if out = scrape(t, e); !strings.Contains(out, "iar_incidents_total 0\n") {
+		t.Errorf("refreshed within MinInterval:\n%s", out)
+	}
+
+	now := time.Now().Add(time.Minute)
+	e.now = func() time.Time { return now }
+
+	scrape(t, e)
+	if out = scrape(t, e); !strings.Contains(out, "iar_incidents_total 1\n") {
+		t.Errorf("new incident not counted once:\n%s", out)
+	}
+
+	// a renewed session is not counted as a login
+	s.ExpireSessions()
+	if _, err = c.Member(); err != nil {
+		t.Fatal(err)
+	}
+
+	out = scrape(t, e)
+	for _, want := range []string{
+		`iar_logins_total{result="success"} 1`,
+		`iar_session_renewals_total{result="success"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Incidents() (*iarapi.IncidentList, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (failingSource) ResponderList() (*iarapi.ResponderList, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (failingSource) ResponderCodes() (*iarapi.ResponderCodes, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestExporter_Observe(t *testing.T) {
+	e := New()
+	e.Buckets = []float64{0.1, 1}
+	e.SetSource(failingSource{})
+
+	e.ObserveLogin(errors.New("login failed"))
+	e.ObserveRelogin(errors.New("login failed"))
+	e.ObserveRequest("POST", "/Incident/1234/VerifyAddress", 200, 50*time.Millisecond)
+	e.ObserveRequest("POST", "/Incident/99/VerifyAddress", 0, 2*time.Second)
+
+	out := scrape(t, e)
+
+	for _, want := range []string{
+		`iar_logins_total{result="failure"} 1`,
+		`iar_session_renewals_total{result="failure"} 1`,
+		`iar_refreshes_total{result="failure"} 1`,
+		`iar_api_requests_total{method="POST",endpoint="/Incident/{id}/VerifyAddress",status="0"} 1`,
+		`iar_api_request_duration_seconds_bucket{method="POST",endpoint="/Incident/{id}/VerifyAddress",le="0.1"} 1`,
+		`iar_api_request_duration_seconds_bucket{method="POST",endpoint="/Incident/{id}/VerifyAddress",le="1"} 1`,
+		`iar_api_request_duration_seconds_bucket{method="POST",endpoint="/Incident/{id}/VerifyAddress",le="+Inf"} 2`,
+		`iar_api_request_duration_seconds_sum{method="POST",endpoint="/Incident/{id}/VerifyAddress"} 2.05`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "iar_last_refresh_timestamp_seconds") {
+		t.Error("last refresh reported without a successful refresh")
+	}
+}
+
+func TestPromWriter(t *testing.T) {
+	p := &promWriter{buf: new(bytes.Buffer)}
+	p.sample("m", []string{"a", "x\"y\\z\nw"}, 1.5)
+
+	if got, want := p.buf.String(), `m{a="x\"y\\z\nw"} 1.5`+"\n"; got != want {
+		t.Errorf("sample() = %q, want %q", got, want)
+	}
+}
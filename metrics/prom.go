@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promWriter writes metrics in the Prometheus text exposition format
+type promWriter struct {
+	buf *bytes.Buffer
+}
+
+func (p *promWriter) header(name, kind, help string) {
+	p.buf.WriteString("# HELP " + name + " " + help + "\n")
+	p.buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes a sample, with labels given as name, value pairs
+func (p *promWriter) sample(name string, labels []string, v float64) {
+	p.buf.WriteString(name)
+
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		p.buf.WriteByte('}')
+	}
+
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(formatValue(v))
+	p.buf.WriteByte('\n')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,386 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// DefaultPrefix is the topic prefix used by DefaultTopics
+const DefaultPrefix = "iar"
+
+// Publisher sends messages to a broker.  It is implemented by Client.
+type Publisher interface {
+	Publish(topic string, payload []byte, retain bool) error
+}
+
+// Topics are the topics the bridge publishes to.  A topic left empty is not published.
+type Topics struct {
+	// Incident receives each new or updated incident
+	Incident string
+
+	// LastIncident holds the most recent incident, retained
+	LastIncident string
+
+	// Active holds ON for the bridge's active window after a new incident, then OFF, retained
+	Active string
+
+	// Responders holds the responder board, retained
+	Responders string
+
+	// Member holds the response status of each member, retained.  {id} is replaced with the member id.
+	Member string
+
+	// Message receives each new message
+	Message string
+}
+
+// DefaultTopics returns the default topics under prefix
+func DefaultTopics(prefix string) Topics {
+	return Topics{
+		Incident:     prefix + "/incident",
+		LastIncident: prefix + "/incident/last",
+		Active:       prefix + "/incident/active",
+		Responders:   prefix + "/responders",
+		Member:       prefix + "/member/{id}",
+		Message:      prefix + "/message",
+	}
+}
+
+// MemberStatus is the payload of the member topic
+type MemberStatus struct {
+	MemberId       int       `json:"memberId"`
+	Name           string    `json:"name"`
+	Responding     bool      `json:"responding"`
+	RespondingTo   string    `json:"respondingTo,omitempty"`
+	CalledAt       time.Time `json:"calledAt"`
+	EtaBefore      time.Time `json:"etaBefore"`
+	ResponseCodeId int       `json:"responseCodeId,omitempty"`
+}
+
+func (s *MemberStatus) equal(o *MemberStatus) bool {
+	return s.MemberId == o.MemberId && s.Name == o.Name && s.Responding == o.Responding &&
+		s.RespondingTo == o.RespondingTo && s.CalledAt.Equal(o.CalledAt) && s.EtaBefore.Equal(o.EtaBefore) &&
+		s.ResponseCodeId == o.ResponseCodeId
+}
+
+// Bridge publishes the changes seen by an iarapi.Watcher to MQTT topics
+type Bridge struct {
+	// OnError is called with publish errors, which do not stop Run
+	OnError func(error)
+
+	// Discovery, if set, publishes Home Assistant discovery configs when syncing, and for each member the first time
+	// their status is published
+	Discovery *Discovery
+
+	// ActiveWindow is how long the active topic stays ON after a new incident, DefaultActiveWindow if 0.  Incidents
+	// already current when the bridge starts don't turn it on.
+	ActiveWindow time.Duration
+
+	pub    Publisher
+	topics Topics
+
+	mu         sync.Mutex
+	board      map[string]*iarapi.Responder
+	members    map[int]*MemberStatus
+	discovered map[int]bool
+	lastId     int
+	lastUpdate string
+	active     *time.Timer
+}
+
+func NewBridge(pub Publisher, topics Topics) *Bridge {
+	return &Bridge{
+		pub:        pub,
+		topics:     topics,
+		board:      make(map[string]*iarapi.Responder),
+		members:    make(map[int]*MemberStatus),
+		discovered: make(map[int]bool),
+	}
+}
+
+// Run publishes the watcher's current state, then its events until ctx is done.  The watcher must be run separately,
+// and should have been polled at least once so there is a current state to publish.
+func (b *Bridge) Run(ctx context.Context, w *iarapi.Watcher) error {
+	ch, stop := w.Subscribe(16)
+	defer stop()
+
+	b.report(b.Sync(w.Current()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-ch:
+			b.report(b.Handle(e))
+		}
+	}
+}
+
+// Sync replaces the bridge state with the incidents and responders, and publishes the retained topics
+func (b *Bridge) Sync(il iarapi.IncidentList, rl iarapi.ResponderList) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var err error
+	if b.Discovery != nil {
+		err = b.publishMessages(b.Discovery.Configs())
+	}
+
+	var last *iarapi.Incident
+	for _, inc := range il {
+		if last == nil || inc.Id > last.Id {
+			last = inc
+		}
+	}
+
+	if last != nil {
+		b.lastId, b.lastUpdate = 0, ""
+		if e := b.publishLast(last); err == nil {
+			err = e
+		}
+	}
+
+	if e := b.publishActive(); err == nil {
+		err = e
+	}
+
+	b.board = make(map[string]*iarapi.Responder, len(rl))
+	for _, r := range rl {
+		b.board[r.Id] = r
+	}
+
+	if e := b.publishBoard(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Handle publishes the changes from a watcher event
+func (b *Bridge) Handle(e *iarapi.WatchEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch e.Type {
+	case iarapi.EventIncidentAdded, iarapi.EventIncidentUpdated:
+		err := b.publishJSON(b.topics.Incident, e.Incident, false)
+		if e2 := b.publishLast(e.Incident); err == nil {
+			err = e2
+		}
+
+		if e.Type == iarapi.EventIncidentAdded {
+			if e2 := b.activate(); err == nil {
+				err = e2
+			}
+		}
+		return err
+	case iarapi.EventResponderAdded, iarapi.EventResponderUpdated:
+		b.board[e.Responder.Id] = e.Responder
+		return b.publishBoard()
+	case iarapi.EventResponderRemoved:
+		delete(b.board, e.Responder.Id)
+		return b.publishBoard()
+	case iarapi.EventMessageAdded:
+		return b.publishJSON(b.topics.Message, e.Message, false)
+	}
+	return nil
+}
+
+// Rediscover publishes the discovery configs again, including those of every member seen.  Call it when Home
+// Assistant restarts, which it announces by publishing "online" to the homeassistant/status topic.
+func (b *Bridge) Rediscover() error {
+	if b.Discovery == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msgs := b.Discovery.Configs()
+
+	ids := make([]int, 0, len(b.members))
+	for id := range b.members {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		msgs = append(msgs, b.Discovery.MemberConfigs(id, b.members[id].Name)...)
+	}
+	return b.publishMessages(msgs)
+}
+
+// publishLast publishes the incident to the last incident topic, unless a more recent incident has been published.
+// The caller must hold the lock.
+func (b *Bridge) publishLast(inc *iarapi.Incident) error {
+	if inc.Id < b.lastId || inc.Id == b.lastId && inc.UpdatedOn == b.lastUpdate {
+		return nil
+	}
+
+	b.lastId, b.lastUpdate = inc.Id, inc.UpdatedOn
+	return b.publishJSON(b.topics.LastIncident, inc, true)
+}
+
+// activate publishes ON to the active topic, and OFF after the active window unless another incident arrives first.
+// The caller must hold the lock.
+func (b *Bridge) activate() error {
+	if len(b.topics.Active) < 1 {
+		return nil
+	}
+
+	if b.active != nil {
+		b.active.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(b.activeWindow(), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.active == t {
+			b.active = nil
+			b.report(b.publishActive())
+		}
+	})
+	b.active = t
+
+	return b.publishActive()
+}
+
+// publishActive publishes the active state to the active topic.  The caller must hold the lock.
+func (b *Bridge) publishActive() error {
+	if len(b.topics.Active) < 1 {
+		return nil
+	}
+
+	state := "OFF"
+	if b.active != nil {
+		state = "ON"
+	}
+
+	if err := b.pub.Publish(b.topics.Active, []byte(state), true); err != nil {
+		return fmt.Errorf("publishing to %s: %v", b.topics.Active, err)
+	}
+	return nil
+}
+
+func (b *Bridge) activeWindow() time.Duration {
+	if b.ActiveWindow > 0 {
+		return b.ActiveWindow
+	}
+	return DefaultActiveWindow
+}
+
+// publishBoard publishes the responder board, and the status of each member whose status changed.  The caller must
+// hold the lock.
+func (b *Bridge) publishBoard() error {
+	err := b.publishJSON(b.topics.Responders, b.responders(), true)
+
+	current := make(map[int]*MemberStatus)
+	for _, r := range b.board {
+		if r.MemberId == 0 {
+			continue
+		}
+
+		// a member may have more than one board entry, use the latest call
+		if ms, ok := current[r.MemberId]; ok && ms.CalledAt.After(r.CalledAt) {
+			continue
+		}
+
+		current[r.MemberId] = &MemberStatus{MemberId: r.MemberId, Name: r.Name, Responding: true,
+			RespondingTo: r.RespondingTo, CalledAt: r.CalledAt, EtaBefore: r.EtaBefore, ResponseCodeId: r.ResponseCodeId}
+	}
+
+	for id, old := range b.members {
+		if _, ok := current[id]; !ok && old.Responding {
+			current[id] = &MemberStatus{MemberId: id, Name: old.Name}
+		}
+	}
+
+	ids := make([]int, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		ms := current[id]
+		if old, ok := b.members[id]; ok && old.equal(ms) {
+			continue
+		}
+
+		if b.Discovery != nil && !b.discovered[id] {
+			if e := b.publishMessages(b.Discovery.MemberConfigs(id, ms.Name)); e != nil {
+				if err == nil {
+					err = e
+				}
+				continue
+			}
+			b.discovered[id] = true
+		}
+
+		topic := strings.Replace(b.topics.Member, "{id}", strconv.Itoa(id), -1)
+		if e := b.publishJSON(topic, ms, true); e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		b.members[id] = ms
+	}
+	return err
+}
+
+// responders returns the board ordered by call time.  The caller must hold the lock.
+func (b *Bridge) responders() iarapi.ResponderList {
+	rl := make(iarapi.ResponderList, 0, len(b.board))
+	for _, r := range b.board {
+		rl = append(rl, r)
+	}
+
+	sort.Slice(rl, func(i, j int) bool {
+		if rl[i].CalledAt.Equal(rl[j].CalledAt) {
+			return rl[i].Id < rl[j].Id
+		}
+		return rl[i].CalledAt.Before(rl[j].CalledAt)
+	})
+	return rl
+}
+
+func (b *Bridge) publishJSON(topic string, v interface{}, retain bool) error {
+	if len(topic) < 1 {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err = b.pub.Publish(topic, data, retain); err != nil {
+		return fmt.Errorf("publishing to %s: %v", topic, err)
+	}
+	return nil
+}
+
+func (b *Bridge) publishMessages(msgs []*Message) error {
+	for _, m := range msgs {
+		if err := b.pub.Publish(m.Topic, m.Payload, m.Retain); err != nil {
+			return fmt.Errorf("publishing to %s: %v", m.Topic, err)
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) report(err error) {
+	if err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
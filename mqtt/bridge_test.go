@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+type fakeSource struct {
+	incidents  iarapi.IncidentList
+	responders iarapi.ResponderList
+}
+
+func (f *fakeSource) Incidents() (*iarapi.IncidentList, error) {
+	return &f.incidents, nil
+}
+
+func (f *fakeSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &f.responders, nil
+}
+
+func (f *fakeSource) Messages() (*iarapi.MessageList, error) {
+	return &iarapi.MessageList{}, nil
+}
+
+func TestBridge(t *testing.T) {
+	b := newTestBroker(t)
+	c := NewClient(b.addr(), nil)
+	defer c.Close()
+
+	called := time.Date(2022, 11, 4, 10, 1, 0, 0, time.UTC)
+	src := &fakeSource{
+		incidents:  iarapi.IncidentList{{Id: 1, MessageBody: "OLD CALL"}, {Id: 2, MessageBody: "STRUCTURE FIRE"}},
+		responders: iarapi.ResponderList{{Id: "a", MemberId: 10, Name: "Able", RespondingTo: "Station", CalledAt: called}},
+	}
+
+	w := iarapi.NewWatcher(src)
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	br := NewBridge(c, DefaultTopics(DefaultPrefix))
+	br.ActiveWindow = 100 * time.Millisecond
+	errs := make(chan error, 10)
+	br.OnError = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- br.Run(ctx, w) }()
+
+	// last incident, active state, board and member status
+	b.waitPublished(4)
+
+	if m := b.retainedMessage("iar/incident/active"); m == nil || string(m.Payload) != "OFF" {
+		t.Errorf("active state = %+v, want OFF for incidents current at start", m)
+	}
+
+	inc := new(iarapi.Incident)
+	if m := b.retainedMessage("iar/incident/last"); m == nil || json.Unmarshal(m.Payload, inc) != nil || inc.Id != 2 {
+		t.Errorf("last incident = %+v", m)
+	}
+
+	ms := new(MemberStatus)
+	if m := b.retainedMessage("iar/member/10"); m == nil || json.Unmarshal(m.Payload, ms) != nil ||
+		!ms.Responding || ms.RespondingTo != "Station" || !ms.CalledAt.Equal(called) {
+		t.Errorf("member status = %+v", ms)
+	}
+
+	src.incidents = append(src.incidents, &iarapi.Incident{Id: 3, MessageBody: "MVA"})
+	src.responders = iarapi.ResponderList{{Id: "b", MemberId: 20, Name: "Baker", CalledAt: called.Add(time.Minute)}}
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// incident, last incident, active state, then the board and member statuses for each of the responder added and
+	// removed events, then the active state turning off after the window
+	msgs := b.waitPublished(4 + 3 + 2 + 2 + 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	if m := msgs[4]; m.Topic != "iar/incident" || m.Retain {
+		t.Errorf("incident message = %+v", m)
+	}
+
+	if m := msgs[6]; m.Topic != "iar/incident/active" || string(m.Payload) != "ON" || !m.Retain {
+		t.Errorf("active message = %+v, want ON", m)
+	}
+
+	if m := msgs[11]; m.Topic != "iar/incident/active" || string(m.Payload) != "OFF" || !m.Retain {
+		t.Errorf("active message = %+v, want OFF", m)
+	}
+
+	rl := make(iarapi.ResponderList, 0)
+	if m := b.retainedMessage("iar/responders"); m == nil || json.Unmarshal(m.Payload, &rl) != nil ||
+		len(rl) != 1 || rl[0].Id != "b" {
+		t.Errorf("responder board = %+v", rl)
+	}
+
+	ms = new(MemberStatus)
+	if m := b.retainedMessage("iar/member/10"); m == nil || json.Unmarshal(m.Payload, ms) != nil || ms.Responding ||
+		ms.Name != "Able" {
+		t.Errorf("removed member status = %+v", ms)
+	}
+
+	if m := b.retainedMessage("iar/member/20"); m == nil {
+		t.Error("no status for added member")
+	}
+
+	select {
+	case err := <-errs:
+		t.Errorf("OnError(%v)", err)
+	default:
+	}
+}
+
+type recordPublisher struct {
+	topics []string
+}
+
+func (p *recordPublisher) Publish(topic string, _ []byte, _ bool) error {
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func TestBridge_UnchangedMember(t *testing.T) {
+	p := new(recordPublisher)
+	br := NewBridge(p, Topics{Member: "m/{id}"})
+
+	r := &iarapi.Responder{Id: "a", MemberId: 10, RespondingTo: "Station"}
+	if err := br.Sync(nil, iarapi.ResponderList{r}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second entry for the same member with an earlier call does not change their status
+	e := &iarapi.WatchEvent{Type: iarapi.EventResponderAdded,
+		Responder: &iarapi.Responder{Id: "b", MemberId: 10, CalledAt: r.CalledAt.Add(-time.Minute)}}
+	if err := br.Handle(e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.topics) != 1 || p.topics[0] != "m/10" {
+		t.Errorf("published to %v, want [m/10]", p.topics)
+	}
+}
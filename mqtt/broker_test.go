@@ -0,0 +1,267 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker supporting QoS 0, retained messages and wills
+type testBroker struct {
+	t        *testing.T
+	ln       net.Listener
+	username string
+	password string
+
+	// noPingresp makes the broker ignore pings, like a broker that stopped responding
+	noPingresp bool
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	published []*Message
+	retained  map[string]*Message
+	sessions  map[net.Conn]*brokerSession
+	connects  int
+}
+
+type brokerSession struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	filters []string
+}
+
+func (s *brokerSession) write(first byte, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = writePacket(s.conn, first, body)
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{t: t, ln: ln, retained: make(map[string]*Message), sessions: make(map[net.Conn]*brokerSession)}
+	b.cond = sync.NewCond(&b.mu)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *testBroker) close() {
+	_ = b.ln.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.sessions {
+		_ = c.Close()
+	}
+}
+
+// dropConnections closes all client connections without a DISCONNECT, as if the network failed
+func (b *testBroker) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.sessions {
+		_ = c.Close()
+	}
+}
+
+// waitPublished waits for at least n messages to have been published, and returns all of them
+func (b *testBroker) waitPublished(n int) []*Message {
+	timeout := time.AfterFunc(2*time.Second, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer timeout.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.published) < n && time.Now().Before(deadline) {
+		b.cond.Wait()
+	}
+
+	if len(b.published) < n {
+		b.t.Fatalf("timed out waiting for %d messages, got %d", n, len(b.published))
+	}
+	return append([]*Message(nil), b.published...)
+}
+
+func (b *testBroker) retainedMessage(topic string) *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retained[topic]
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	p, err := readPacket(r, maxRemainingLength)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+
+	will, ok := b.connect(conn, p.body)
+	if !ok {
+		return
+	}
+
+	s := &brokerSession{conn: conn}
+	b.mu.Lock()
+	b.sessions[conn] = s
+	b.connects++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, conn)
+		b.mu.Unlock()
+
+		if will != nil {
+			b.publish(will)
+		}
+	}()
+
+	for {
+		p, err := readPacket(r, maxRemainingLength)
+		if err != nil {
+			return
+		}
+
+		switch p.kind {
+		case packetPublish:
+			topic, payload, err := readString(p.body)
+			if err != nil {
+				return
+			}
+			b.publish(&Message{Topic: topic, Payload: payload, Retain: p.flags&flagRetain != 0})
+		case packetSubscribe:
+			id := p.body[:2]
+			filter, _, err := readString(p.body[2:])
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.filters = append(s.filters, filter)
+			s.mu.Unlock()
+			s.write(packetSuback, append(append([]byte{}, id...), 0))
+
+			b.mu.Lock()
+			for _, m := range b.retained {
+				if MatchTopic(filter, m.Topic) {
+					s.write(packetPublish|flagRetain, append(appendString(nil, m.Topic), m.Payload...))
+				}
+			}
+			b.mu.Unlock()
+		case packetPingreq:
+			b.mu.Lock()
+			ignore := b.noPingresp
+			b.mu.Unlock()
+
+			if !ignore {
+				s.write(packetPingresp, nil)
+			}
+		case packetDisconnect:
+			will = nil
+			return
+		}
+	}
+}
+
+// connect validates the CONNECT packet body and sends the CONNACK, returning the will message if any
+func (b *testBroker) connect(conn net.Conn, body []byte) (*Message, bool) {
+	proto, rest, err := readString(body)
+	if err != nil || proto != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		_ = writePacket(conn, packetConnack, []byte{0, 1})
+		return nil, false
+	}
+
+	flags := rest[1]
+	rest = rest[4:]
+
+	if _, rest, err = readString(rest); err != nil {
+		return nil, false
+	}
+
+	var will *Message
+	if flags&0x04 != 0 {
+		will = &Message{Retain: flags&0x20 != 0}
+		var payload string
+		if will.Topic, rest, err = readString(rest); err != nil {
+			return nil, false
+		}
+		if payload, rest, err = readString(rest); err != nil {
+			return nil, false
+		}
+		will.Payload = []byte(payload)
+	}
+
+	var user, pass string
+	if flags&0x80 != 0 {
+		if user, rest, err = readString(rest); err != nil {
+			return nil, false
+		}
+	}
+	if flags&0x40 != 0 {
+		if pass, _, err = readString(rest); err != nil {
+			return nil, false
+		}
+	}
+
+	if len(b.username) > 0 && (user != b.username || pass != b.password) {
+		_ = writePacket(conn, packetConnack, []byte{0, 4})
+		return nil, false
+	}
+
+	return will, writePacket(conn, packetConnack, []byte{0, 0}) == nil
+}
+
+func (b *testBroker) publish(m *Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.published = append(b.published, m)
+	if m.Retain {
+		if len(m.Payload) > 0 {
+			b.retained[m.Topic] = m
+		} else {
+			delete(b.retained, m.Topic)
+		}
+	}
+	b.cond.Broadcast()
+
+	for _, s := range b.sessions {
+		s.mu.Lock()
+		filters := s.filters
+		s.mu.Unlock()
+
+		for _, f := range filters {
+			if MatchTopic(f, m.Topic) {
+				s.write(packetPublish, append(appendString(nil, m.Topic), m.Payload...))
+				break
+			}
+		}
+	}
+}
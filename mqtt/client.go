@@ -0,0 +1,451 @@
+// Package mqtt publishes IamResponding incidents and responder state to an MQTT broker, for station automation like
+// lights, bay doors and displays.
+//
+// It includes a minimal MQTT 3.1.1 client supporting what the bridge needs: publishing at QoS 0 with the retain
+// flag, and subscribing at QoS 0.  The client connects on first use, and reconnects if the connection is lost.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKeepAlive     = 60 * time.Second
+	DefaultDialTimeout   = 10 * time.Second
+	DefaultMaxPacketSize = 1 << 20
+
+	writeTimeout = 10 * time.Second
+)
+
+var (
+	ErrClosed = errors.New("mqtt: client closed")
+
+	// ErrPasswordWithoutUsername is returned when connecting with a password but no username, which MQTT 3.1.1
+	// does not allow
+	ErrPasswordWithoutUsername = errors.New("mqtt: password set without a username")
+)
+
+// ConnectError is the refusal of a connection by the broker
+type ConnectError struct {
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+
+	if r, ok := reasons[e.Code]; ok {
+		return "mqtt: connection refused, " + r
+	}
+	return fmt.Sprintf("mqtt: connection refused, code %d", e.Code)
+}
+
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+
+	// KeepAlive is the maximum time between packets sent to the broker, DefaultKeepAlive if 0.  The connection is
+	// closed and reconnected if the broker doesn't answer a ping within this time.
+	KeepAlive time.Duration
+
+	// MaxPacketSize limits the size of packets received from the broker, DefaultMaxPacketSize if 0.  The connection
+	// is closed if a larger packet is received.
+	MaxPacketSize int
+
+	// DialTimeout limits the time to connect, DefaultDialTimeout if 0
+	DialTimeout time.Duration
+
+	// TLSConfig enables TLS if set
+	TLSConfig *tls.Config
+
+	// Will is published by the broker if the client disconnects without closing, if set
+	Will *Message
+}
+
+// Message is a received message, or the will message
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+type subscription struct {
+	filter  string
+	handler func(*Message)
+}
+
+// Client is an MQTT client, safe for concurrent use
+type Client struct {
+	addr string
+	opts Options
+
+	mu       sync.Mutex
+	conn     net.Conn
+	done     chan struct{}
+	subs     []*subscription
+	packetId uint16
+	closed   bool
+}
+
+// NewClient returns a client for the broker at addr, in host:port form.  The connection is made on first use.
+func NewClient(addr string, opts *Options) *Client {
+	c := &Client{addr: addr}
+	if opts != nil {
+		c.opts = *opts
+	}
+
+	if c.opts.KeepAlive <= 0 {
+		c.opts.KeepAlive = DefaultKeepAlive
+	}
+
+	if c.opts.DialTimeout <= 0 {
+		c.opts.DialTimeout = DefaultDialTimeout
+	}
+
+	if c.opts.MaxPacketSize <= 0 {
+		c.opts.MaxPacketSize = DefaultMaxPacketSize
+	}
+	return c
+}
+
+// Connect connects to the broker, if not already connected
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connect()
+}
+
+// Publish sends a message at QoS 0.  If the connection was lost, it is reconnected and the publish retried once.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	if len(topic) < 1 || strings.ContainsAny(topic, "#+") {
+		return fmt.Errorf("mqtt: invalid topic %q", topic)
+	}
+
+	first := packetPublish
+	if retain {
+		first |= flagRetain
+	}
+
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+
+	return c.send(first, body)
+}
+
+// Subscribe subscribes to the topic filter at QoS 0, calling handler with each message received.  Subscriptions are
+// renewed when reconnecting.  The handler is called from the connection's read loop, so it must not block.
+func (c *Client) Subscribe(filter string, handler func(*Message)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subs = append(c.subs, &subscription{filter: filter, handler: handler})
+
+	if c.connected() {
+		if err := c.write(packetSubscribe|0x02, c.subscribeBody(filter)); err == nil {
+			return nil
+		}
+
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	// subscriptions are sent when connecting
+	return c.connect()
+}
+
+// Close disconnects from the broker.  The client can not be used after closing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+
+	_ = c.write(packetDisconnect, nil)
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// send writes the packet, connecting first if needed, and retries once on a new connection if the write fails
+func (c *Client) send(first byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = c.connect(); err != nil {
+			return err
+		}
+
+		if err = c.write(first, body); err == nil {
+			return nil
+		}
+
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+// connect dials the broker and completes the MQTT handshake if there is no live connection.  The caller must hold
+// the lock.
+func (c *Client) connect() error {
+	if c.closed {
+		return ErrClosed
+	}
+
+	if c.connected() {
+		return nil
+	}
+
+	if len(c.opts.Password) > 0 && len(c.opts.Username) < 1 {
+		return ErrPasswordWithoutUsername
+	}
+
+	d := &net.Dialer{Timeout: c.opts.DialTimeout}
+
+	var conn net.Conn
+	var err error
+	if c.opts.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", c.addr, c.opts.TLSConfig)
+	} else {
+		conn, err = d.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(c.opts.DialTimeout))
+	if err = writePacket(conn, packetConnect, c.connectBody()); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r, c.opts.MaxPacketSize)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	if p.kind != packetConnack || len(p.body) != 2 {
+		_ = conn.Close()
+		return errMalformed
+	}
+
+	if p.body[1] != 0 {
+		_ = conn.Close()
+		return &ConnectError{Code: p.body[1]}
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	c.conn = conn
+	c.done = make(chan struct{})
+	pong := make(chan struct{}, 1)
+	go c.readLoop(conn, r, pong, c.done)
+	go c.pingLoop(conn, pong, c.done)
+
+	for _, s := range c.subs {
+		if err = c.write(packetSubscribe|0x02, c.subscribeBody(s.filter)); err != nil {
+			_ = conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) connectBody() []byte {
+	flags := byte(0x02) // clean session
+	if len(c.opts.Username) > 0 {
+		flags |= 0x80
+	}
+
+	// a password is only allowed with a user name
+	if len(c.opts.Username) > 0 && len(c.opts.Password) > 0 {
+		flags |= 0x40
+	}
+
+	if c.opts.Will != nil {
+		flags |= 0x04
+		if c.opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = appendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = appendString(body, c.opts.ClientID)
+
+	if c.opts.Will != nil {
+		body = appendString(body, c.opts.Will.Topic)
+		body = appendString(body, string(c.opts.Will.Payload))
+	}
+
+	if len(c.opts.Username) > 0 {
+		body = appendString(body, c.opts.Username)
+	}
+
+	if flags&0x40 != 0 {
+		body = appendString(body, c.opts.Password)
+	}
+	return body
+}
+
+// connected reports whether there is a live connection.  The caller must hold the lock.
+func (c *Client) connected() bool {
+	if c.conn == nil {
+		return false
+	}
+
+	select {
+	case <-c.done:
+		c.conn = nil
+		return false
+	default:
+		return true
+	}
+}
+
+// write sends a packet on the current connection.  The caller must hold the lock.
+func (c *Client) write(first byte, body []byte) error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writePacket(c.conn, first, body)
+}
+
+// readLoop handles packets from the broker until the connection fails, then closes done.  Each PINGRESP is passed to
+// the ping loop on pong.
+func (c *Client) readLoop(conn net.Conn, r *bufio.Reader, pong chan<- struct{}, done chan struct{}) {
+	defer close(done)
+	defer conn.Close()
+
+	for {
+		p, err := readPacket(r, c.opts.MaxPacketSize)
+		if err != nil {
+			return
+		}
+
+		if p.kind == packetPingresp {
+			select {
+			case pong <- struct{}{}:
+			default:
+			}
+			continue
+		}
+
+		if p.kind != packetPublish {
+			continue
+		}
+
+		topic, rest, err := readString(p.body)
+		if err != nil {
+			return
+		}
+
+		// skip the packet id of QoS 1 and 2 messages
+		if p.flags&0x06 != 0 {
+			if len(rest) < 2 {
+				return
+			}
+			rest = rest[2:]
+		}
+
+		m := &Message{Topic: topic, Payload: rest, Retain: p.flags&flagRetain != 0}
+
+		c.mu.Lock()
+		subs := append([]*subscription(nil), c.subs...)
+		c.mu.Unlock()
+
+		for _, s := range subs {
+			if MatchTopic(s.filter, topic) {
+				s.handler(m)
+			}
+		}
+	}
+}
+
+// pingLoop pings the broker while the connection is live.  If a ping isn't answered within the keep alive, the
+// connection is closed and a new one made.
+func (c *Client) pingLoop(conn net.Conn, pong <-chan struct{}, done chan struct{}) {
+	t := time.NewTicker(c.opts.KeepAlive / 2)
+	defer t.Stop()
+
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-pong:
+			timeout = nil
+		case <-timeout:
+			_ = conn.Close()
+			<-done
+
+			c.mu.Lock()
+			if c.conn == conn {
+				c.conn = nil
+				_ = c.connect()
+			}
+			c.mu.Unlock()
+			return
+		case <-t.C:
+			if timeout != nil {
+				continue
+			}
+
+			c.mu.Lock()
+			if c.conn == conn {
+				_ = c.write(packetPingreq, nil)
+			}
+			c.mu.Unlock()
+			timeout = time.After(c.opts.KeepAlive)
+		}
+	}
+}
+
+// subscribeBody returns a SUBSCRIBE packet body for the filter, with a new packet id.  The caller must hold the lock.
+func (c *Client) subscribeBody(filter string) []byte {
+	c.packetId++
+	if c.packetId == 0 {
+		c.packetId = 1
+	}
+
+	body := appendUint16(nil, c.packetId)
+	body = appendString(body, filter)
+	return append(body, 0)
+}
+
+// MatchTopic reports whether the topic matches the subscription filter, which may contain + and # wildcards
+func MatchTopic(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	for i, part := range f {
+		switch {
+		case part == "#":
+			return true
+		case i >= len(t):
+			return false
+		case part != "+" && part != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
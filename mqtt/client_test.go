@@ -0,0 +1,368 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_Publish(t *testing.T) {
+	b := newTestBroker(t)
+	b.username, b.password = "user", "pass"
+
+	c := NewClient(b.addr(), &Options{ClientID: "test", Username: "user", Password: "pass"})
+	defer c.Close()
+
+	if err := c.Publish("iar/a", []byte("one"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish("iar/b", []byte("two"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := b.waitPublished(2)
+	if m := msgs[0]; m.Topic != "iar/a" || string(m.Payload) != "one" || !m.Retain {
+		t.Errorf("first message = %+v", m)
+	}
+
+	if m := msgs[1]; m.Topic != "iar/b" || string(m.Payload) != "two" || m.Retain {
+		t.Errorf("second message = %+v", m)
+	}
+
+	if err := c.Publish("iar/#", nil, false); err == nil {
+		t.Error("Publish() accepted wildcard topic")
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	b := newTestBroker(t)
+
+	c := NewClient(b.addr(), nil)
+	defer c.Close()
+
+	if err := c.Publish("iar/a", []byte("1"), false); err != nil {
+		t.Fatal(err)
+	}
+	b.waitPublished(1)
+
+	b.dropConnections()
+
+	// wait for the read loop to notice the connection is gone
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		connected := c.connected()
+		c.mu.Unlock()
+
+		if !connected || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := c.Publish("iar/a", []byte("2"), false); err != nil {
+		t.Fatal(err)
+	}
+	b.waitPublished(2)
+
+	b.mu.Lock()
+	connects := b.connects
+	b.mu.Unlock()
+
+	if connects != 2 {
+		t.Errorf("broker saw %d connects, want 2", connects)
+	}
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	b := newTestBroker(t)
+
+	pub := NewClient(b.addr(), nil)
+	defer pub.Close()
+
+	if err := pub.Publish("homeassistant/status", []byte("online"), true); err != nil {
+		t.Fatal(err)
+	}
+	b.waitPublished(1)
+
+	sub := NewClient(b.addr(), nil)
+	defer sub.Close()
+
+	got := make(chan *Message, 2)
+	if err := sub.Subscribe("homeassistant/+", func(m *Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-got:
+		if m.Topic != "homeassistant/status" || string(m.Payload) != "online" || !m.Retain {
+			t.Errorf("retained message = %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for retained message")
+	}
+}
+
+func TestClient_Will(t *testing.T) {
+	b := newTestBroker(t)
+
+	c := NewClient(b.addr(), &Options{Will: &Message{Topic: "iar/status", Payload: []byte("offline"), Retain: true}})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	_ = c.conn.Close()
+	c.mu.Unlock()
+
+	if m := b.waitPublished(1)[0]; m.Topic != "iar/status" || string(m.Payload) != "offline" || !m.Retain {
+		t.Errorf("will message = %+v", m)
+	}
+
+	// a clean close does not send the will
+	c = NewClient(b.addr(), &Options{Will: &Message{Topic: "iar/status", Payload: []byte("offline")}})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(b.waitPublished(1)); n != 1 {
+		t.Errorf("will published after clean close")
+	}
+
+	if err := c.Publish("iar/a", nil, false); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestClient_PingTimeout(t *testing.T) {
+	b := newTestBroker(t)
+	b.mu.Lock()
+	b.noPingresp = true
+	b.mu.Unlock()
+
+	c := NewClient(b.addr(), &Options{KeepAlive: 100 * time.Millisecond})
+	defer c.Close()
+
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unanswered ping closes the connection, and the client connects again
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.mu.Lock()
+		connects := b.connects
+		b.mu.Unlock()
+
+		if connects >= 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("broker saw %d connects, want a reconnect", connects)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// pings answered, the connection stays up
+	b.mu.Lock()
+	b.noPingresp = false
+	b.mu.Unlock()
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	time.Sleep(500 * time.Millisecond)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected() || c.conn != conn {
+		t.Error("connection replaced while pings are answered")
+	}
+}
+
+func TestClient_MaxPacketSize(t *testing.T) {
+	b := newTestBroker(t)
+
+	pub := NewClient(b.addr(), nil)
+	defer pub.Close()
+
+	if err := pub.Publish("iar/big", make([]byte, 64), true); err != nil {
+		t.Fatal(err)
+	}
+	b.waitPublished(1)
+
+	sub := NewClient(b.addr(), &Options{MaxPacketSize: 32})
+	defer sub.Close()
+
+	got := make(chan *Message, 1)
+	if err := sub.Subscribe("iar/#", func(m *Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-got:
+		t.Errorf("received %d byte message over the maximum", len(m.Payload))
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.connected() {
+		t.Error("connection kept after oversized packet")
+	}
+}
+
+func TestClient_PasswordWithoutUsername(t *testing.T) {
+	b := newTestBroker(t)
+
+	c := NewClient(b.addr(), &Options{Password: "pass"})
+	defer c.Close()
+
+	if err := c.Connect(); !errors.Is(err, ErrPasswordWithoutUsername) {
+		t.Errorf("Connect() error = %v, want %v", err, ErrPasswordWithoutUsername)
+	}
+}
+
+// TestClient_Broker runs against a real broker at the host:port in IARAPI_MQTT_BROKER, like a local mosquitto
+func TestClient_Broker(t *testing.T) {
+	addr := os.Getenv("IARAPI_MQTT_BROKER")
+	if len(addr) < 1 {
+		t.Skip("IARAPI_MQTT_BROKER not set")
+	}
+
+	opts := &Options{
+		ClientID: "iarapi-test-pub",
+		Username: os.Getenv("IARAPI_MQTT_USERNAME"),
+		Password: os.Getenv("IARAPI_MQTT_PASSWORD"),
+	}
+	topic := fmt.Sprintf("iarapi/test/%d", time.Now().UnixNano())
+
+	pub := NewClient(addr, opts)
+	defer pub.Close()
+
+	if err := pub.Publish(topic, []byte("retained"), true); err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Publish(topic, nil, true)
+
+	subOpts := *opts
+	subOpts.ClientID = "iarapi-test-sub"
+	sub := NewClient(addr, &subOpts)
+	defer sub.Close()
+
+	got := make(chan *Message, 2)
+	if err := sub.Subscribe(topic, func(m *Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []*Message{
+		{Topic: topic, Payload: []byte("retained"), Retain: true},
+		{Topic: topic, Payload: []byte("live")},
+	} {
+		if !want.Retain {
+			if err := pub.Publish(topic, want.Payload, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		select {
+		case m := <-got:
+			if !reflect.DeepEqual(m, want) {
+				t.Errorf("message = %+v, want %+v", m, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want.Payload)
+		}
+	}
+}
+
+func TestClient_ConnectRefused(t *testing.T) {
+	b := newTestBroker(t)
+	b.username, b.password = "user", "pass"
+
+	c := NewClient(b.addr(), &Options{Username: "user", Password: "wrong"})
+	defer c.Close()
+
+	var ce *ConnectError
+	if err := c.Connect(); !errors.As(err, &ce) || ce.Code != 4 {
+		t.Errorf("Connect() error = %v, want bad user name or password", err)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{filter: "iar/member/1", topic: "iar/member/1", want: true},
+		{filter: "iar/member/+", topic: "iar/member/1", want: true},
+		{filter: "iar/#", topic: "iar/member/1", want: true},
+		{filter: "iar/+", topic: "iar/member/1"},
+		{filter: "iar/member/1", topic: "iar/member"},
+		{filter: "iar/member", topic: "iar/member/1"},
+	}
+
+	for _, tt := range tests {
+		if got := MatchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestPacketLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152} {
+		buf := appendLength(nil, n)
+
+		var got, shift int
+		for _, b := range buf {
+			got |= int(b&0x7F) << shift
+			shift += 7
+		}
+
+		if got != n {
+			t.Errorf("appendLength(%d) decoded as %d", n, got)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    int
+		max     int
+		wantErr bool
+	}{
+		{name: "empty", max: 16},
+		{name: "at maximum", body: 16, max: 16},
+		{name: "over maximum", body: 17, max: 16, wantErr: true},
+		{name: "large length", body: 2097152, max: DefaultMaxPacketSize, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writePacket(&buf, packetPublish, make([]byte, tt.body)); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := readPacket(bufio.NewReader(&buf), tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readPacket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && len(p.body) != tt.body {
+				t.Errorf("readPacket() body = %d bytes, want %d", len(p.body), tt.body)
+			}
+		})
+	}
+}
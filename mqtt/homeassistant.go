@@ -0,0 +1,200 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	// DefaultDiscoveryPrefix is the topic prefix Home Assistant watches for discovery configs
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	// DefaultActiveWindow is how long the active topic and sensor stay on after an incident
+	DefaultActiveWindow = time.Hour
+)
+
+// Discovery builds Home Assistant MQTT discovery configs for the topics published by a Bridge.  The entities are an
+// active incident binary sensor, a responder count sensor, a last dispatch sensor, and for each member seen on the
+// responder board a responding binary sensor and a response sensor.
+type Discovery struct {
+	// Prefix is the discovery topic prefix, DefaultDiscoveryPrefix if empty
+	Prefix string
+
+	// NodeId identifies this bridge in entity ids and discovery topics, DefaultPrefix if empty
+	NodeId string
+
+	// DeviceName is the name of the Home Assistant device grouping the entities
+	DeviceName string
+
+	// ActiveWindow turns the active incident sensor off if the bridge hasn't published OFF this long after ON, in case
+	// the bridge stopped.  Set it to the bridge's ActiveWindow; DefaultActiveWindow if 0.
+	ActiveWindow time.Duration
+
+	// ResponseCodes name the response code ids in the member response sensors
+	ResponseCodes []*iarapi.ResponderCode
+
+	Topics Topics
+}
+
+// haConfig is the payload of a discovery config message
+type haConfig struct {
+	Name                string    `json:"name"`
+	UniqueId            string    `json:"unique_id"`
+	ObjectId            string    `json:"object_id"`
+	StateTopic          string    `json:"state_topic"`
+	ValueTemplate       string    `json:"value_template,omitempty"`
+	JsonAttributesTopic string    `json:"json_attributes_topic,omitempty"`
+	PayloadOn           string    `json:"payload_on,omitempty"`
+	PayloadOff          string    `json:"payload_off,omitempty"`
+	OffDelay            int       `json:"off_delay,omitempty"`
+	DeviceClass         string    `json:"device_class,omitempty"`
+	StateClass          string    `json:"state_class,omitempty"`
+	Icon                string    `json:"icon,omitempty"`
+	Device              *haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// Configs returns the discovery messages for the agency-wide entities.  Entities whose topic is not set are skipped.
+func (d *Discovery) Configs() []*Message {
+	msgs := make([]*Message, 0, 3)
+
+	if len(d.Topics.Active) > 0 {
+		msgs = append(msgs, d.message("binary_sensor", "active_incident", &haConfig{
+			Name:       "Active Incident",
+			StateTopic: d.Topics.Active,
+			PayloadOn:  "ON",
+			PayloadOff: "OFF",
+			OffDelay:   int(d.activeWindow() / time.Second),
+			Icon:       "mdi:fire-truck",
+		}))
+	}
+
+	if len(d.Topics.Responders) > 0 {
+		msgs = append(msgs, d.message("sensor", "responder_count", &haConfig{
+			Name:          "Responders",
+			StateTopic:    d.Topics.Responders,
+			ValueTemplate: "{{ value_json | count }}",
+			StateClass:    "measurement",
+			Icon:          "mdi:account-group",
+		}))
+	}
+
+	if len(d.Topics.LastIncident) > 0 {
+		msgs = append(msgs, d.message("sensor", "last_dispatch", &haConfig{
+			Name:                "Last Dispatch",
+			StateTopic:          d.Topics.LastIncident,
+			ValueTemplate:       "{{ value_json.messageBody[:255] }}",
+			JsonAttributesTopic: d.Topics.LastIncident,
+			Icon:                "mdi:message-alert",
+		}))
+	}
+
+	return msgs
+}
+
+// MemberConfigs returns the discovery messages for a member's entities, or none if the member topic is not set
+func (d *Discovery) MemberConfigs(memberId int, name string) []*Message {
+	if len(d.Topics.Member) < 1 {
+		return nil
+	}
+
+	topic := strings.Replace(d.Topics.Member, "{id}", strconv.Itoa(memberId), -1)
+	id := "member_" + strconv.Itoa(memberId)
+
+	return []*Message{
+		d.message("binary_sensor", id+"_responding", &haConfig{
+			Name:                name + " Responding",
+			StateTopic:          topic,
+			ValueTemplate:       "{{ 'ON' if value_json.responding else 'OFF' }}",
+			JsonAttributesTopic: topic,
+			PayloadOn:           "ON",
+			PayloadOff:          "OFF",
+			DeviceClass:         "occupancy",
+		}),
+		d.message("sensor", id+"_response", &haConfig{
+			Name:          name + " Response",
+			StateTopic:    topic,
+			ValueTemplate: d.responseTemplate(),
+			Icon:          "mdi:account-arrow-right",
+		}),
+	}
+}
+
+// ResponderConfigs returns the agency-wide discovery messages, followed by those of each member on the board
+func (d *Discovery) ResponderConfigs(rl iarapi.ResponderList) []*Message {
+	msgs := d.Configs()
+
+	names := make(map[int]string)
+	for _, r := range rl {
+		if r.MemberId != 0 {
+			names[r.MemberId] = r.Name
+		}
+	}
+
+	ids := make([]int, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		msgs = append(msgs, d.MemberConfigs(id, names[id])...)
+	}
+	return msgs
+}
+
+// responseTemplate maps the member's response code id to its name, or the response destination if the code has no
+// name
+func (d *Discovery) responseTemplate() string {
+	codes := make([]string, 0, len(d.ResponseCodes))
+	for _, c := range d.ResponseCodes {
+		name, _ := json.Marshal(c.KeyEntry)
+		codes = append(codes, fmt.Sprintf("%d: %s", c.Id, name))
+	}
+
+	return "{% set codes = {" + strings.Join(codes, ", ") + "} %}" +
+		"{{ codes.get(value_json.responseCodeId, value_json.respondingTo) if value_json.responding else 'None' }}"
+}
+
+func (d *Discovery) message(component, objectId string, cfg *haConfig) *Message {
+	node := d.NodeId
+	if len(node) < 1 {
+		node = DefaultPrefix
+	}
+
+	prefix := d.Prefix
+	if len(prefix) < 1 {
+		prefix = DefaultDiscoveryPrefix
+	}
+
+	name := d.DeviceName
+	if len(name) < 1 {
+		name = "IamResponding"
+	}
+
+	cfg.UniqueId = node + "_" + objectId
+	cfg.ObjectId = cfg.UniqueId
+	cfg.Device = &haDevice{Identifiers: []string{node}, Name: name, Manufacturer: "IamResponding", Model: "iarapi"}
+
+	payload, _ := json.Marshal(cfg)
+	return &Message{Topic: prefix + "/" + component + "/" + node + "/" + objectId + "/config", Payload: payload, Retain: true}
+}
+
+func (d *Discovery) activeWindow() time.Duration {
+	if d.ActiveWindow > 0 {
+		return d.ActiveWindow
+	}
+	return DefaultActiveWindow
+}
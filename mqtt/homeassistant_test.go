@@ -0,0 +1,125 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+func TestDiscovery_ResponderConfigs(t *testing.T) {
+	d := &Discovery{
+		DeviceName:    "Station 1",
+		ActiveWindow:  30 * time.Minute,
+		ResponseCodes: []*iarapi.ResponderCode{{Id: 2, KeyEntry: "Station"}, {Id: 3, KeyEntry: `"Scene"`}},
+		Topics:        DefaultTopics(DefaultPrefix),
+	}
+
+	rl := iarapi.ResponderList{{Id: "a", MemberId: 20, Name: "Baker"}, {Id: "x", Name: "Mutual Aid"}, {Id: "b", MemberId: 10, Name: "Able"}}
+	msgs := d.ResponderConfigs(rl)
+
+	topics := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		topics = append(topics, m.Topic)
+		if !m.Retain {
+			t.Errorf("%s not retained", m.Topic)
+		}
+	}
+
+	want := []string{
+		"homeassistant/binary_sensor/iar/active_incident/config",
+		"homeassistant/sensor/iar/responder_count/config",
+		"homeassistant/sensor/iar/last_dispatch/config",
+		"homeassistant/binary_sensor/iar/member_10_responding/config",
+		"homeassistant/sensor/iar/member_10_response/config",
+		"homeassistant/binary_sensor/iar/member_20_responding/config",
+		"homeassistant/sensor/iar/member_20_response/config",
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Errorf("ResponderConfigs() topics = %v, want %v", topics, want)
+	}
+
+	active := new(haConfig)
+	if err := json.Unmarshal(msgs[0].Payload, active); err != nil {
+		t.Fatal(err)
+	}
+
+	wantActive := &haConfig{
+		Name:       "Active Incident",
+		UniqueId:   "iar_active_incident",
+		ObjectId:   "iar_active_incident",
+		StateTopic: "iar/incident/active",
+		PayloadOn:  "ON",
+		PayloadOff: "OFF",
+		OffDelay:   1800,
+		Icon:       "mdi:fire-truck",
+		Device:     &haDevice{Identifiers: []string{"iar"}, Name: "Station 1", Manufacturer: "IamResponding", Model: "iarapi"},
+	}
+	if !reflect.DeepEqual(active, wantActive) {
+		t.Errorf("active incident config = %+v, want %+v", active, wantActive)
+	}
+
+	response := new(haConfig)
+	if err := json.Unmarshal(msgs[4].Payload, response); err != nil {
+		t.Fatal(err)
+	}
+
+	wantTemplate := `{% set codes = {2: "Station", 3: "\"Scene\""} %}` +
+		`{{ codes.get(value_json.responseCodeId, value_json.respondingTo) if value_json.responding else 'None' }}`
+	if response.StateTopic != "iar/member/10" || response.Name != "Able Response" || response.ValueTemplate != wantTemplate {
+		t.Errorf("member response config = %+v", response)
+	}
+}
+
+func TestDiscovery_UnsetTopics(t *testing.T) {
+	d := &Discovery{Topics: Topics{Responders: "r"}}
+
+	if msgs := d.Configs(); len(msgs) != 1 || msgs[0].Topic != "homeassistant/sensor/iar/responder_count/config" {
+		t.Errorf("Configs() = %+v", msgs)
+	}
+
+	if msgs := d.MemberConfigs(1, "Able"); len(msgs) != 0 {
+		t.Errorf("MemberConfigs() = %+v, want none", msgs)
+	}
+}
+
+func TestBridge_Discovery(t *testing.T) {
+	p := new(recordPublisher)
+	br := NewBridge(p, Topics{Responders: "r", Member: "m/{id}"})
+	br.Discovery = &Discovery{Topics: Topics{Responders: "r", Member: "m/{id}"}}
+
+	if err := br.Sync(nil, iarapi.ResponderList{{Id: "a", MemberId: 10, Name: "Able"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a status change for a discovered member does not repeat the discovery config
+	e := &iarapi.WatchEvent{Type: iarapi.EventResponderUpdated,
+		Responder: &iarapi.Responder{Id: "a", MemberId: 10, Name: "Able", RespondingTo: "Scene"}}
+	if err := br.Handle(e); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"homeassistant/sensor/iar/responder_count/config",
+		"r",
+		"homeassistant/binary_sensor/iar/member_10_responding/config",
+		"homeassistant/sensor/iar/member_10_response/config",
+		"m/10",
+		"r",
+		"m/10",
+	}
+	if !reflect.DeepEqual(p.topics, want) {
+		t.Errorf("published to %v, want %v", p.topics, want)
+	}
+
+	p.topics = nil
+	if err := br.Rediscover(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.topics) != 3 {
+		t.Errorf("Rediscover() published to %v", p.topics)
+	}
+}
@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types, in the high nibble of the fixed header
+const (
+	packetConnect    byte = 0x10
+	packetConnack    byte = 0x20
+	packetPublish    byte = 0x30
+	packetSubscribe  byte = 0x80
+	packetSuback     byte = 0x90
+	packetPingreq    byte = 0xC0
+	packetPingresp   byte = 0xD0
+	packetDisconnect byte = 0xE0
+
+	flagRetain byte = 0x01
+
+	maxRemainingLength = 268435455
+)
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// packet is a decoded control packet.  Flags are the low nibble of the first header byte.
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func writePacket(w io.Writer, first byte, body []byte) error {
+	if len(body) > maxRemainingLength {
+		return fmt.Errorf("mqtt: packet of %d bytes is too large", len(body))
+	}
+
+	buf := make([]byte, 0, len(body)+5)
+	buf = append(buf, first)
+	buf = appendLength(buf, len(body))
+	buf = append(buf, body...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readPacket reads a packet, failing if the body is larger than max bytes
+func readPacket(r *bufio.Reader, max int) (*packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n, shift int
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		n |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+
+		if i == 3 {
+			return nil, errMalformed
+		}
+		shift += 7
+	}
+
+	if n > max {
+		return nil, fmt.Errorf("mqtt: packet of %d bytes exceeds the maximum of %d", n, max)
+	}
+
+	p := &packet{kind: first & 0xF0, flags: first & 0x0F, body: make([]byte, n)}
+	if _, err = io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// appendLength appends the variable length encoding of the remaining length n
+func appendLength(buf []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+
+		buf = append(buf, b)
+		if n == 0 {
+			return buf
+		}
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+// readString reads a length prefixed string from the start of b, returning it and the rest of b
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < n+2 {
+		return "", nil, errMalformed
+	}
+	return string(b[2 : n+2]), b[n+2:], nil
+}
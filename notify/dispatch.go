@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// Dispatch holds the fields parsed from an incident's dispatch message
+type Dispatch struct {
+	CallType     string
+	Address      string
+	CrossStreets string
+	Units        string
+	Location     *iarapi.Coordinates
+}
+
+var (
+	// labeled fields, like "CALL: MVA ADDR: 100 MAIN ST X: 1ST AVE/2ND AVE UNITS: E1 M2".  A label ends at the next
+	// label, a semicolon or the end of the line.  Coordinate labels are matched only to end the field before them.
+	dispatchLabels = `CALL|NATURE|TYPE|ADDR|ADDRESS|LOC|X|XST|CROSS|UNITS?|LAT|LATITUDE|LON|LONG|LNG|LONGITUDE`
+	dispatchFields = regexp.MustCompile(`(?i)\b(` + dispatchLabels + `)\s*:\s*(.*?)\s*` +
+		`(?:;|$|\b(?:` + dispatchLabels + `)\s*:)`)
+
+	// an unlabeled message starting with the call type, like "STRUCTURE FIRE 100 MAIN ST ANYTOWN"
+	leadingCallType = regexp.MustCompile(`^([A-Za-z][A-Za-z /&-]*?)\s+(\d+\s.*)$`)
+)
+
+// ParseDispatch returns the dispatch fields of an incident.  Labeled fields in the message are used when present,
+// otherwise the call type is taken to be the words before the first number, and the address the rest of the
+// message.  The incident's own Address, when set, is preferred to a parsed address.
+func ParseDispatch(inc *iarapi.Incident) *Dispatch {
+	d := new(Dispatch)
+	body := strings.Join(strings.Fields(inc.MessageBody), " ")
+
+	// matches can't overlap, so each match ends before the next label
+	for rest := body; ; {
+		m := dispatchFields.FindStringSubmatchIndex(rest)
+		if m == nil {
+			break
+		}
+
+		label, value := strings.ToUpper(rest[m[2]:m[3]]), rest[m[4]:m[5]]
+		switch label {
+		case "CALL", "NATURE", "TYPE":
+			d.CallType = value
+		case "ADDR", "ADDRESS", "LOC":
+			d.Address = value
+		case "X", "XST", "CROSS":
+			d.CrossStreets = value
+		case "UNIT", "UNITS":
+			d.Units = value
+		}
+		rest = rest[m[5]:]
+	}
+
+	if len(d.CallType) < 1 && len(d.Address) < 1 {
+		if m := leadingCallType.FindStringSubmatch(body); m != nil {
+			d.CallType, d.Address = strings.TrimSpace(m[1]), m[2]
+		}
+	}
+
+	if len(inc.Address) > 0 {
+		d.Address = inc.Address
+	}
+
+	d.Location, _ = inc.Coordinates()
+	return d
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+func TestParseDispatch(t *testing.T) {
+	tests := []struct {
+		name string
+		inc  *iarapi.Incident
+		want *Dispatch
+	}{
+		{
+			name: "labeled",
+			inc:  &iarapi.Incident{MessageBody: "CALL: MVA WITH INJURIES ADDR: 100 MAIN ST X: 1ST AVE/2ND AVE UNITS: E1 M2"},
+			want: &Dispatch{CallType: "MVA WITH INJURIES", Address: "100 MAIN ST", CrossStreets: "1ST AVE/2ND AVE",
+				Units: "E1 M2"},
+		},
+		{
+			name: "semicolons",
+			inc:  &iarapi.Incident{MessageBody: "NATURE:ALARM;LOC:5 ELM ST;"},
+			want: &Dispatch{CallType: "ALARM", Address: "5 ELM ST"},
+		},
+		{
+			name: "unlabeled",
+			inc:  &iarapi.Incident{MessageBody: "STRUCTURE FIRE 100 MAIN ST ANYTOWN"},
+			want: &Dispatch{CallType: "STRUCTURE FIRE", Address: "100 MAIN ST ANYTOWN"},
+		},
+		{
+			name: "incident address and coordinates",
+			inc: &iarapi.Incident{MessageBody: "CALL: BRUSH FIRE LAT: 40.1234 LON: -75.4321",
+				Address: "200 FARM RD"},
+			want: &Dispatch{CallType: "BRUSH FIRE", Address: "200 FARM RD",
+				Location: &iarapi.Coordinates{Lat: 40.1234, Lng: -75.4321}},
+		},
+		{
+			name: "free text",
+			inc:  &iarapi.Incident{MessageBody: "Test page, disregard"},
+			want: &Dispatch{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseDispatch(tt.inc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDispatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
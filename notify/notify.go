@@ -0,0 +1,433 @@
+// Package notify relays new incidents by email, for members who can't run the app.  Sent to a carrier's email to
+// text gateway address, an alert arrives as a text message.
+//
+// Each incident is rendered through text/template, with the dispatch fields parsed from its message, and sent to the
+// recipients whose call type filters match it and who are not in their quiet hours.  Alerts skipped during quiet
+// hours are dropped, like the app's Do Not Disturb.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	// DefaultQueueSize is the number of incidents a Notifier queues for sending
+	DefaultQueueSize = 100
+
+	// DefaultSMTPTimeout bounds each SMTPSender delivery, including connecting
+	DefaultSMTPTimeout = 30 * time.Second
+)
+
+var (
+	// DefaultSubject is the subject template used if the Notifier has none
+	DefaultSubject = template.Must(template.New("subject").Parse(
+		`{{with .Dispatch.CallType}}{{.}}{{else}}Incident{{end}}{{with .Dispatch.Address}} - {{.}}{{end}}`))
+
+	// DefaultBody is the body template used if the Notifier has none
+	DefaultBody = template.Must(template.New("body").Parse(
+		`{{.Incident.MessageBody}}
+{{with .Dispatch.CrossStreets}}X: {{.}}
+{{end}}{{with .Dispatch.Units}}Units: {{.}}
+{{end}}{{with .Dispatch.Location}}https://maps.google.com/?q={{.Lat}},{{.Lng}}
+{{end}}{{.Time.Format "15:04 01/02"}}`))
+)
+
+// Alert is the data rendered by the subject and body templates
+type Alert struct {
+	Incident  *iarapi.Incident
+	Dispatch  *Dispatch
+	Recipient *Recipient
+
+	// Time is the time the incident arrived, in the notifier's location
+	Time time.Time
+}
+
+// Recipient is an address alerts are sent to
+type Recipient struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+
+	// CallTypes limits alerts to incidents whose call type contains one of these, ignoring case.  The whole message
+	// is matched when no call type could be parsed.  All incidents match if empty.
+	CallTypes []string `json:"callTypes"`
+
+	// ExcludeCallTypes skips incidents whose call type contains one of these
+	ExcludeCallTypes []string `json:"excludeCallTypes"`
+
+	// QuietHours, if set, skip alerts during that time of day, except for the Urgent call types.  Skipped alerts are
+	// not sent later.
+	QuietHours *QuietHours `json:"quietHours"`
+	Urgent     []string    `json:"urgent"`
+
+	// MaxLength truncates the body to this many characters, for text gateways, if not 0
+	MaxLength int `json:"maxLength"`
+}
+
+// Match reports whether the recipient should be sent an alert for the dispatch at time t.  It is false during quiet
+// hours, unless the call type is urgent.
+func (r *Recipient) Match(d *Dispatch, body string, t time.Time) bool {
+	callType := d.CallType
+	if len(callType) < 1 {
+		callType = body
+	}
+
+	if len(r.CallTypes) > 0 && !containsAny(callType, r.CallTypes) {
+		return false
+	}
+
+	if containsAny(callType, r.ExcludeCallTypes) {
+		return false
+	}
+
+	if r.QuietHours != nil && r.QuietHours.Contains(t) {
+		return containsAny(callType, r.Urgent)
+	}
+	return true
+}
+
+func containsAny(s string, subs []string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range subs {
+		if len(sub) > 0 && strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietHours is a daily period, like 22:00 to 06:00.  A period whose end is before its start spans midnight.
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Contains reports whether the time of day of t is in the period.  Invalid times never match.
+func (q *QuietHours) Contains(t time.Time) bool {
+	start, ok1 := parseClock(q.Start)
+	end, ok2 := parseClock(q.End)
+	if !ok1 || !ok2 || start == end {
+		return false
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// parseClock returns the time of day of s, which is a time like "22:00", "10:00 PM", or a date and time
+func parseClock(s string) (time.Duration, bool) {
+	layouts := []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "2006-01-02T15:04:05", time.RFC3339}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+		}
+	}
+	return 0, false
+}
+
+// MemberQuietHours returns the member's Do Not Disturb period, or nil if Do Not Disturb is off or does not apply to
+// their text message address
+func MemberQuietHours(m *iarapi.MemberInfo) *QuietHours {
+	if m.DoNotDisturb == 0 || !m.TextMessageAddressDND {
+		return nil
+	}
+
+	q := &QuietHours{Start: m.DoNotDisturbStartTime, End: m.DoNotDisturbFinishTime}
+	if _, ok := parseClock(q.Start); !ok {
+		return nil
+	}
+
+	if _, ok := parseClock(q.End); !ok {
+		return nil
+	}
+	return q
+}
+
+// MemberRecipient returns a recipient for the member's text message address, honoring their Do Not Disturb
+// settings, or nil if they have no text message address
+func MemberRecipient(m *iarapi.MemberInfo) *Recipient {
+	if len(m.TextMemberAddress) < 1 {
+		return nil
+	}
+
+	return &Recipient{
+		Name:       strings.TrimSpace(m.FirstName + " " + m.LastName),
+		Address:    m.TextMemberAddress,
+		QuietHours: MemberQuietHours(m),
+		MaxLength:  160,
+	}
+}
+
+// LoadRecipients reads a JSON array of recipients
+func LoadRecipients(r io.Reader) ([]*Recipient, error) {
+	recipients := make([]*Recipient, 0)
+	if err := json.NewDecoder(r).Decode(&recipients); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// Sender delivers an email.  It is implemented by SMTPSender.
+type Sender interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// SMTPSender sends email through an SMTP server, using STARTTLS when the server supports it
+type SMTPSender struct {
+	// Addr is the server address in host:port form
+	Addr string
+
+	// Auth authenticates to the server, if set
+	Auth smtp.Auth
+
+	// Timeout bounds connecting and the whole conversation with the server, DefaultSMTPTimeout if 0
+	Timeout time.Duration
+}
+
+func (s *SMTPSender) Send(from string, to []string, msg []byte) error {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := (&net.Dialer{Timeout: timeout}).Dial("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if s.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err = c.Auth(s.Auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err = c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Notifier sends alerts for new incidents to the recipients
+type Notifier struct {
+	From string
+
+	// Subject and Body render the alert, DefaultSubject and DefaultBody if nil
+	Subject *template.Template
+	Body    *template.Template
+
+	// Location is the time zone of quiet hours and alert times, time.Local if nil
+	Location *time.Location
+
+	// QueueSize is the number of incidents waiting to be sent in Run, DefaultQueueSize if 0.  Incidents arriving
+	// while the queue is full are dropped and reported to OnError.
+	QueueSize int
+
+	// OnError is called with send errors, which do not stop Run
+	OnError func(error)
+
+	sender     Sender
+	recipients []*Recipient
+	now        func() time.Time
+}
+
+func NewNotifier(sender Sender, from string, recipients ...*Recipient) *Notifier {
+	return &Notifier{From: from, sender: sender, recipients: recipients, now: time.Now}
+}
+
+// Run sends alerts for the incidents added to the watcher until ctx is done.  The watcher must be run separately.
+// Alerts are sent in the background, so a slow mail server does not delay the watcher, incidents still queued when
+// ctx is done are not sent.
+func (n *Notifier) Run(ctx context.Context, w *iarapi.Watcher) error {
+	ch, stop := w.Subscribe(16)
+	defer stop()
+
+	size := n.QueueSize
+	if size < 1 {
+		size = DefaultQueueSize
+	}
+	queue := make(chan *iarapi.Incident, size)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case inc := <-queue:
+				if _, err := n.Notify(inc); err != nil {
+					n.error(err)
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-ch:
+			if e.Type != iarapi.EventIncidentAdded {
+				continue
+			}
+
+			select {
+			case queue <- e.Incident:
+			default:
+				n.error(fmt.Errorf("alert queue full, incident %d not sent", e.Incident.Id))
+			}
+		}
+	}
+}
+
+func (n *Notifier) error(err error) {
+	if n.OnError != nil {
+		n.OnError(err)
+	}
+}
+
+// Notify sends the incident to each matching recipient, returning the number sent.  A failed send does not stop the
+// others, the first error is returned.
+func (n *Notifier) Notify(inc *iarapi.Incident) (int, error) {
+	loc := n.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	now := n.now().In(loc)
+	d := ParseDispatch(inc)
+
+	// times without a zone offset are the agency's local time
+	when := now
+	if t, err := inc.ArrivedTimeIn(loc); err == nil {
+		when = t.In(loc)
+	}
+
+	var sent int
+	var firstErr error
+	for _, r := range n.recipients {
+		if !r.Match(d, inc.MessageBody, now) {
+			continue
+		}
+
+		msg, err := n.message(&Alert{Incident: inc, Dispatch: d, Recipient: r, Time: when}, now)
+		if err == nil {
+			err = n.sender.Send(n.From, []string{r.Address}, msg)
+		}
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sending incident %d to %s: %v", inc.Id, r.Name, err)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, firstErr
+}
+
+// message renders the alert as an email
+func (n *Notifier) message(a *Alert, now time.Time) ([]byte, error) {
+	subjectTmpl, bodyTmpl := n.Subject, n.Body
+	if subjectTmpl == nil {
+		subjectTmpl = DefaultSubject
+	}
+
+	if bodyTmpl == nil {
+		bodyTmpl = DefaultBody
+	}
+
+	subject := new(bytes.Buffer)
+	if err := subjectTmpl.Execute(subject, a); err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := bodyTmpl.Execute(body, a); err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(body.String())
+	if r := []rune(text); a.Recipient.MaxLength > 0 && len(r) > a.Recipient.MaxLength {
+		text = string(r[:a.Recipient.MaxLength])
+	}
+
+	subj := strings.Join(strings.Fields(subject.String()), " ")
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(msg, "To: %s\r\n", a.Recipient.Address)
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subj))
+	fmt.Fprintf(msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.Replace(strings.Replace(text, "\r\n", "\n", -1), "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,471 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+type sentMail struct {
+	from string
+	to   []string
+	msg  string
+}
+
+type recordSender struct {
+	mu   sync.Mutex
+	sent []sentMail
+	fail map[string]bool
+}
+
+func (s *recordSender) Send(from string, to []string, msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail[to[0]] {
+		return errors.New("mailbox unavailable")
+	}
+	s.sent = append(s.sent, sentMail{from: from, to: to, msg: string(msg)})
+	return nil
+}
+
+func (s *recordSender) Sent() []sentMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentMail(nil), s.sent...)
+}
+
+type fakeSource struct {
+	mu        sync.Mutex
+	incidents iarapi.IncidentList
+}
+
+func (f *fakeSource) add(inc *iarapi.Incident) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.incidents = append(f.incidents, inc)
+}
+
+func (f *fakeSource) Incidents() (*iarapi.IncidentList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	il := append(iarapi.IncidentList(nil), f.incidents...)
+	return &il, nil
+}
+
+func (f *fakeSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &iarapi.ResponderList{}, nil
+}
+
+func (f *fakeSource) Messages() (*iarapi.MessageList, error) {
+	return &iarapi.MessageList{}, nil
+}
+
+func TestQuietHours_Contains(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 1, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		q    *QuietHours
+		t    time.Time
+		want bool
+	}{
+		{name: "daytime inside", q: &QuietHours{Start: "09:00", End: "17:00"}, t: at(12, 0), want: true},
+		{name: "daytime end", q: &QuietHours{Start: "09:00", End: "17:00"}, t: at(17, 0), want: false},
+		{name: "overnight late", q: &QuietHours{Start: "22:00", End: "06:00"}, t: at(23, 30), want: true},
+		{name: "overnight early", q: &QuietHours{Start: "22:00", End: "06:00"}, t: at(5, 59), want: true},
+		{name: "overnight outside", q: &QuietHours{Start: "22:00", End: "06:00"}, t: at(12, 0), want: false},
+		{name: "12 hour", q: &QuietHours{Start: "10:00 PM", End: "6:00AM"}, t: at(22, 0), want: true},
+		{name: "datetime", q: &QuietHours{Start: "2020-01-01T22:00:00", End: "2020-01-02T06:00:00"}, t: at(1, 0),
+			want: true},
+		{name: "invalid", q: &QuietHours{Start: "late", End: "06:00"}, t: at(1, 0), want: false},
+		{name: "empty period", q: &QuietHours{Start: "06:00", End: "06:00"}, t: at(6, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemberRecipient(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *iarapi.MemberInfo
+		want *Recipient
+	}{
+		{
+			name: "no address",
+			m:    &iarapi.MemberInfo{FirstName: "Pat", LastName: "Smith"},
+		},
+		{
+			name: "address",
+			m: &iarapi.MemberInfo{FirstName: "Pat", LastName: "Smith", TextMemberAddress: "5555550100@txt.example.com",
+				DoNotDisturb: 1, DoNotDisturbStartTime: "22:00", DoNotDisturbFinishTime: "06:00"},
+			want: &Recipient{Name: "Pat Smith", Address: "5555550100@txt.example.com", MaxLength: 160},
+		},
+		{
+			name: "do not disturb",
+			m: &iarapi.MemberInfo{FirstName: "Pat", LastName: "Smith", TextMemberAddress: "5555550100@txt.example.com",
+				DoNotDisturb: 1, DoNotDisturbStartTime: "22:00", DoNotDisturbFinishTime: "06:00",
+				TextMessageAddressDND: true},
+			want: &Recipient{Name: "Pat Smith", Address: "5555550100@txt.example.com", MaxLength: 160,
+				QuietHours: &QuietHours{Start: "22:00", End: "06:00"}},
+		},
+		{
+			name: "do not disturb off",
+			m: &iarapi.MemberInfo{FirstName: "Pat", TextMemberAddress: "5555550100@txt.example.com",
+				DoNotDisturbStartTime: "22:00", DoNotDisturbFinishTime: "06:00", TextMessageAddressDND: true},
+			want: &Recipient{Name: "Pat", Address: "5555550100@txt.example.com", MaxLength: 160},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MemberRecipient(tt.m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MemberRecipient() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecipient_Match(t *testing.T) {
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	quiet := &QuietHours{Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name string
+		r    *Recipient
+		d    *Dispatch
+		body string
+		t    time.Time
+		want bool
+	}{
+		{name: "all", r: &Recipient{}, d: &Dispatch{CallType: "ALARM"}, t: testNow, want: true},
+		{name: "call type", r: &Recipient{CallTypes: []string{"fire"}}, d: &Dispatch{CallType: "STRUCTURE FIRE"},
+			t: testNow, want: true},
+		{name: "other call type", r: &Recipient{CallTypes: []string{"fire"}}, d: &Dispatch{CallType: "MVA"},
+			t: testNow, want: false},
+		{name: "body", r: &Recipient{CallTypes: []string{"fire"}}, d: &Dispatch{}, body: "Brush fire near the park",
+			t: testNow, want: true},
+		{name: "excluded", r: &Recipient{ExcludeCallTypes: []string{"alarm"}}, d: &Dispatch{CallType: "FIRE ALARM"},
+			t: testNow, want: false},
+		{name: "quiet", r: &Recipient{QuietHours: quiet}, d: &Dispatch{CallType: "ALARM"}, t: night, want: false},
+		{name: "quiet urgent", r: &Recipient{QuietHours: quiet, Urgent: []string{"structure"}},
+			d: &Dispatch{CallType: "STRUCTURE FIRE"}, t: night, want: true},
+		{name: "outside quiet", r: &Recipient{QuietHours: quiet}, d: &Dispatch{CallType: "ALARM"}, t: testNow,
+			want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.Match(tt.d, tt.body, tt.t); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRecipients(t *testing.T) {
+	in := `[{"name": "Chief", "address": "chief@example.com", "callTypes": ["fire"], "urgent": ["structure"],
+		"quietHours": {"start": "22:00", "end": "06:00"}, "maxLength": 140}]`
+
+	got, err := LoadRecipients(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Recipient{{Name: "Chief", Address: "chief@example.com", CallTypes: []string{"fire"},
+		Urgent: []string{"structure"}, QuietHours: &QuietHours{Start: "22:00", End: "06:00"}, MaxLength: 140}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadRecipients() = %+v, want %+v", got, want)
+	}
+
+	if _, err := LoadRecipients(strings.NewReader("{")); err == nil {
+		t.Error("did not receive expected error")
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	inc := &iarapi.Incident{Id: 7, ArrivedOn: "2024-03-01T11:50:00",
+		MessageBody: "CALL: STRUCTURE FIRE ADDR: 100 MAIN ST X: 1ST AVE UNITS: E1"}
+
+	t.Run("default templates", func(t *testing.T) {
+		s := new(recordSender)
+		n := NewNotifier(s, "iar@example.com",
+			&Recipient{Name: "All", Address: "all@example.com"},
+			&Recipient{Name: "EMS", Address: "ems@example.com", CallTypes: []string{"mva", "medical"}},
+			&Recipient{Name: "Text", Address: "5555550100@txt.example.com", MaxLength: 20},
+		)
+		n.Location = time.UTC
+		n.now = func() time.Time { return testNow }
+
+		sent, err := n.Notify(inc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mail := s.Sent()
+		if sent != 2 || len(mail) != 2 {
+			t.Fatalf("sent %d, want 2", sent)
+		}
+
+		if m := mail[0]; m.from != "iar@example.com" || !reflect.DeepEqual(m.to, []string{"all@example.com"}) {
+			t.Errorf("mail = %+v", m)
+		}
+
+		msg := mail[0].msg
+		for _, s := range []string{"To: all@example.com\r\n", "Subject: STRUCTURE FIRE - 100 MAIN ST\r\n",
+			"X: 1ST AVE\r\n", "Units: E1\r\n", "11:50 03/01\r\n"} {
+			if !strings.Contains(msg, s) {
+				t.Errorf("message does not contain %q:\n%s", s, msg)
+			}
+		}
+
+		if body := mail[1].msg[strings.Index(mail[1].msg, "\r\n\r\n")+4:]; body != "CALL: STRUCTURE FIRE\r\n" {
+			t.Errorf("truncated body = %q", body)
+		}
+	})
+
+	t.Run("custom templates", func(t *testing.T) {
+		s := new(recordSender)
+		n := NewNotifier(s, "iar@example.com", &Recipient{Name: "Chief", Address: "chief@example.com"})
+		n.now = func() time.Time { return testNow }
+		n.Subject = template.Must(template.New("subject").Parse(`#{{.Incident.Id}} for {{.Recipient.Name}}`))
+		n.Body = template.Must(template.New("body").Parse(`{{.Dispatch.CallType}} at {{.Dispatch.Address}}`))
+
+		if _, err := n.Notify(inc); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := s.Sent()[0].msg
+		if !strings.Contains(msg, "Subject: #7 for Chief\r\n") ||
+			!strings.HasSuffix(msg, "\r\n\r\nSTRUCTURE FIRE at 100 MAIN ST\r\n") {
+			t.Errorf("message = %q", msg)
+		}
+	})
+
+	t.Run("quiet hours", func(t *testing.T) {
+		s := new(recordSender)
+		n := NewNotifier(s, "iar@example.com", &Recipient{Name: "Sleeper", Address: "sleeper@example.com",
+			QuietHours: &QuietHours{Start: "22:00", End: "06:00"}})
+		n.Location = time.UTC
+
+		// skipped at night, and not sent once the quiet hours end
+		now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+		n.now = func() time.Time { return now }
+
+		if sent, err := n.Notify(inc); err != nil || sent != 0 {
+			t.Errorf("Notify() during quiet hours = %d, %v", sent, err)
+		}
+
+		now = time.Date(2024, 3, 2, 7, 0, 0, 0, time.UTC)
+		later := &iarapi.Incident{Id: 8, MessageBody: "CALL: ALARM ADDR: 5 ELM ST"}
+		if sent, err := n.Notify(later); err != nil || sent != 1 {
+			t.Errorf("Notify() after quiet hours = %d, %v", sent, err)
+		}
+
+		if mail := s.Sent(); len(mail) != 1 || !strings.Contains(mail[0].msg, "Subject: ALARM - 5 ELM ST\r\n") {
+			t.Errorf("sent = %+v", mail)
+		}
+	})
+
+	t.Run("failed send", func(t *testing.T) {
+		s := &recordSender{fail: map[string]bool{"bad@example.com": true}}
+		n := NewNotifier(s, "iar@example.com",
+			&Recipient{Name: "Bad", Address: "bad@example.com"},
+			&Recipient{Name: "Good", Address: "good@example.com"},
+		)
+		n.now = func() time.Time { return testNow }
+
+		sent, err := n.Notify(inc)
+		if err == nil || !strings.Contains(err.Error(), "Bad") {
+			t.Errorf("Notify() error = %v", err)
+		}
+
+		if sent != 1 || len(s.Sent()) != 1 {
+			t.Errorf("sent %d, want 1", sent)
+		}
+	})
+}
+
+func TestNotifier_Run(t *testing.T) {
+	src := &fakeSource{incidents: iarapi.IncidentList{{Id: 1, MessageBody: "OLD CALL"}}}
+	w := iarapi.NewWatcher(src)
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := new(recordSender)
+	n := NewNotifier(s, "iar@example.com", &Recipient{Name: "All", Address: "all@example.com"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- n.Run(ctx, w) }()
+
+	// Run may not have subscribed yet, so keep adding incidents until one is sent
+	for i := 2; i < 200 && len(s.Sent()) < 1; i++ {
+		src.add(&iarapi.Incident{Id: i, MessageBody: "STRUCTURE FIRE 100 MAIN ST"})
+		if _, err := w.Poll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	mail := s.Sent()
+	if len(mail) < 1 {
+		t.Fatal("no alert sent")
+	}
+
+	for _, m := range mail {
+		if !strings.Contains(m.msg, "Subject: STRUCTURE FIRE - 100 MAIN ST\r\n") {
+			t.Errorf("message = %q", m.msg)
+		}
+	}
+}
+
+type blockingSender struct {
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(string, []string, []byte) error {
+	<-s.release
+	return nil
+}
+
+func TestNotifier_Run_SlowSender(t *testing.T) {
+	src := new(fakeSource)
+	w := iarapi.NewWatcher(src)
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &blockingSender{release: make(chan struct{})}
+
+	n := NewNotifier(s, "iar@example.com", &Recipient{Name: "All", Address: "all@example.com"})
+	n.QueueSize = 1
+
+	errs := make(chan error, 10)
+	n.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- n.Run(ctx, w) }()
+
+	// Run may not have subscribed yet, so keep adding incidents until the queue overflows.  None of the polls may
+	// block on the sender.
+	var err error
+	for i := 1; i <= 1000 && err == nil; i++ {
+		src.add(&iarapi.Incident{Id: i, MessageBody: "ALARM 5 ELM ST"})
+
+		pollCtx, pollCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, pollErr := w.Poll(pollCtx)
+		pollCancel()
+		if pollErr != nil {
+			t.Fatalf("Poll() blocked by slow sender: %v", pollErr)
+		}
+
+		select {
+		case err = <-errs:
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "queue full") {
+		t.Errorf("OnError(%v), want queue full", err)
+	}
+
+	cancel()
+	close(s.release)
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestSMTPSender_Timeout(t *testing.T) {
+	// a server which accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+	defer func() {
+		_ = ln.Close()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	s := &SMTPSender{Addr: ln.Addr().String(), Timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	if err = s.Send("iar@example.com", []string{"all@example.com"}, []byte("test")); err == nil {
+		t.Error("Send() to a hung server did not fail")
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Send() took %v", d)
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	srv := newTestSMTPServer(t)
+	s := &SMTPSender{Addr: srv.Addr()}
+
+	n := NewNotifier(s, "iar@example.com", &Recipient{Name: "All", Address: "all@example.com"})
+	n.now = func() time.Time { return testNow }
+
+	inc := &iarapi.Incident{Id: 1, MessageBody: "ALARM 5 ELM ST\n.leading dot"}
+	if sent, err := n.Notify(inc); err != nil || sent != 1 {
+		t.Fatalf("Notify() = %d, %v", sent, err)
+	}
+
+	mail := srv.Mail()
+	if len(mail) != 1 {
+		t.Fatalf("received %d messages, want 1", len(mail))
+	}
+
+	m := mail[0]
+	if m.from != "iar@example.com" || !reflect.DeepEqual(m.to, []string{"all@example.com"}) {
+		t.Errorf("envelope = %s %v", m.from, m.to)
+	}
+
+	if !strings.Contains(m.data, "Subject: ALARM - 5 ELM ST .leading dot\r\n") ||
+		!strings.Contains(m.data, "\r\n\r\nALARM 5 ELM ST\r\n.leading dot\r\n") {
+		t.Errorf("data = %q", m.data)
+	}
+}
@@ -0,0 +1,37 @@
+package iarapi
+
+import (
+	"strings"
+	"time"
+)
+
+// Observer receives measurements of the requests made by a Client, for metrics.  Methods must be safe for
+// concurrent use.
+type Observer interface {
+	// ObserveRequest is called after each API request with the request method, the endpoint path relative to the API
+	// base URL, the HTTP status (0 if no response was received), and the request duration
+	ObserveRequest(method, endpoint string, status int, d time.Duration)
+
+	// ObserveLogin is called after each login attempt, with the error if it failed
+	ObserveLogin(err error)
+
+	// ObserveRelogin is called after each attempt to renew an expired session, with the error if it failed.  Renewals
+	// are not reported to ObserveLogin.
+	ObserveRelogin(err error)
+}
+
+// WithObserver reports request, login and session renewal measurements to o
+func WithObserver(o Observer) ClientOption {
+	return func(c *Client) {
+		c.observer = o
+	}
+}
+
+// apiEndpointPath returns the path of the API url relative to the API base URL, without any query
+func (c *Client) apiEndpointPath(url string) string {
+	p := strings.TrimPrefix(url, c.apiUrl())
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	return p
+}
@@ -0,0 +1,63 @@
+package iarapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ClientOption configures optional behavior of a Client created with NewClient
+type ClientOption func(*Client)
+
+// WithHTTPClient uses a copy of hc to make requests.  If hc has no cookie jar, the default jar is kept, since the
+// login session is tracked using cookies.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		jar := c.httpClient.Jar
+		c.httpClient = *hc
+		if c.httpClient.Jar == nil {
+			c.httpClient.Jar = jar
+		}
+	}
+}
+
+// WithTransport makes requests using rt, like a Recorder or Replayer
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.httpClient.Transport = rt
+	}
+}
+
+// WithEndpoints overrides the URLs of the login page, the dashboard host, and the base of the API.  Empty values
+// keep the default for that endpoint.  This is mostly useful for testing against a fake server, like the one
+// provided by the iartest package.
+func WithEndpoints(login, dashboard, api string) ClientOption {
+	return func(c *Client) {
+		c.loginEndpoint = login
+		c.dashboardEndpoint = strings.TrimSuffix(dashboard, "/")
+		c.apiEndpoint = strings.TrimSuffix(api, "/")
+	}
+}
+
+// WithSchemaDriftHandler calls f for each type in an API response which contained fields not mapped to the Go type
+func WithSchemaDriftHandler(f func(*SchemaDrift)) ClientOption {
+	return func(c *Client) {
+		c.driftHandler = f
+	}
+}
+
+// WithSchemaDriftLogger logs the unmapped fields found in API responses to l
+func WithSchemaDriftLogger(l *log.Logger) ClientOption {
+	return WithSchemaDriftHandler(func(d *SchemaDrift) {
+		l.Printf("schema drift: %s response type %s has unmapped fields %v", d.Endpoint, d.Type, d.Fields)
+	})
+}
+
+// WithStrictDecoding makes API calls fail with a *StrictDecodeError when the response has fields which are not
+// mapped to the Go type, or values that don't match the type of their field (including values the types normally
+// decode leniently, like numeric strings)
+func WithStrictDecoding() ClientOption {
+	return func(c *Client) {
+		c.strict = true
+	}
+}
@@ -0,0 +1,331 @@
+// Package proxy serves a versioned REST API over an IamResponding Client, so integrations can use scoped API keys
+// instead of the shared agency login.
+//
+// Requests are authenticated with a key in the Authorization header ("Bearer <key>") or the X-API-Key header.  Only
+// the SHA-256 hash of each key is configured, see HashKey.  Each key is limited to the scopes it lists, and to its
+// own request rate.  Responses are cached by the Client, configured using iarapi.WithCache.
+//
+// The routes are:
+//
+//	GET /v1/health               no key required
+//	GET /v1/subscriber           scope subscriber
+//	GET /v1/incidents            scope incidents
+//	GET /v1/incidents/search     scope incidents, with start and end dates (2006-01-02), page and pageSize
+//	GET /v1/responders           scope responders
+//	GET /v1/messages             scope messages
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// API key scopes.  ScopeAll grants every scope.
+const (
+	ScopeSubscriber = "subscriber"
+	ScopeIncidents  = "incidents"
+	ScopeResponders = "responders"
+	ScopeMessages   = "messages"
+	ScopeAll        = "*"
+)
+
+const (
+	// DefaultRate is the sustained requests per second allowed for a key without a rate
+	DefaultRate = 1.0
+
+	// DefaultBurst is the number of requests a key without a burst may make at once
+	DefaultBurst = 10
+
+	// DefaultSearchDays is the search range when no start date is given
+	DefaultSearchDays = 7
+)
+
+// Source is the subset of the iarapi.Client methods served by the proxy
+type Source interface {
+	Subscriber() (*iarapi.SubscriberInfo, error)
+	Incidents() (*iarapi.IncidentList, error)
+	ResponderList() (*iarapi.ResponderList, error)
+	Messages() (*iarapi.MessageList, error)
+	SearchIncidents(isr *iarapi.IncidentSearchRequest) (*iarapi.IncidentList, error)
+}
+
+// Key is an API key allowed to use the proxy
+type Key struct {
+	// Name identifies the key's owner in logs
+	Name string `json:"name"`
+
+	// Hash is the hex SHA-256 hash of the key, as returned by HashKey
+	Hash string `json:"hash"`
+
+	Scopes []string `json:"scopes"`
+
+	// Rate is the sustained requests per second allowed, DefaultRate if 0
+	Rate float64 `json:"rate"`
+
+	// Burst is the number of requests allowed at once, DefaultBurst if 0
+	Burst int `json:"burst"`
+}
+
+// Allows reports whether the key has the scope
+func (k *Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// HashKey returns the hex SHA-256 hash of an API key, for the Hash field of a Key
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadKeys reads a JSON array of keys
+func LoadKeys(r io.Reader) ([]*Key, error) {
+	keys := make([]*Key, 0)
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if _, err := hex.DecodeString(k.Hash); err != nil || len(k.Hash) != sha256.Size*2 {
+			return nil, errors.New("key " + k.Name + ": hash is not a hex SHA-256 hash")
+		}
+	}
+	return keys, nil
+}
+
+// bucket is a token bucket limiting the request rate of a key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Server is an http.Handler serving the API
+type Server struct {
+	// OnError is called with errors from the source, which are returned to the caller as 502 Bad Gateway
+	OnError func(error)
+
+	src     Source
+	keys    []*Key
+	mu      sync.Mutex
+	buckets map[*Key]*bucket
+	mux     *http.ServeMux
+	now     func() time.Time
+}
+
+func NewServer(src Source, keys []*Key) *Server {
+	s := &Server{
+		src:     src,
+		keys:    keys,
+		buckets: make(map[*Key]*bucket),
+		mux:     http.NewServeMux(),
+		now:     time.Now,
+	}
+
+	s.mux.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	s.handle("/v1/subscriber", ScopeSubscriber, func(r *http.Request) (interface{}, error) {
+		return s.src.Subscriber()
+	})
+
+	s.handle("/v1/incidents", ScopeIncidents, func(r *http.Request) (interface{}, error) {
+		return s.src.Incidents()
+	})
+
+	s.handle("/v1/incidents/search", ScopeIncidents, s.search)
+
+	s.handle("/v1/responders", ScopeResponders, func(r *http.Request) (interface{}, error) {
+		return s.src.ResponderList()
+	})
+
+	s.handle("/v1/messages", ScopeMessages, func(r *http.Request) (interface{}, error) {
+		return s.src.Messages()
+	})
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// badRequest is an error in the request parameters
+type badRequest string
+
+func (e badRequest) Error() string {
+	return string(e)
+}
+
+// handle registers a GET route requiring the scope
+func (s *Server) handle(path, scope string, f func(*http.Request) (interface{}, error)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		k := s.authenticate(r)
+		if k == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="iarapi"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+			return
+		}
+
+		if !k.Allows(scope) {
+			writeError(w, http.StatusForbidden, "API key does not have the "+scope+" scope")
+			return
+		}
+
+		if wait := s.take(k); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		v, err := f(r)
+		if err != nil {
+			var br badRequest
+			if errors.As(err, &br) {
+				writeError(w, http.StatusBadRequest, br.Error())
+				return
+			}
+
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+			writeError(w, http.StatusBadGateway, "IamResponding request failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	})
+}
+
+// authenticate returns the key used by the request, or nil if there is none or it is not known
+func (s *Server) authenticate(r *http.Request) *Key {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); len(key) < 1 && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	if len(key) < 1 {
+		return nil
+	}
+
+	hash := []byte(HashKey(key))
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(k.Hash))) == 1 {
+			return k
+		}
+	}
+	return nil
+}
+
+// take removes a token from the key's bucket, returning 0 if it had one, or how long until it will
+func (s *Server) take(k *Key) time.Duration {
+	rate := k.Rate
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+
+	burst := float64(k.Burst)
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[k]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[k] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+func (s *Server) search(r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	isr := new(iarapi.IncidentSearchRequest)
+
+	end := s.now()
+	if v := q.Get("end"); len(v) > 0 {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, badRequest("invalid end date " + v)
+		}
+		end = t
+	}
+	isr.EndTime = end
+
+	isr.StartTime = end.AddDate(0, 0, -DefaultSearchDays)
+	if v := q.Get("start"); len(v) > 0 {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, badRequest("invalid start date " + v)
+		}
+		isr.StartTime = t
+	}
+
+	if isr.StartTime.After(isr.EndTime) {
+		return nil, badRequest("start date is after end date")
+	}
+
+	for name, p := range map[string]*int{"page": &isr.Page, "pageSize": &isr.PageSize} {
+		if v := q.Get(name); len(v) > 0 {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, badRequest("invalid " + name + " " + v)
+			}
+			*p = n
+		}
+	}
+
+	return s.src.SearchIncidents(isr)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	data, _ := json.Marshal(map[string]string{"error": msg})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+	"github.com/mmmorris1975/iarapi/iartest"
+)
+
+func newTestServer(t *testing.T, keys ...*Key) (*Server, *iartest.Server) {
+	t.Helper()
+
+	is := iartest.NewServer()
+	t.Cleanup(is.Close)
+
+	c, err := is.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(c, keys), is
+}
+
+func get(s http.Handler, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if len(key) > 0 {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_auth(t *testing.T) {
+	keys := []*Key{
+		{Name: "display", Hash: HashKey("display-key"), Scopes: []string{ScopeIncidents, ScopeResponders}},
+		{Name: "admin", Hash: strings.ToUpper(HashKey("admin-key")), Scopes: []string{ScopeAll}},
+	}
+	s, _ := newTestServer(t, keys...)
+
+	tests := []struct {
+		name string
+		path string
+		key  string
+		want int
+	}{
+		{name: "health without key", path: "/v1/health", want: http.StatusOK},
+		{name: "no key", path: "/v1/incidents", want: http.StatusUnauthorized},
+		{name: "unknown key", path: "/v1/incidents", key: "other", want: http.StatusUnauthorized},
+		{name: "in scope", path: "/v1/incidents", key: "display-key", want: http.StatusOK},
+		{name: "out of scope", path: "/v1/messages", key: "display-key", want: http.StatusForbidden},
+		{name: "all scopes", path: "/v1/messages", key: "admin-key", want: http.StatusOK},
+		{name: "subscriber", path: "/v1/subscriber", key: "admin-key", want: http.StatusOK},
+		{name: "unknown route", path: "/v1/apparatus", key: "admin-key", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(s, tt.path, tt.key).Code; got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("X-API-Key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/responders", nil)
+		req.Header.Set("X-API-Key", "display-key")
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/incidents", nil)
+		req.Header.Set("X-API-Key", "display-key")
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestServer_responses(t *testing.T) {
+	s, is := newTestServer(t, &Key{Name: "all", Hash: HashKey("k"), Scopes: []string{ScopeAll}})
+	f := is.Fixtures()
+
+	t.Run("incidents", func(t *testing.T) {
+		var got iarapi.IncidentList
+		if err := json.Unmarshal(get(s, "/v1/incidents", "k").Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(f.Incidents) || got[0].Id != f.Incidents[0].Id {
+			t.Errorf("incidents = %v, want %v", got, f.Incidents)
+		}
+	})
+
+	t.Run("responders", func(t *testing.T) {
+		var got iarapi.ResponderList
+		if err := json.Unmarshal(get(s, "/v1/responders", "k").Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(f.Responders) || got[0].Id != f.Responders[0].Id {
+			t.Errorf("responders = %v, want %v", got, f.Responders)
+		}
+	})
+
+	t.Run("upstream error", func(t *testing.T) {
+		var errs []error
+		s.OnError = func(err error) { errs = append(errs, err) }
+		defer func() { s.OnError = nil }()
+
+		is.InjectFault(iartest.ApiPath+"/MessageList", iartest.Fault{Status: http.StatusInternalServerError, Count: 1})
+
+		w := get(s, "/v1/messages", "k")
+		if w.Code != http.StatusBadGateway || len(errs) != 1 {
+			t.Errorf("status = %d, errors = %v", w.Code, errs)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body["error"]) < 1 {
+			t.Errorf("body = %s", w.Body.String())
+		}
+	})
+}
+
+func TestServer_search(t *testing.T) {
+	s, is := newTestServer(t, &Key{Name: "all", Hash: HashKey("k"), Scopes: []string{ScopeIncidents}})
+
+	arrived, err := is.Fixtures().Incidents[0].ArrivedTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := arrived.Format("2006-01-02")
+	after := arrived.AddDate(0, 0, 2).Format("2006-01-02")
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+		count int
+	}{
+		{name: "match", query: "?start=" + day + "&end=" + day, want: http.StatusOK, count: 1},
+		{name: "no match", query: "?start=" + after + "&end=" + after, want: http.StatusOK, count: 0},
+		{name: "bad date", query: "?start=yesterday", want: http.StatusBadRequest},
+		{name: "reversed", query: "?start=" + after + "&end=" + day, want: http.StatusBadRequest},
+		{name: "bad page", query: "?start=" + day + "&page=0", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(s, "/v1/incidents/search"+tt.query, "k")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var got iarapi.IncidentList
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != tt.count {
+				t.Errorf("incidents = %d, want %d", len(got), tt.count)
+			}
+		})
+	}
+}
+
+func TestServer_take(t *testing.T) {
+	k := &Key{Name: "limited", Hash: HashKey("k"), Rate: 2, Burst: 3}
+	s := NewServer(nil, []*Key{k})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance time.Duration
+		want    time.Duration
+	}{
+		{want: 0},
+		{want: 0},
+		{want: 0},
+		{want: 500 * time.Millisecond},
+		{advance: 250 * time.Millisecond, want: 250 * time.Millisecond},
+		{advance: 250 * time.Millisecond, want: 0},
+		{advance: 10 * time.Second, want: 0},
+		{want: 0},
+		{want: 0},
+		{want: 500 * time.Millisecond},
+	}
+
+	got := make([]time.Duration, 0, len(steps))
+	want := make([]time.Duration, 0, len(steps))
+	for _, st := range steps {
+		now = now.Add(st.advance)
+		got = append(got, s.take(k))
+		want = append(want, st.want)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("take() = %v, want %v", got, want)
+	}
+}
+
+func TestServer_rateLimit(t *testing.T) {
+	s, _ := newTestServer(t, &Key{Name: "limited", Hash: HashKey("k"), Scopes: []string{ScopeAll}, Burst: 1})
+
+	if w := get(s, "/v1/incidents", "k"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	w := get(s, "/v1/incidents", "k")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("status = %d, Retry-After = %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []*Key
+		wantErr bool
+	}{
+		{
+			name: "good",
+			in:   `[{"name": "a", "hash": "` + HashKey("a") + `", "scopes": ["incidents"], "rate": 0.5}]`,
+			want: []*Key{{Name: "a", Hash: HashKey("a"), Scopes: []string{"incidents"}, Rate: 0.5}},
+		},
+		{name: "plain key", in: `[{"name": "a", "hash": "a"}]`, wantErr: true},
+		{name: "not json", in: `keys`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadKeys(strings.NewReader(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
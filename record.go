@@ -0,0 +1,347 @@
+package iarapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces sensitive values in recorded cassettes
+const Redacted = "REDACTED"
+
+var (
+	ErrNoInteraction = errors.New("no recorded interaction for request")
+
+	// request and response headers which are never written to a cassette
+	sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+	// headers holding URLs, whose query parameters may carry login codes and state
+	urlHeaders = []string{"Location", "Content-Location", "Referer"}
+
+	// login form fields
+	sensitiveFormFields = []string{"Input.Username", "Input.Password", "__RequestVerificationToken"}
+
+	// response fields holding member PII or secrets, matched case-insensitively at any depth
+	sensitiveJsonFields = []string{"firstName", "lastName", "memberEmail", "secondaryEmail", "emailaddr",
+		"textMemberAddress", "deviceToken", "profileImage", "imageUrl", "assignedPhone", "additionalPhone",
+		"memberfname", "memberpwd"}
+
+	// personNameField is redacted in objects describing a member, which have a personKeyField, like responders and
+	// apparatus crew.  Other names, of hydrants, markers or the agency, are kept.
+	personNameField = "name"
+	personKeyField  = "memberid"
+
+	tokenInputRe = regexp.MustCompile(`(name="__RequestVerificationToken"[^>]*value=")[^"]*(")`)
+
+	// formBodyRe matches url encoded form data, like "a=1&b=2"
+	formBodyRe = regexp.MustCompile(`^[^=&\s]+=[^&\s]*(&[^=&\s]+=[^&\s]*)*$`)
+)
+
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// Cassette is a sequence of recorded HTTP interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Cassette)
+	return c, json.Unmarshal(data, c)
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Recorder is an http.RoundTripper which records sanitized copies of the requests and responses it handles.
+// Credentials, the login request token, cookies, URL query parameter values and member PII are replaced with Redacted
+// in the recording, the response returned to the caller is not modified.  Use it with WithTransport, then Save the
+// recording.
+type Recorder struct {
+	// RedactFields are additional JSON response fields to redact
+	RedactFields []string
+
+	transport http.RoundTripper
+	mu        sync.Mutex
+	cassette  Cassette
+}
+
+// NewRecorder returns a Recorder which sends requests using rt, or http.DefaultTransport if rt is nil
+func NewRecorder(rt http.RoundTripper) *Recorder {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &Recorder{transport: rt}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	redact := append(append([]string{}, sensitiveJsonFields...), r.RedactFields...)
+	i := &Interaction{
+		Request: &RecordedRequest{
+			Method:  req.Method,
+			URL:     sanitizeURL(req.URL.String()),
+			Headers: sanitizeHeaders(req.Header),
+			Body:    sanitizeBody(req.Header.Get("Content-Type"), reqBody, redact),
+		},
+		Response: &RecordedResponse{
+			Status:  res.StatusCode,
+			Headers: sanitizeHeaders(res.Header),
+			Body:    sanitizeBody(res.Header.Get("Content-Type"), resBody, redact),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+// Cassette returns a copy of the interactions recorded so far
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]*Interaction(nil), r.cassette.Interactions...)}
+}
+
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Replayer is an http.RoundTripper which answers requests from a cassette, without network access.  Requests are
+// matched by method and URL, with query parameter values redacted like the recording, and each recorded interaction
+// is used once, in the order recorded.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions))}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	u := req.URL.String()
+	redacted := sanitizeURL(u)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.cassette.Interactions {
+		if r.used[n] || i.Request.Method != req.Method || i.Request.URL != redacted && i.Request.URL != u {
+			continue
+		}
+		r.used[n] = true
+
+		h := i.Response.Headers.Clone()
+		if h == nil {
+			h = make(http.Header)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.Status, http.StatusText(i.Response.Status)),
+			StatusCode:    i.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        h,
+			Body:          io.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+}
+
+func sanitizeHeaders(h http.Header) http.Header {
+	c := h.Clone()
+	for _, k := range sensitiveHeaders {
+		c.Del(k)
+	}
+
+	for _, k := range urlHeaders {
+		for i, v := range c.Values(k) {
+			c[http.CanonicalHeaderKey(k)][i] = sanitizeURL(v)
+		}
+	}
+
+	if len(c) < 1 {
+		return nil
+	}
+	return c
+}
+
+// sanitizeURL replaces the values of the URL's query parameters and any user info with Redacted
+func sanitizeURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Redacted
+	}
+
+	if u.User != nil {
+		u.User = url.User(Redacted)
+	}
+
+	if len(u.RawQuery) > 0 {
+		q, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			u.RawQuery = Redacted
+			return u.String()
+		}
+
+		for _, v := range q {
+			for i := range v {
+				if len(v[i]) > 0 {
+					v[i] = Redacted
+				}
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// sanitizeBody redacts the body by its content type.  A body without a JSON, form or HTML content type is sniffed
+// as JSON, then as form data, and replaced with Redacted if it is neither, so nothing unrecognised is recorded as is.
+func sanitizeBody(contentType string, body []byte, redact []string) string {
+	switch {
+	case len(body) < 1:
+		return ""
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		return sanitizeForm(body)
+	case strings.Contains(contentType, "json"), json.Valid(body):
+		return sanitizeJSON(body, redact)
+	case strings.HasPrefix(contentType, "text/html"):
+		return tokenInputRe.ReplaceAllString(string(body), "${1}"+Redacted+"${2}")
+	case formBodyRe.Match(body):
+		return sanitizeForm(body)
+	}
+
+	return Redacted
+}
+
+func sanitizeForm(body []byte) string {
+	v, err := url.ParseQuery(string(body))
+	if err != nil {
+		return Redacted
+	}
+
+	for _, k := range sensitiveFormFields {
+		if _, ok := v[k]; ok {
+			v.Set(k, Redacted)
+		}
+	}
+	return v.Encode()
+}
+
+func sanitizeJSON(body []byte, redact []string) string {
+	v, err := decodeGeneric(body)
+	if err != nil {
+		return Redacted
+	}
+
+	names := make(map[string]bool)
+	for _, k := range redact {
+		names[strings.ToLower(k)] = true
+	}
+
+	data, err := json.Marshal(redactJSON(v, names))
+	if err != nil {
+		return Redacted
+	}
+	return string(data)
+}
+
+// redactJSON replaces the values of the named fields in a generically decoded JSON value.  Non-empty strings are
+// replaced with Redacted, anything else except null with null, so the shape of the data is kept where possible.
+func redactJSON(v interface{}, names map[string]bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		var person bool
+		for k := range val {
+			if strings.ToLower(k) == personKeyField {
+				person = true
+			}
+		}
+
+		for k, e := range val {
+			if key := strings.ToLower(k); !names[key] && !(person && key == personNameField) {
+				val[k] = redactJSON(e, names)
+			} else if str, ok := e.(string); ok {
+				if len(str) > 0 {
+					val[k] = Redacted
+				}
+			} else {
+				val[k] = nil
+			}
+		}
+	case []interface{}:
+		for i, e := range val {
+			val[i] = redactJSON(e, names)
+		}
+	}
+	return v
+}
@@ -0,0 +1,328 @@
+package iarapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FieldUnknown      = "unknown field"
+	FieldMissing      = "missing field"
+	FieldTypeMismatch = "type mismatch"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+
+	// the GET endpoints checked by SchemaReport, and the type each response is decoded in to
+	schemaEndpoints = []struct {
+		path string
+		t    reflect.Type
+	}{
+		{"/Subscriber", reflect.TypeOf(SubscriberInfo{})},
+		{"/Member", reflect.TypeOf(MemberInfo{})},
+		{"/IncidentList", reflect.TypeOf(IncidentList{})},
+		{"/MessageList", reflect.TypeOf(MessageList{})},
+		{"/DispatcherContent/AssociatedDispatchers", reflect.TypeOf(Dispatchers{})},
+		{"/ResponderCodes", reflect.TypeOf(ResponderCodes{})},
+		{"/OnDutyAtCodes", reflect.TypeOf(OnDutyAtCodeList{})},
+		{"/ResponderList", reflect.TypeOf(ResponderList{})},
+		{"/ApparatusList", reflect.TypeOf(ApparatusList{})},
+		{"/Hydrants", reflect.TypeOf(HydrantList{})},
+		{"/Markers", reflect.TypeOf(MarkerList{})},
+		{"/Geofences", reflect.TypeOf(GeofenceList{})},
+		{"/Events", reflect.TypeOf(EventList{})},
+	}
+)
+
+// SchemaDifference is a single place where an API response does not match the Go type it decodes in to.  Path is
+// the location in the response using the JSON field names, with [] marking array elements.
+type SchemaDifference struct {
+	Path   string
+	Kind   string
+	Detail string
+}
+
+func (d *SchemaDifference) String() string {
+	if len(d.Detail) > 0 {
+		return fmt.Sprintf("%s: %s (%s)", d.Path, d.Kind, d.Detail)
+	}
+	return fmt.Sprintf("%s: %s", d.Path, d.Kind)
+}
+
+// StrictDecodeError is returned by a Client using strict decoding when a response has unknown fields, or values
+// which don't match the type of the field they map to
+type StrictDecodeError struct {
+	Endpoint    string
+	Differences []*SchemaDifference
+}
+
+func (e *StrictDecodeError) Error() string {
+	s := make([]string, len(e.Differences))
+	for i, d := range e.Differences {
+		s[i] = d.String()
+	}
+	return fmt.Sprintf("strict decode of %s failed: %s", e.Endpoint, strings.Join(s, "; "))
+}
+
+// EndpointSchema is the actual shape of the response from an API endpoint, as a map of path to JSON value kinds,
+// and the differences found comparing it with the Go type.  Error is set if the endpoint could not be fetched.
+type EndpointSchema struct {
+	Endpoint    string
+	Type        string
+	Shape       map[string]string
+	Differences []*SchemaDifference
+	Error       error
+}
+
+type SchemaReport struct {
+	Endpoints []*EndpointSchema
+}
+
+// HasDrift reports whether any endpoint returned unknown fields or mismatched types.  Missing fields are not
+// considered drift, since the service commonly omits fields with no value.
+func (r *SchemaReport) HasDrift() bool {
+	for _, e := range r.Endpoints {
+		for _, d := range e.Differences {
+			if d.Kind != FieldMissing {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *SchemaReport) String() string {
+	sb := new(strings.Builder)
+	for _, e := range r.Endpoints {
+		fmt.Fprintf(sb, "%s (%s)\n", e.Endpoint, e.Type)
+		if e.Error != nil {
+			fmt.Fprintf(sb, "  error: %v\n", e.Error)
+			continue
+		}
+
+		for _, d := range e.Differences {
+			fmt.Fprintf(sb, "  %s\n", d)
+		}
+	}
+	return sb.String()
+}
+
+// SchemaReport fetches the response of each read-only API endpoint, records its shape, and compares it with the Go
+// type used to decode it.  An error fetching one endpoint is recorded in the report, and does not stop the others.
+func (c *Client) SchemaReport() *SchemaReport {
+	r := new(SchemaReport)
+
+	for _, ep := range schemaEndpoints {
+		es := &EndpointSchema{Endpoint: ep.path, Type: ep.t.Name(), Shape: make(map[string]string)}
+		r.Endpoints = append(r.Endpoints, es)
+
+		var raw json.RawMessage
+		if es.Error = c.apiGet(ep.path, &raw); es.Error != nil {
+			continue
+		}
+
+		v, err := decodeGeneric(raw)
+		if err != nil {
+			es.Error = err
+			continue
+		}
+
+		captureShape(v, "", es.Shape)
+		es.Differences = schemaDiff(v, ep.t)
+	}
+
+	return r
+}
+
+// decodeGeneric decodes JSON without a target type, keeping numbers as json.Number so integers can be checked
+func decodeGeneric(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return v, dec.Decode(&v)
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func captureShape(v interface{}, path string, shape map[string]string) {
+	key := path
+	if len(key) < 1 {
+		key = "."
+	}
+
+	kind := jsonKind(v)
+	if cur, ok := shape[key]; !ok {
+		shape[key] = kind
+	} else if !strings.Contains("|"+cur+"|", "|"+kind+"|") {
+		shape[key] = cur + "|" + kind
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, e := range val {
+			captureShape(e, path+"."+k, shape)
+		}
+	case []interface{}:
+		for _, e := range val {
+			captureShape(e, path+"[]", shape)
+		}
+	}
+}
+
+// schemaDiff compares a generically decoded JSON value with type t, returning the differences sorted by path
+func schemaDiff(v interface{}, t reflect.Type) []*SchemaDifference {
+	seen := make(map[string]*SchemaDifference)
+	diffValue(v, t, "", seen)
+
+	diffs := make([]*SchemaDifference, 0, len(seen))
+	for _, d := range seen {
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Path == diffs[j].Path {
+			return diffs[i].Kind < diffs[j].Kind
+		}
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs
+}
+
+func diffValue(v interface{}, t reflect.Type, path string, seen map[string]*SchemaDifference) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// null is acceptable for anything, and raw or interface values accept any JSON
+	if v == nil || t == rawMessageType || t.Kind() == reflect.Interface {
+		return
+	}
+
+	mismatch := func(want string) {
+		p := path
+		if len(p) < 1 {
+			p = "."
+		}
+		seen[p+FieldTypeMismatch] = &SchemaDifference{Path: p, Kind: FieldTypeMismatch,
+			Detail: fmt.Sprintf("expected %s, got %s", want, jsonKind(v))}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			if _, ok := v.(string); !ok {
+				mismatch("string")
+			}
+			return
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		diffStruct(obj, t, path, seen)
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			mismatch("array")
+			return
+		}
+
+		for _, e := range arr {
+			diffValue(e, t.Elem(), path+"[]", seen)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+
+		for _, e := range obj {
+			diffValue(e, t.Elem(), path+"{}", seen)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			mismatch("string")
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			mismatch("boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(json.Number)
+		if !ok {
+			mismatch("number")
+		} else if _, err := n.Int64(); err != nil {
+			mismatch("integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			mismatch("number")
+		}
+	}
+}
+
+func diffStruct(obj map[string]interface{}, t reflect.Type, path string, seen map[string]*SchemaDifference) {
+	type field struct {
+		name string
+		t    reflect.Type
+	}
+
+	fields := make(map[string]field)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || len(f.PkgPath) > 0 {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if len(name) < 1 {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = field{name: name, t: f.Type}
+	}
+
+	for k, v := range obj {
+		f, ok := fields[strings.ToLower(k)]
+		if !ok {
+			seen[path+"."+k+FieldUnknown] = &SchemaDifference{Path: path + "." + k, Kind: FieldUnknown,
+				Detail: jsonKind(v)}
+			continue
+		}
+
+		diffValue(v, f.t, path+"."+k, seen)
+		delete(fields, strings.ToLower(k))
+	}
+
+	for _, f := range fields {
+		p := path + "." + f.name
+		seen[p+FieldMissing] = &SchemaDifference{Path: p, Kind: FieldMissing}
+	}
+}
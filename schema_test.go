@@ -0,0 +1,96 @@
+package iarapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	data := `[{"id": "321", "name": "Test", "order": 1.5, "calledAt": 0, "isMutualAid": false, "newField": {"a": 1}}]`
+
+	v, err := decodeGeneric([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, d := range schemaDiff(v, reflect.TypeOf(ResponderList{})) {
+		if d.Kind != FieldMissing {
+			got[d.Path] = d.Kind
+		}
+	}
+
+	want := map[string]string{
+		"[].newField": FieldUnknown,
+		"[].order":    FieldTypeMismatch,
+		"[].calledAt": FieldTypeMismatch,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schemaDiff() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_StrictDecoding(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "good", body: `[{"id": 77, "name": "Engine 1", "status": 1}]`},
+		{name: "unknown field", body: `[{"id": 77, "pumpGpm": 1500}]`, wantErr: true},
+		{name: "lenient id", body: `[{"id": "77"}]`, wantErr: true},
+		{name: "lenient status", body: `[{"id": 77, "status": "in service"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = tt.body
+			c := &Client{httpClient: *ts.Client()}
+			WithStrictDecoding()(c)
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ApparatusList", http.NoBody)
+			err := c.doApiRequest(req, new(ApparatusList))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("doApiRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var sde *StrictDecodeError
+			if tt.wantErr && !errors.As(err, &sde) {
+				t.Errorf("error type %T, want *StrictDecodeError", err)
+			}
+		})
+	}
+}
+
+func TestClient_SchemaReport(t *testing.T) {
+	c := &Client{httpClient: testClient}
+
+	r := c.SchemaReport()
+	if len(r.Endpoints) != len(schemaEndpoints) {
+		t.Fatalf("got %d endpoints, want %d", len(r.Endpoints), len(schemaEndpoints))
+	}
+
+	for _, e := range r.Endpoints {
+		if e.Error != nil {
+			t.Errorf("%s: %v", e.Endpoint, e.Error)
+		}
+	}
+
+	if r.HasDrift() {
+		t.Errorf("unexpected drift:\n%s", r)
+	}
+
+	if r.Endpoints[0].Shape[".name"] != "string" {
+		t.Errorf("unexpected Subscriber shape %v", r.Endpoints[0].Shape)
+	}
+}
@@ -0,0 +1,95 @@
+package iarapi
+
+import "context"
+
+// Tracer starts spans around the client's login steps and API requests.  It is a generic hook rather than an
+// OpenTelemetry API: this module doesn't depend on any tracing library, so an OpenTelemetry (or other) tracer is
+// plugged in by wrapping it, for example:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string) (context.Context, iarapi.Span) {
+//		ctx, s := o.t.Start(ctx, name)
+//		return ctx, otelSpan{s}
+//	}
+//
+//	type otelSpan struct{ s trace.Span }
+//
+//	func (o otelSpan) SetAttributes(attrs ...iarapi.Attribute) {
+//		for _, a := range attrs {
+//			switch v := a.Value.(type) {
+//			case string:
+//				o.s.SetAttributes(attribute.String(a.Key, v))
+//			case int:
+//				o.s.SetAttributes(attribute.Int(a.Key, v))
+//			case bool:
+//				o.s.SetAttributes(attribute.Bool(a.Key, v))
+//			}
+//		}
+//	}
+//
+//	func (o otelSpan) RecordError(err error) {
+//		o.s.RecordError(err)
+//		o.s.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (o otelSpan) End() { o.s.End() }
+//
+// Spans are named iarapi.login, iarapi.fetchRequestToken, iarapi.doLogin, iarapi.dashboardLogin and iarapi.request.
+// When an expired session is renewed, the login spans are children of the iarapi.request span which resent the
+// request.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a span attribute.  Values are strings, ints or bools.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span attribute keys
+const (
+	AttrHTTPMethod     = "http.method"
+	AttrHTTPStatusCode = "http.status_code"
+	AttrEndpoint       = "iarapi.endpoint"
+
+	// AttrRetries is the number of times a request was resent, after logging in again when the session expired
+	AttrRetries = "iarapi.retries"
+)
+
+// WithTracer creates spans for the login steps and API requests using t
+func WithTracer(t Tracer) ClientOption {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span using the client's tracer, or returns a span which does nothing if there is no tracer
+func (c *Client) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return c.tracer.Start(ctx, name)
+}
+
+// endSpan records err, if not nil, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,234 @@
+package iarapi
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	if p, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = p.name
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) names() [][2]string {
+	names := make([][2]string, 0, len(t.spans))
+	for _, s := range t.spans {
+		names = append(names, [2]string{s.name, s.parent})
+	}
+	return names
+}
+
+func TestClient_loginSpans(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		dashboard int
+		want      [][2]string
+		wantErr   bool
+	}{
+		{
+			name: "good",
+			user: "good",
+			want: [][2]string{
+				{"iarapi.login", ""},
+				{"iarapi.fetchRequestToken", "iarapi.login"},
+				{"iarapi.doLogin", "iarapi.login"},
+				{"iarapi.dashboardLogin", "iarapi.doLogin"},
+			},
+		},
+		{
+			name: "bad credentials",
+			user: "bad",
+			want: [][2]string{
+				{"iarapi.login", ""},
+				{"iarapi.fetchRequestToken", "iarapi.login"},
+				{"iarapi.doLogin", "iarapi.login"},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "dashboard error",
+			user:      "good",
+			dashboard: http.StatusInternalServerError,
+			want: [][2]string{
+				{"iarapi.login", ""},
+				{"iarapi.fetchRequestToken", "iarapi.login"},
+				{"iarapi.doLogin", "iarapi.login"},
+				{"iarapi.dashboardLogin", "iarapi.doLogin"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := new(recordingTracer)
+			c := &Client{httpClient: testClient}
+			WithTracer(tr)(c)
+
+			if tt.dashboard > 0 {
+				ds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tt.dashboard)
+				}))
+				defer ds.Close()
+				c.dashboardEndpoint = ds.URL
+			}
+
+			err := c.login("good", tt.user, "good")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := tr.names(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spans = %v, want %v", got, tt.want)
+			}
+
+			for _, s := range tr.spans {
+				if !s.ended {
+					t.Errorf("span %s not ended", s.name)
+				}
+			}
+
+			if tt.wantErr && tr.spans[0].err == nil {
+				t.Error("login span has no error")
+			}
+
+			if last := tr.spans[len(tr.spans)-1]; tt.dashboard > 0 && last.err == nil {
+				t.Errorf("%s span has no error", last.name)
+			}
+		})
+	}
+}
+
+func TestClient_requestSpan(t *testing.T) {
+	tr := new(recordingTracer)
+	c := &Client{httpClient: testClient}
+	WithTracer(tr)(c)
+
+	if _, err := c.Member(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		AttrHTTPMethod:     http.MethodGet,
+		AttrEndpoint:       "/Member",
+		AttrHTTPStatusCode: http.StatusOK,
+		AttrRetries:        0,
+	}
+
+	if len(tr.spans) != 1 || tr.spans[0].name != "iarapi.request" || !tr.spans[0].ended {
+		t.Fatalf("spans = %v", tr.names())
+	}
+
+	if got := tr.spans[0].attrs; !reflect.DeepEqual(got, want) {
+		t.Errorf("attributes = %v, want %v", got, want)
+	}
+}
+
+func TestClient_resendSpan(t *testing.T) {
+	var calls int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request finds the session expired
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sendResponse(w, r, &memberInfoGood)
+	}))
+	defer api.Close()
+
+	tr := new(recordingTracer)
+	c := &Client{httpClient: testClient}
+	WithTracer(tr)(c)
+
+	if err := c.login("good", "good", "good"); err != nil {
+		t.Fatal(err)
+	}
+	WithEndpoints("", "", api.URL)(c)
+	tr.spans = nil
+
+	if _, err := c.Member(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]string{
+		{"iarapi.request", ""},
+		{"iarapi.login", "iarapi.request"},
+		{"iarapi.fetchRequestToken", "iarapi.login"},
+		{"iarapi.doLogin", "iarapi.login"},
+		{"iarapi.dashboardLogin", "iarapi.doLogin"},
+	}
+	if got := tr.names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %v, want %v", got, want)
+	}
+
+	if got := tr.spans[0].attrs; got[AttrRetries] != 1 || got[AttrHTTPStatusCode] != http.StatusOK {
+		t.Errorf("request span attributes = %v, want 1 retry and status 200", got)
+	}
+}
+
+func TestClient_debugRedacts(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := &Client{httpClient: testClient}
+	WithLogger(PrintfLogger(log.New(buf, "", 0)))(c)
+
+	if err := c.login("good", "good", "good"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Member(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "api request") || !strings.Contains(out, "endpoint=/Member") {
+		t.Errorf("missing request log:\n%s", out)
+	}
+
+	for _, s := range []string{"CookieConsent=yes", "Input.Password:[good]", "Input.Username:[good]"} {
+		if strings.Contains(out, s) {
+			t.Errorf("log contains %q:\n%s", s, out)
+		}
+	}
+
+	if !strings.Contains(out, "Input.Password:["+Redacted+"]") {
+		t.Errorf("password not redacted:\n%s", out)
+	}
+}
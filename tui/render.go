@@ -0,0 +1,234 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiBold    = "\x1b[1m"
+	ansiReverse = "\x1b[7m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiReset   = "\x1b[0m"
+)
+
+// View is the state rendered to the terminal
+type View struct {
+	Agency string
+	Now    time.Time
+
+	// Incidents and Messages are shown newest first, Responders by Order then ETA
+	Incidents  iarapi.IncidentList
+	Responders iarapi.ResponderList
+	Messages   iarapi.MessageList
+
+	// OnDuty are the on duty destinations
+	OnDuty []string
+
+	// Codes name the board's response codes, the first 9 are bound to the keys 1 to 9 if Respond is set
+	Codes   []*iarapi.ResponderCode
+	Respond bool
+
+	// Status is shown in the footer, like the result of the last response
+	Status string
+
+	Width  int
+	Height int
+}
+
+// Render draws the view as a full screen of ANSI text: a header, the latest incidents, the responder board, the
+// messages, the on duty destinations, and a footer with the keyboard shortcuts.  The board gets the rows left over.
+func Render(w io.Writer, v *View) error {
+	width, height := v.Width, v.Height
+	if width < 40 {
+		width = 40
+	}
+
+	if height < 16 {
+		height = 16
+	}
+
+	var lines []string
+	add := func(s string) {
+		lines = append(lines, s)
+	}
+
+	now := v.Now
+	add(ansiReverse + fit(" "+v.Agency, width-9) + now.Local().Format("15:04:05") + " " + ansiReset)
+
+	incidents := latest(v.Incidents, 3)
+	add(section("Incidents", width))
+	if len(incidents) < 1 {
+		add("  none")
+	}
+	for _, inc := range incidents {
+		add(fit("  "+arrived(inc)+"  "+strings.Join(strings.Fields(inc.MessageBody), " "), width))
+	}
+
+	messages := recentMessages(v.Messages, 3)
+	onDuty := strings.Join(v.OnDuty, ", ")
+
+	// header, four section titles, incidents, board heading, messages, on duty and footer
+	used := 1 + 4 + max(len(incidents), 1) + 1 + max(len(messages), 1) + 1 + 1
+	rows := height - used
+
+	board := sortBoard(v.Responders)
+	add(section(fmt.Sprintf("Responders (%d)", len(board)), width))
+	add(ansiBold + fit(fmt.Sprintf("  %-22s %-18s %-16s %s", "NAME", "DESTINATION", "RESPONSE", "ETA"), width) +
+		ansiReset)
+
+	names := make(map[int]string)
+	for _, c := range v.Codes {
+		names[c.Id] = c.KeyEntry
+	}
+
+	for i, r := range board {
+		if i >= rows-1 && len(board) > rows {
+			add(fmt.Sprintf("  ... %d more", len(board)-i))
+			break
+		}
+
+		eta, color := countdown(r.EtaBefore, now)
+		name := r.Name
+		if r.IsMutualAid {
+			name += " (MA)"
+		}
+
+		row := fmt.Sprintf("  %-22s %-18s %-16s ", clip(name, 22), clip(r.RespondingTo, 18),
+			clip(names[r.ResponseCodeId], 16))
+		add(fit(row, width-len(eta)) + color + eta + ansiReset)
+	}
+
+	for i := len(board); i < rows; i++ {
+		add("")
+	}
+
+	add(section("Messages", width))
+	if len(messages) < 1 {
+		add("  none")
+	}
+	for _, m := range messages {
+		add(fit("  "+m.CreatedDate.Local().Format("01-02 15:04")+"  "+strings.Join(strings.Fields(m.Message), " "), width))
+	}
+
+	add(section("On Duty At", width))
+	add(fit("  "+onDuty, width))
+
+	keys := make([]string, 0, 11)
+	for i, c := range v.Codes {
+		if !v.Respond || i >= 9 {
+			break
+		}
+		keys = append(keys, fmt.Sprintf("[%d] %s", i+1, c.KeyEntry))
+	}
+	keys = append(keys, "[r] refresh", "[q] quit")
+
+	footer := strings.Join(keys, "  ")
+	if len(v.Status) > 0 {
+		footer = v.Status + "  |  " + footer
+	}
+	add(ansiReverse + fit(" "+footer, width) + ansiReset)
+
+	_, err := io.WriteString(w, ansiClear+strings.Join(lines, "\r\n"))
+	return err
+}
+
+// arrived formats the incident arrival time in the local zone.  Times without a zone offset are already the agency's
+// local time, which is shown as is.
+func arrived(inc *iarapi.Incident) string {
+	if t, err := inc.ArrivedTimeIn(time.Local); err == nil {
+		return t.Local().Format("01-02 15:04")
+	}
+	return inc.ArrivedOn
+}
+
+// sortBoard returns the responders ordered by Order, then ETA, then name
+func sortBoard(rl iarapi.ResponderList) iarapi.ResponderList {
+	board := append(iarapi.ResponderList(nil), rl...)
+	sort.SliceStable(board, func(i, j int) bool {
+		a, b := board[i], board[j]
+		switch {
+		case a.Order != b.Order:
+			return a.Order < b.Order
+		case !a.EtaBefore.Equal(b.EtaBefore):
+			return a.EtaBefore.Before(b.EtaBefore)
+		default:
+			return a.Name < b.Name
+		}
+	})
+	return board
+}
+
+// countdown returns the time remaining until eta as m:ss, with the color to show it in
+func countdown(eta, now time.Time) (string, string) {
+	if eta.IsZero() || eta.Year() < 2000 {
+		return "-", ""
+	}
+
+	d := eta.Sub(now).Round(time.Second)
+	if d <= 0 {
+		return "arrived", ansiGreen
+	}
+	return fmt.Sprintf("%d:%02d", int(d/time.Minute), int(d%time.Minute/time.Second)), ansiYellow
+}
+
+func latest(il iarapi.IncidentList, n int) iarapi.IncidentList {
+	sorted := append(iarapi.IncidentList(nil), il...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id > sorted[j].Id })
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func recentMessages(ml iarapi.MessageList, n int) iarapi.MessageList {
+	sorted := append(iarapi.MessageList(nil), ml...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedDate.After(sorted[j].CreatedDate) })
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func section(title string, width int) string {
+	s := "── " + title + " "
+	return ansiBold + s + strings.Repeat("─", max(width-utf8.RuneCountInString(s), 0)) + ansiReset
+}
+
+// fit truncates or pads s to n runes
+func fit(s string, n int) string {
+	c := utf8.RuneCountInString(s)
+	if c > n {
+		return clip(s, n)
+	}
+	return s + strings.Repeat(" ", n-c)
+}
+
+// clip truncates s to n runes, ending it with an ellipsis if it was truncated
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	if n < 1 {
+		return ""
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
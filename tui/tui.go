@@ -0,0 +1,239 @@
+// Package tui is a terminal dashboard for the station desk, showing the latest incidents, the responder board with
+// ETA countdowns, messages and on duty destinations, updated from an iarapi.Watcher.  Given a Responder, the number
+// keys respond using the agency's response codes.
+//
+// The App reads single key presses from its input, so the terminal should be in cbreak mode, without echo.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// Source is the subset of the iarapi.Client methods used by the App, besides those polled by the watcher
+type Source interface {
+	Subscriber() (*iarapi.SubscriberInfo, error)
+	Messages() (*iarapi.MessageList, error)
+	ResponderCodes() (*iarapi.ResponderCodes, error)
+	OnDutyAtCodes() (*iarapi.OnDutyAtCodeList, error)
+}
+
+// Responder sets the logged in member's response on the responder board to a response code
+type Responder interface {
+	Respond(codeId int) (*iarapi.Responder, error)
+}
+
+// App runs the dashboard
+type App struct {
+	// Size returns the terminal width and height, 80 by 24 if nil
+	Size func() (int, int)
+
+	// Responder, if set, responds with the code bound to a number key.  The number keys do nothing if nil.
+	Responder Responder
+
+	src     Source
+	watcher *iarapi.Watcher
+	in      io.Reader
+	out     io.Writer
+	now     func() time.Time
+
+	mu       sync.Mutex
+	agency   string
+	messages iarapi.MessageList
+	onDuty   []string
+	codes    []*iarapi.ResponderCode
+	status   string
+}
+
+// NewApp returns an App reading keys from in and drawing to out.  The watcher must be run separately, and should
+// have been polled at least once so there is a board to show.
+func NewApp(src Source, w *iarapi.Watcher, in io.Reader, out io.Writer) *App {
+	return &App{src: src, watcher: w, in: in, out: out, now: time.Now}
+}
+
+// Run loads the agency details, then redraws the screen every second and for each watcher event, until ctx is
+// done, q is pressed, or the input is closed
+func (a *App) Run(ctx context.Context) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	ch, stop := a.watcher.Subscribe(16)
+	defer stop()
+
+	keys := make(chan byte)
+	go readKeys(a.in, keys)
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		if err := a.draw(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-ch:
+			a.handle(e)
+		case <-t.C:
+		case k, ok := <-keys:
+			if !ok || k == 'q' || k == 'Q' {
+				return nil
+			}
+			a.key(ctx, k)
+		}
+	}
+}
+
+// load fetches the agency name, messages, response codes and on duty destinations
+func (a *App) load() error {
+	si, err := a.src.Subscriber()
+	if err != nil {
+		return err
+	}
+
+	ml, err := a.src.Messages()
+	if err != nil {
+		return err
+	}
+
+	rc, err := a.src.ResponderCodes()
+	if err != nil {
+		return err
+	}
+
+	od, err := a.src.OnDutyAtCodes()
+	if err != nil {
+		return err
+	}
+
+	codes := append([]*iarapi.ResponderCode(nil), rc.ResponseCodes...)
+	sort.SliceStable(codes, func(i, j int) bool {
+		if codes[i].CustomSortOrder == codes[j].CustomSortOrder {
+			return codes[i].Id < codes[j].Id
+		}
+		return codes[i].CustomSortOrder < codes[j].CustomSortOrder
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.agency = si.Name
+	a.messages = append(iarapi.MessageList(nil), *ml...)
+	a.codes = codes
+	a.onDuty = make([]string, 0, len(*od))
+	for _, c := range *od {
+		a.onDuty = append(a.onDuty, c.KeyEntry)
+	}
+	return nil
+}
+
+// handle records new messages.  Incidents and responders are read from the watcher when drawing.
+func (a *App) handle(e *iarapi.WatchEvent) {
+	if e.Type != iarapi.EventMessageAdded {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.messages = append(a.messages, e.Message)
+}
+
+// key responds with the code bound to a number key, or polls the watcher for r.  Both run in the background, as the
+// poll sends events to this app and the response may be slow.
+func (a *App) key(ctx context.Context, k byte) {
+	switch {
+	case k == 'r' || k == 'R':
+		a.setStatus("refreshing")
+		go a.poll(ctx, "refreshed")
+	case k >= '1' && k <= '9' && a.Responder != nil:
+		a.mu.Lock()
+		i := int(k - '1')
+		var code *iarapi.ResponderCode
+		if i < len(a.codes) {
+			code = a.codes[i]
+		}
+		a.mu.Unlock()
+
+		if code == nil {
+			return
+		}
+
+		a.setStatus("responding " + code.KeyEntry)
+		go func() {
+			if _, err := a.Responder.Respond(code.Id); err != nil {
+				a.setStatus(fmt.Sprintf("responding %s failed: %v", code.KeyEntry, err))
+				return
+			}
+			a.poll(ctx, "responded "+code.KeyEntry)
+		}()
+	}
+}
+
+func (a *App) poll(ctx context.Context, done string) {
+	if _, err := a.watcher.Poll(ctx); err != nil {
+		a.setStatus("refresh failed: " + err.Error())
+		return
+	}
+	a.setStatus(done)
+}
+
+func (a *App) setStatus(s string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = s
+}
+
+// view returns the current state to render
+func (a *App) view() *View {
+	il, rl := a.watcher.Current()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	v := &View{
+		Agency:     a.agency,
+		Now:        a.now(),
+		Incidents:  il,
+		Responders: rl,
+		Messages:   append(iarapi.MessageList(nil), a.messages...),
+		OnDuty:     a.onDuty,
+		Codes:      a.codes,
+		Status:     a.status,
+		Respond:    a.Responder != nil,
+		Width:      80,
+		Height:     24,
+	}
+
+	if a.Size != nil {
+		v.Width, v.Height = a.Size()
+	}
+	return v
+}
+
+func (a *App) draw() error {
+	return Render(a.out, a.view())
+}
+
+// readKeys sends each byte read from r, closing keys when r fails
+func readKeys(r io.Reader, keys chan<- byte) {
+	defer close(keys)
+
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		keys <- b
+	}
+}
@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+// the client is the Responder used by iartui
+var _ Responder = (*iarapi.Client)(nil)
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeSource struct {
+	mu        sync.Mutex
+	responded []int
+}
+
+func (f *fakeSource) Subscriber() (*iarapi.SubscriberInfo, error) {
+	return &iarapi.SubscriberInfo{Name: "Test Fire Company"}, nil
+}
+
+func (f *fakeSource) Incidents() (*iarapi.IncidentList, error) {
+	return &iarapi.IncidentList{{Id: 1, ArrivedOn: "2024-03-01T11:50:00", MessageBody: "STRUCTURE FIRE 100 MAIN ST"}}, nil
+}
+
+func (f *fakeSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &iarapi.ResponderList{{Id: "r-1", Name: "Smith", RespondingTo: "Station", ResponseCodeId: 1}}, nil
+}
+
+func (f *fakeSource) Messages() (*iarapi.MessageList, error) {
+	return &iarapi.MessageList{{Id: "m-1", Message: "Monthly meeting", CreatedDate: testNow}}, nil
+}
+
+func (f *fakeSource) ResponderCodes() (*iarapi.ResponderCodes, error) {
+	return &iarapi.ResponderCodes{ResponseCodes: []*iarapi.ResponderCode{
+		{Id: 3, KeyEntry: "Not Responding", CustomSortOrder: 3},
+		{Id: 1, KeyEntry: "Station", CustomSortOrder: 1},
+		{Id: 2, KeyEntry: "Scene", CustomSortOrder: 2},
+	}}, nil
+}
+
+func (f *fakeSource) OnDutyAtCodes() (*iarapi.OnDutyAtCodeList, error) {
+	return &iarapi.OnDutyAtCodeList{{Id: "od-1", KeyEntry: "Station 1"}}, nil
+}
+
+func (f *fakeSource) Respond(codeId int) (*iarapi.Responder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responded = append(f.responded, codeId)
+	return &iarapi.Responder{Id: "r-1", ResponseCodeId: codeId}, nil
+}
+
+func (f *fakeSource) Responded() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.responded...)
+}
+
+func TestSortBoard(t *testing.T) {
+	rl := iarapi.ResponderList{
+		{Id: "a", Name: "Later", Order: 1, EtaBefore: testNow.Add(10 * time.Minute)},
+		{Id: "b", Name: "Officer", Order: 0, EtaBefore: testNow.Add(20 * time.Minute)},
+		{Id: "c", Name: "Sooner", Order: 1, EtaBefore: testNow.Add(5 * time.Minute)},
+		{Id: "d", Name: "Adams", Order: 1, EtaBefore: testNow.Add(5 * time.Minute)},
+	}
+
+	var got []string
+	for _, r := range sortBoard(rl) {
+		got = append(got, r.Id)
+	}
+
+	if want := []string{"b", "d", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortBoard() = %v, want %v", got, want)
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	tests := []struct {
+		name string
+		eta  time.Time
+		want string
+	}{
+		{name: "none", want: "-"},
+		{name: "minutes", eta: testNow.Add(4*time.Minute + 5*time.Second), want: "4:05"},
+		{name: "seconds", eta: testNow.Add(9 * time.Second), want: "0:09"},
+		{name: "arrived", eta: testNow.Add(-time.Minute), want: "arrived"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := countdown(tt.eta, testNow); got != tt.want {
+				t.Errorf("countdown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	v := &View{
+		Agency: "Test Fire Company",
+		Now:    testNow,
+		Responders: iarapi.ResponderList{
+			{Id: "r-1", Name: "Smith", RespondingTo: "Station", ResponseCodeId: 1, EtaBefore: testNow.Add(3 * time.Minute)},
+			{Id: "r-2", Name: "Jones", RespondingTo: "Scene", ResponseCodeId: 2, IsMutualAid: true},
+		},
+		OnDuty:  []string{"Station 1", "Station 2"},
+		Codes:   []*iarapi.ResponderCode{{Id: 1, KeyEntry: "Station"}, {Id: 2, KeyEntry: "Scene"}},
+		Status:  "responded Station",
+		Respond: true,
+		Width:   80,
+		Height:  24,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Render(buf, v); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if lines := strings.Count(out, "\r\n") + 1; lines != v.Height {
+		t.Errorf("rendered %d lines, want %d", lines, v.Height)
+	}
+
+	for _, s := range []string{"Test Fire Company", "Responders (2)", "3:00", "Jones (MA)", "Station 1, Station 2",
+		"[1] Station  [2] Scene", "responded Station"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output does not contain %q", s)
+		}
+	}
+
+	if strings.Index(out, "Jones") > strings.Index(out, "Smith") {
+		t.Error("responder without an ETA not listed first")
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		v.Responders = nil
+		for i := 0; i < 30; i++ {
+			v.Responders = append(v.Responders, &iarapi.Responder{Name: "Member", RespondingTo: "Station"})
+		}
+
+		buf.Reset()
+		if err := Render(buf, v); err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		if lines := strings.Count(out, "\r\n") + 1; lines != v.Height {
+			t.Errorf("rendered %d lines, want %d", lines, v.Height)
+		}
+
+		if !strings.Contains(out, "more") {
+			t.Error("output does not show the hidden responders")
+		}
+	})
+}
+
+func TestRender_ArrivedTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("EST", -5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	v := &View{
+		Now: testNow,
+		Incidents: iarapi.IncidentList{
+			{Id: 1, ArrivedOn: "2024-03-01T11:50:00", MessageBody: "LOCAL"},
+			{Id: 2, ArrivedOn: "2024-03-01T16:55:00Z", MessageBody: "OFFSET"},
+		},
+		Width:  80,
+		Height: 24,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Render(buf, v); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"03-01 11:50  LOCAL", "03-01 11:55  OFFSET"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output does not contain %q", s)
+		}
+	}
+}
+
+func TestApp_Run(t *testing.T) {
+	src := new(fakeSource)
+	w := iarapi.NewWatcher(src)
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	in, keys := io.Pipe()
+	out := new(bytes.Buffer)
+
+	app := NewApp(src, w, in, out)
+	app.Responder = src
+	app.now = func() time.Time { return testNow }
+
+	done := make(chan error)
+	go func() {
+		done <- app.Run(context.Background())
+	}()
+
+	// keys 2 and 9 are bound to the second code and nothing
+	if _, err := keys.Write([]byte("29")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the response is sent in the background
+	for i := 0; i < 200 && len(src.Responded()) < 1; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := keys.Write([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after q")
+	}
+
+	if want := []int{2}; !reflect.DeepEqual(src.Responded(), want) {
+		t.Errorf("responded = %v, want %v", src.Responded(), want)
+	}
+
+	if s := out.String(); !strings.Contains(s, "STRUCTURE FIRE") || !strings.Contains(s, "Monthly meeting") {
+		t.Error("output does not contain the incident and message")
+	}
+}
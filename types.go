@@ -4,11 +4,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Client struct {
-	httpClient http.Client
+	httpClient        http.Client
+	loginEndpoint     string
+	dashboardEndpoint string
+	apiEndpoint       string
+	driftHandler      func(*SchemaDrift)
+	strict            bool
+	cache             *responseCache
+	observer          Observer
+	tracer            Tracer
+	logger            Logger
+
+	// the login is renewed when the session expires, loginGen counts the renewals
+	agency   string
+	username string
+	password string
+	loginMu  sync.Mutex
+	loginGen int
 }
 
 type LoginRequest struct {
@@ -70,88 +90,163 @@ type SubscriberInfo struct {
 	NameForDispatcherUse     string `json:"nameForDispatcherUse"`
 	TtdToggleInDashboard     bool   `json:"ttdToggleInDashboard"`
 	AllowSpecialShifts       bool   `json:"allowSpecialShifts"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type MemberInfo struct {
-	Id                                 int         `json:"memberId"`
-	SubscriberId                       int         `json:"subscriberId"`
-	FirstName                          string      `json:"firstName"`
-	LastName                           string      `json:"lastName"`
-	ProfileImage                       string      `json:"profileImage"`
-	MaxTimeEmergencyMode               int         `json:"maxTimeEmergencyMode"`
-	ClearNow                           bool        `json:"clearNow"`
-	ColorBorder                        int         `json:"colorBorder"`
-	CanEditOwnSchedule                 bool        `json:"canEditOwnSchedule"`
-	CanEditAllSchedules                bool        `json:"canEditAllSchedules"`
-	AllowOwnPCFScheduling              bool        `json:"allowOwnPCFScheduling"`
-	AllowOwnCFScheduling               bool        `json:"allowOwnCFScheduling"`
-	CanManageEvents                    bool        `json:"canManageEvents"`
-	AllowManageHydrants                bool        `json:"allowManageHydrants"`
-	AllowDeleteHydrants                bool        `json:"allowDeleteHydrants"`
-	AllowManageMarkers                 bool        `json:"allowManageMarkers"`
-	AllowDeleteMarkers                 bool        `json:"allowDeleteMarkers"`
-	PermittedToVerifyIncidentAddresses bool        `json:"permittedToVerifyIncidentAddresses"`
-	PermittedToCreateGeofence          bool        `json:"permittedToCreateGeofence"`
-	DefaultRespondNow                  string      `json:"defaultRespondNow"`
-	Position                           string      `json:"position"`
-	ReminderShifts                     string      `json:"reminderShifts"`
-	PositionId                         int         `json:"positionId"`
-	AllowToggleEmergencyDD             bool        `json:"allowToggleEmergencyDD"`
-	AllowEditOwnProfile                bool        `json:"allowEditOwnProfile"`
-	PermittedChangePage6               bool        `json:"permittedChangePage6"`
-	AllowEditScrollMessage             bool        `json:"allowEditScrollMessage"`
-	DefaultLocation                    string      `json:"defaultLocation"`
-	DefaultCategory                    int         `json:"defaultCategory"`
-	DefaultShiftDuration               int         `json:"defaultShiftDuration"`
-	DoNotDisturb                       int         `json:"doNotDisturb"`
-	DoNotDisturbStartTime              string      `json:"doNotDisturbStartTime"`
-	DoNotDisturbFinishTime             string      `json:"doNotDisturbFinishTime"`
-	TextMessageAddressDND              bool        `json:"textMessageAddressDND"`
-	AppPushNotificationsDND            bool        `json:"appPushNotificationsDND"`
-	DoNotDisturbDevice                 bool        `json:"doNotDisturbDevice"`
-	DeviceToken                        interface{} `json:"deviceToken"`
-	DeviceActive                       bool        `json:"deviceActive"`
-	MemberEmail                        string      `json:"memberEmail"`
-	SecondaryEmail                     string      `json:"secondaryEmail"`
-	TextMemberAddress                  string      `json:"textMemberAddress"`
+	Id                                 int             `json:"memberId"`
+	SubscriberId                       int             `json:"subscriberId"`
+	FirstName                          string          `json:"firstName"`
+	LastName                           string          `json:"lastName"`
+	ProfileImage                       string          `json:"profileImage"`
+	MaxTimeEmergencyMode               int             `json:"maxTimeEmergencyMode"`
+	ClearNow                           bool            `json:"clearNow"`
+	ColorBorder                        int             `json:"colorBorder"`
+	CanEditOwnSchedule                 bool            `json:"canEditOwnSchedule"`
+	CanEditAllSchedules                bool            `json:"canEditAllSchedules"`
+	AllowOwnPCFScheduling              bool            `json:"allowOwnPCFScheduling"`
+	AllowOwnCFScheduling               bool            `json:"allowOwnCFScheduling"`
+	CanManageEvents                    bool            `json:"canManageEvents"`
+	AllowManageHydrants                bool            `json:"allowManageHydrants"`
+	AllowDeleteHydrants                bool            `json:"allowDeleteHydrants"`
+	AllowManageMarkers                 bool            `json:"allowManageMarkers"`
+	AllowDeleteMarkers                 bool            `json:"allowDeleteMarkers"`
+	PermittedToVerifyIncidentAddresses bool            `json:"permittedToVerifyIncidentAddresses"`
+	PermittedToCreateGeofence          bool            `json:"permittedToCreateGeofence"`
+	DefaultRespondNow                  string          `json:"defaultRespondNow"`
+	Position                           string          `json:"position"`
+	ReminderShifts                     string          `json:"reminderShifts"`
+	PositionId                         int             `json:"positionId"`
+	AllowToggleEmergencyDD             bool            `json:"allowToggleEmergencyDD"`
+	AllowEditOwnProfile                bool            `json:"allowEditOwnProfile"`
+	PermittedChangePage6               bool            `json:"permittedChangePage6"`
+	AllowEditScrollMessage             bool            `json:"allowEditScrollMessage"`
+	DefaultLocation                    string          `json:"defaultLocation"`
+	DefaultCategory                    int             `json:"defaultCategory"`
+	DefaultShiftDuration               int             `json:"defaultShiftDuration"`
+	DoNotDisturb                       int             `json:"doNotDisturb"`
+	DoNotDisturbStartTime              string          `json:"doNotDisturbStartTime"`
+	DoNotDisturbFinishTime             string          `json:"doNotDisturbFinishTime"`
+	TextMessageAddressDND              bool            `json:"textMessageAddressDND"`
+	AppPushNotificationsDND            bool            `json:"appPushNotificationsDND"`
+	DoNotDisturbDevice                 bool            `json:"doNotDisturbDevice"`
+	DeviceToken                        json.RawMessage `json:"deviceToken"`
+	DeviceActive                       bool            `json:"deviceActive"`
+	MemberEmail                        string          `json:"memberEmail"`
+	SecondaryEmail                     string          `json:"secondaryEmail"`
+	TextMemberAddress                  string          `json:"textMemberAddress"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type Incident struct {
-	Id                      int         `json:"id"`
-	ArrivedOn               string      `json:"arrivedOn"`
-	MessageBody             string      `json:"messageBody"`
-	DestinationEmailAddress string      `json:"destinationEmailAddress"`
-	OriginationEmailAddress string      `json:"originationEmailAddress"`
-	SubscriberId            int         `json:"subscriberId"`
-	VerifiedAddressStatus   int         `json:"verifiedAddressStatus"`
-	ArrivedOnString         string      `json:"arrivedOnString"`
-	Index                   int         `json:"index"`
-	Address                 string      `json:"address"`
-	Location                string      `json:"location"`
-	Direction               interface{} `json:"direction"`
-	VerifiedStreetNumber    string      `json:"verifiedStreetNumber"`
-	VerifiedStreetName      string      `json:"verifiedStreetName"`
-	VerifiedCity            string      `json:"verifiedCity"`
-	VerifiedState           string      `json:"verifiedState"`
-	VerifiedCountry         string      `json:"verifiedCountry"`
-	LongDirection           string      `json:"longDirection"`
-	HasCoordinatesInBoddy   bool        `json:"hasCoordinatesInBoddy"`
-	IsVerifiedAndActive     bool        `json:"isVerifiedAndActive"`
-	AddedBy                 interface{} `json:"addedBy"`
-	AddedOn                 string      `json:"addedOn"`
-	LastUpdatedBy           interface{} `json:"lastUpdatedBy"`
-	UpdatedOn               string      `json:"updatedOn"`
-	TimeZoneId              int         `json:"timeZoneId"`
-	IsDst                   bool        `json:"isDst"`
+	Id                      int                   `json:"id"`
+	ArrivedOn               string                `json:"arrivedOn"`
+	MessageBody             string                `json:"messageBody"`
+	DestinationEmailAddress string                `json:"destinationEmailAddress"`
+	OriginationEmailAddress string                `json:"originationEmailAddress"`
+	SubscriberId            int                   `json:"subscriberId"`
+	VerifiedAddressStatus   VerifiedAddressStatus `json:"verifiedAddressStatus"`
+	ArrivedOnString         string                `json:"arrivedOnString"`
+	Index                   int                   `json:"index"`
+	Address                 string                `json:"address"`
+	Location                string                `json:"location"`
+	Direction               json.RawMessage       `json:"direction"`
+	VerifiedStreetNumber    string                `json:"verifiedStreetNumber"`
+	VerifiedStreetName      string                `json:"verifiedStreetName"`
+	VerifiedCity            string                `json:"verifiedCity"`
+	VerifiedState           string                `json:"verifiedState"`
+	VerifiedCountry         string                `json:"verifiedCountry"`
+	LongDirection           string                `json:"longDirection"`
+	HasCoordinatesInBoddy   bool                  `json:"hasCoordinatesInBoddy"`
+	IsVerifiedAndActive     bool                  `json:"isVerifiedAndActive"`
+	AddedBy                 json.RawMessage       `json:"addedBy"`
+	AddedOn                 string                `json:"addedOn"`
+	LastUpdatedBy           json.RawMessage       `json:"lastUpdatedBy"`
+	UpdatedOn               string                `json:"updatedOn"`
+	TimeZoneId              int                   `json:"timeZoneId"`
+	IsDst                   bool                  `json:"isDst"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 type IncidentList []*Incident
 
+// ArrivedTime parses the ArrivedOn value.  Times without a zone offset are the agency's wall time, which is returned
+// with the UTC location; use ArrivedTimeIn to place them in the agency's zone.
+func (i *Incident) ArrivedTime() (time.Time, error) {
+	return parseApiTime(i.ArrivedOn)
+}
+
+// ArrivedTimeIn parses the ArrivedOn value, taking times without a zone offset to be the wall time in loc, or in
+// time.Local if loc is nil.  Times with an offset are returned unchanged.
+func (i *Incident) ArrivedTimeIn(loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, i.ArrivedOn); err == nil {
+		return t, nil
+	}
+
+	t, err := parseApiTime(i.ArrivedOn)
+	if err != nil {
+		return t, err
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
+
+// UpdatedTime parses the UpdatedOn value.  Times without a zone offset are the agency's wall time, which is returned
+// with the UTC location.
+func (i *Incident) UpdatedTime() (time.Time, error) {
+	return parseApiTime(i.UpdatedOn)
+}
+
+var (
+	labeledCoordinates = regexp.MustCompile(`(?i)\bLAT(?:ITUDE)?\s*[:=]?\s*(-?\d{1,2}\.\d+)[\s,;]*LON(?:G|GITUDE)?\s*[:=]?\s*(-?\d{1,3}\.\d+)`)
+	pairCoordinates    = regexp.MustCompile(`(-?\d{1,2}\.\d{4,})\s*,\s*(-?\d{1,3}\.\d{4,})`)
+)
+
+// Coordinates returns the location of the incident, if its Location or MessageBody contains a decimal latitude and
+// longitude, either labeled (like "LAT: 40.1234 LON: -75.1234") or as a pair (like "40.1234, -75.1234")
+func (i *Incident) Coordinates() (*Coordinates, bool) {
+	for _, s := range []string{i.Location, i.MessageBody} {
+		for _, re := range []*regexp.Regexp{labeledCoordinates, pairCoordinates} {
+			m := re.FindStringSubmatch(s)
+			if m == nil {
+				continue
+			}
+
+			lat, _ := strconv.ParseFloat(m[1], 64)
+			lng, _ := strconv.ParseFloat(m[2], 64)
+			if lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 {
+				return &Coordinates{Lat: lat, Lng: lng}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func parseApiTime(s string) (time.Time, error) {
+	var t time.Time
+	var err error
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"} {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
 type Message struct {
 	Id           string    `json:"id"`
 	MessageId    int       `json:"messageId"`
 	SubscriberId int       `json:"subscriberId"`
 	Message      string    `json:"message"`
 	CreatedDate  time.Time `json:"createdDate"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 type MessageList []*Message
 
@@ -159,11 +254,15 @@ type Dispatcher struct {
 	CentralizedId  int    `json:"centralizedId"`
 	DispatcherId   int    `json:"dispatcherId"`
 	DispatcherName string `json:"dispatcherName"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type Dispatchers struct {
 	SubscriberId int           `json:"subscriberId"`
 	Dispatchers  []*Dispatcher `json:"dispatchers"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type ResponderCode struct {
@@ -174,11 +273,15 @@ type ResponderCode struct {
 	IsTelephoneKey    bool   `json:"isTelephoneKey"`
 	IsDefaultKey      bool   `json:"isDefaultKey"`
 	CustomSortOrder   int    `json:"customSortOrder"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type ResponderCodes struct {
 	ResponseCodes []*ResponderCode `json:"responseCodes"`
 	TelephoneKeys []*ResponderCode `json:"telephoneKeys"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type Responder struct {
@@ -200,17 +303,117 @@ type Responder struct {
 	TimeZoneId     int       `json:"timeZoneId"`
 	IsDst          bool      `json:"isDst"`
 	ResponseCodeId int       `json:"responseCodeId"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 type ResponderList []*Responder
 
-// TODO - we don't know what this looks like
-type Apparatus struct{}
+type ApparatusStatus int
+
+const (
+	ApparatusStatusUnknown ApparatusStatus = iota
+	ApparatusInService
+	ApparatusOutOfService
+	ApparatusEnRoute
+	ApparatusOnScene
+)
+
+func (s ApparatusStatus) String() string {
+	switch s {
+	case ApparatusStatusUnknown:
+		return "Unknown"
+	case ApparatusInService:
+		return "InService"
+	case ApparatusOutOfService:
+		return "OutOfService"
+	case ApparatusEnRoute:
+		return "EnRoute"
+	case ApparatusOnScene:
+		return "OnScene"
+	}
+	return fmt.Sprintf("ApparatusStatus(%d)", int(s))
+}
+
+// UnmarshalJSON accepts the status as either the numeric value, or the name in any case with optional spaces,
+// underscores or dashes (like "in service" or "OUT_OF_SERVICE").  Unrecognized names decode as ApparatusStatusUnknown.
+func (s *ApparatusStatus) UnmarshalJSON(data []byte) error {
+	var n lenientInt
+	if err := n.UnmarshalJSON(data); err == nil {
+		*s = ApparatusStatus(n)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("invalid apparatus status %s", data)
+	}
+
+	name = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(name))
+	for st := ApparatusInService; st <= ApparatusOnScene; st++ {
+		if strings.ToLower(st.String()) == name {
+			*s = st
+			return nil
+		}
+	}
+
+	*s = ApparatusStatusUnknown
+	return nil
+}
+
+type ApparatusCrewMember struct {
+	MemberId int    `json:"memberId"`
+	Name     string `json:"name"`
+	Position string `json:"position"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Apparatus struct {
+	Id           int                    `json:"id"`
+	SubscriberId int                    `json:"subscriberId"`
+	Name         string                 `json:"name"`
+	Type         string                 `json:"type"`
+	Status       ApparatusStatus        `json:"status"`
+	Crew         []*ApparatusCrewMember `json:"crew"`
+	Location     Coordinates            `json:"location"`
+	UpdatedOn    string                 `json:"updatedOn"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes leniently, the ids may be either numbers or numeric strings, and preserves unmapped fields
+func (a *Apparatus) UnmarshalJSON(data []byte) error {
+	type apparatus Apparatus
+	aux := struct {
+		*apparatus
+		Id           lenientInt `json:"id"`
+		SubscriberId lenientInt `json:"subscriberId"`
+	}{apparatus: (*apparatus)(a)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.Id = int(aux.Id)
+	a.SubscriberId = int(aux.SubscriberId)
+
+	var err error
+	a.Extra, err = unknownFields(data, a)
+	return err
+}
+
+func (a Apparatus) MarshalJSON() ([]byte, error) {
+	type apparatus Apparatus
+	return encodeWithExtra(apparatus(a), a.Extra)
+}
+
 type ApparatusList []*Apparatus
 
 type OnDutyAtCode struct {
 	Id           string `json:"id"`
 	SubscriberId int    `json:"subscriberId"`
 	KeyEntry     string `json:"keyEntry"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 type OnDutyAtCodeList []*OnDutyAtCode
 
@@ -245,3 +448,136 @@ func (r IncidentSearchRequest) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(m)
 }
+
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type Hydrant struct {
+	Id               int         `json:"id"`
+	SubscriberId     int         `json:"subscriberId"`
+	Name             string      `json:"name"`
+	Address          string      `json:"address"`
+	Location         Coordinates `json:"location"`
+	Type             string      `json:"type"`
+	Color            string      `json:"color"`
+	FlowRate         int         `json:"flowRate"`
+	StaticPressure   float64     `json:"staticPressure"`
+	ResidualPressure float64     `json:"residualPressure"`
+	OutOfService     bool        `json:"outOfService"`
+	LastTested       time.Time   `json:"lastTested"`
+	Notes            string      `json:"notes"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+type HydrantList []*Hydrant
+
+type MarkerAttachment struct {
+	Id          int    `json:"id"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Url         string `json:"url"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Marker struct {
+	Id           int                 `json:"id"`
+	SubscriberId int                 `json:"subscriberId"`
+	Name         string              `json:"name"`
+	Category     string              `json:"category"`
+	Address      string              `json:"address"`
+	Location     Coordinates         `json:"location"`
+	Notes        string              `json:"notes"`
+	Attachments  []*MarkerAttachment `json:"attachments"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+type MarkerList []*Marker
+
+type GeofenceShape string
+
+const (
+	GeofencePolygon GeofenceShape = "polygon"
+	GeofenceCircle  GeofenceShape = "circle"
+)
+
+const (
+	GeofenceEnter = "enter"
+	GeofenceExit  = "exit"
+)
+
+// GeofenceTrigger describes the response recorded for a member when they cross the geofence boundary
+type GeofenceTrigger struct {
+	On             string `json:"on"`
+	ResponseCodeId int    `json:"responseCodeId"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Geofence struct {
+	Id           int                `json:"id"`
+	SubscriberId int                `json:"subscriberId"`
+	Name         string             `json:"name"`
+	Shape        GeofenceShape      `json:"shape"`
+	Center       Coordinates        `json:"center"`
+	Radius       float64            `json:"radius"`
+	Points       []Coordinates      `json:"points"`
+	Triggers     []*GeofenceTrigger `json:"triggers"`
+	IsActive     bool               `json:"isActive"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+type GeofenceList []*Geofence
+
+type Event struct {
+	Id           int       `json:"id"`
+	SubscriberId int       `json:"subscriberId"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Location     string    `json:"location"`
+	Category     string    `json:"category"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	AllDay       bool      `json:"allDay"`
+	UpdatedOn    time.Time `json:"updatedOn"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+type EventList []*Event
+
+type VerifiedAddressStatus int
+
+const (
+	AddressNotVerified VerifiedAddressStatus = iota
+	AddressVerified
+	AddressManuallyVerified
+	AddressVerificationFailed
+)
+
+func (s VerifiedAddressStatus) String() string {
+	switch s {
+	case AddressNotVerified:
+		return "NotVerified"
+	case AddressVerified:
+		return "Verified"
+	case AddressManuallyVerified:
+		return "ManuallyVerified"
+	case AddressVerificationFailed:
+		return "VerificationFailed"
+	}
+	return fmt.Sprintf("VerifiedAddressStatus(%d)", int(s))
+}
+
+// AddressVerification is the corrected address and/or coordinates submitted for an incident.  Location is optional,
+// if not provided the service will geocode the corrected address.
+type AddressVerification struct {
+	IncidentId   int          `json:"incidentId"`
+	StreetNumber string       `json:"verifiedStreetNumber"`
+	StreetName   string       `json:"verifiedStreetName"`
+	City         string       `json:"verifiedCity"`
+	State        string       `json:"verifiedState"`
+	Country      string       `json:"verifiedCountry"`
+	Location     *Coordinates `json:"location,omitempty"`
+}
@@ -0,0 +1,171 @@
+package iarapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifiedAddressStatus_String(t *testing.T) {
+	tests := []struct {
+		s    VerifiedAddressStatus
+		want string
+	}{
+		{s: AddressNotVerified, want: "NotVerified"},
+		{s: AddressVerified, want: "Verified"},
+		{s: AddressManuallyVerified, want: "ManuallyVerified"},
+		{s: AddressVerificationFailed, want: "VerificationFailed"},
+		{s: 42, want: "VerifiedAddressStatus(42)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.s.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApparatus_UnmarshalJSON(t *testing.T) {
+	data := `{"id": "77", "subscriberId": 654321, "name": "Engine 1", "STATUS": "out of service", "pumpGpm": 1500, "crew": null}`
+
+	a := new(Apparatus)
+	if err := json.Unmarshal([]byte(data), a); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Apparatus{
+		Id:           77,
+		SubscriberId: 654321,
+		Name:         "Engine 1",
+		Status:       ApparatusOutOfService,
+		Extra:        map[string]json.RawMessage{"pumpGpm": json.RawMessage("1500")},
+	}
+
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", a, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"id": "E1"}`), a); err == nil {
+		t.Error("expected error for non-numeric id")
+	}
+}
+
+func TestApparatusStatus_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    ApparatusStatus
+		wantErr bool
+	}{
+		{data: `3`, want: ApparatusEnRoute},
+		{data: `"4"`, want: ApparatusOnScene},
+		{data: `"In Service"`, want: ApparatusInService},
+		{data: `"en-route"`, want: ApparatusEnRoute},
+		{data: `"ON_SCENE"`, want: ApparatusOnScene},
+		{data: `"staged"`, want: ApparatusStatusUnknown},
+		{data: `null`, want: ApparatusStatusUnknown},
+		{data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var s ApparatusStatus
+			err := json.Unmarshal([]byte(tt.data), &s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if s != tt.want {
+				t.Errorf("Unmarshal() = %v, want %v", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncident_Coordinates(t *testing.T) {
+	tests := []struct {
+		name string
+		inc  Incident
+		want *Coordinates
+	}{
+		{
+			name: "location pair",
+			inc:  Incident{Location: "40.123456,-75.654321"},
+			want: &Coordinates{Lat: 40.123456, Lng: -75.654321},
+		},
+		{
+			name: "labeled in body",
+			inc:  Incident{MessageBody: "MVA 100 MAIN ST LAT: 40.1234 LONG: -75.4321 UNITS E1"},
+			want: &Coordinates{Lat: 40.1234, Lng: -75.4321},
+		},
+		{
+			name: "location preferred",
+			inc:  Incident{Location: "41.0000, -76.0000", MessageBody: "40.1234, -75.4321"},
+			want: &Coordinates{Lat: 41, Lng: -76},
+		},
+		{
+			name: "out of range",
+			inc:  Incident{MessageBody: "LAT 95.1234 LON -75.4321"},
+		},
+		{
+			name: "times are not coordinates",
+			inc:  Incident{MessageBody: "STRUCTURE FIRE 100 MAIN ST 12.30, 14.45"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.inc.Coordinates()
+			if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Coordinates() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncident_ArrivedTimeIn(t *testing.T) {
+	est := time.FixedZone("EST", -5*3600)
+
+	tests := []struct {
+		name      string
+		arrivedOn string
+		want      time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "no offset",
+			arrivedOn: "2022-11-04T10:00:00",
+			want:      time.Date(2022, 11, 4, 10, 0, 0, 0, est),
+		},
+		{
+			name:      "space separated",
+			arrivedOn: "2022-11-04 10:00:00",
+			want:      time.Date(2022, 11, 4, 10, 0, 0, 0, est),
+		},
+		{
+			name:      "offset",
+			arrivedOn: "2022-11-04T10:00:00Z",
+			want:      time.Date(2022, 11, 4, 5, 0, 0, 0, est),
+		},
+		{
+			name:      "bogus",
+			arrivedOn: "bogus",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Incident{ArrivedOn: tt.arrivedOn}).ArrivedTimeIn(est)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ArrivedTimeIn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ArrivedTimeIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
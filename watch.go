@@ -0,0 +1,261 @@
+package iarapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher polls if no interval is set
+const DefaultWatchInterval = 15 * time.Second
+
+// EventType identifies the kind of change reported by a Watcher
+type EventType string
+
+const (
+	EventIncidentAdded    EventType = "incident.added"
+	EventIncidentUpdated  EventType = "incident.updated"
+	EventResponderAdded   EventType = "responder.added"
+	EventResponderUpdated EventType = "responder.updated"
+	EventResponderRemoved EventType = "responder.removed"
+	EventMessageAdded     EventType = "message.added"
+)
+
+// WatchEvent is a change seen by a Watcher.  Only the field matching the event type is set.
+type WatchEvent struct {
+	Type      EventType  `json:"type"`
+	Time      time.Time  `json:"time"`
+	Incident  *Incident  `json:"incident,omitempty"`
+	Responder *Responder `json:"responder,omitempty"`
+	Message   *Message   `json:"message,omitempty"`
+}
+
+// WatchSource is the subset of the Client methods polled by a Watcher
+type WatchSource interface {
+	Incidents() (*IncidentList, error)
+	ResponderList() (*ResponderList, error)
+	Messages() (*MessageList, error)
+}
+
+type watchSubscriber struct {
+	ch   chan *WatchEvent
+	done chan struct{}
+}
+
+// Watcher polls the incident list, responder board and messages, and sends an event to each subscriber for every
+// change found.  The first poll records the current state without sending events, so restarting a watcher does not
+// repeat events for existing items.
+type Watcher struct {
+	// Interval is the time between polls, DefaultWatchInterval if 0
+	Interval time.Duration
+
+	// OnError is called with polling errors, which do not stop Run
+	OnError func(error)
+
+	src        WatchSource
+	mu         sync.Mutex
+	subs       []*watchSubscriber
+	primed     bool
+	incidents  map[int]*Incident
+	responders map[string]*Responder
+	messages   map[string]*Message
+	now        func() time.Time
+}
+
+func NewWatcher(src WatchSource) *Watcher {
+	return &Watcher{
+		src:        src,
+		incidents:  make(map[int]*Incident),
+		responders: make(map[string]*Responder),
+		messages:   make(map[string]*Message),
+		now:        time.Now,
+	}
+}
+
+// Subscribe returns a channel receiving events, with the given buffer size, and a function to stop the
+// subscription.  Polling waits for subscribers to receive each event, so the channel must be read until the
+// subscription is stopped.
+func (w *Watcher) Subscribe(buffer int) (<-chan *WatchEvent, func()) {
+	s := &watchSubscriber{ch: make(chan *WatchEvent, buffer), done: make(chan struct{})}
+
+	w.mu.Lock()
+	w.subs = append(w.subs, s)
+	w.mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			for i := range w.subs {
+				if w.subs[i] == s {
+					w.subs = append(w.subs[:i], w.subs[i+1:]...)
+					break
+				}
+			}
+			w.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+// Run polls at the watcher interval until ctx is done
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if _, err := w.Poll(ctx); err != nil && ctx.Err() == nil && w.OnError != nil {
+			w.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll fetches the current state once, sends events for the changes since the last poll to the subscribers, and
+// returns them.  If any fetch fails, no state is updated and no events are sent.
+func (w *Watcher) Poll(ctx context.Context) ([]*WatchEvent, error) {
+	il, err := w.src.Incidents()
+	if err != nil {
+		return nil, err
+	}
+
+	rl, err := w.src.ResponderList()
+	if err != nil {
+		return nil, err
+	}
+
+	ml, err := w.src.Messages()
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	events := w.diff(*il, *rl, *ml)
+	subs := append([]*watchSubscriber(nil), w.subs...)
+	w.mu.Unlock()
+
+	for _, e := range events {
+		for _, s := range subs {
+			select {
+			case s.ch <- e:
+			case <-s.done:
+			case <-ctx.Done():
+				return events, ctx.Err()
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Current returns the state recorded by the last poll
+func (w *Watcher) Current() (IncidentList, ResponderList) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	il := make(IncidentList, 0, len(w.incidents))
+	for _, inc := range w.incidents {
+		il = append(il, inc)
+	}
+
+	rl := make(ResponderList, 0, len(w.responders))
+	for _, r := range w.responders {
+		rl = append(rl, r)
+	}
+
+	sort.Slice(il, func(i, j int) bool { return il[i].Id < il[j].Id })
+	sort.Slice(rl, func(i, j int) bool { return rl[i].Id < rl[j].Id })
+	return il, rl
+}
+
+// CurrentMessages returns the messages recorded by the last poll, oldest first
+func (w *Watcher) CurrentMessages() MessageList {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ml := make(MessageList, 0, len(w.messages))
+	for _, m := range w.messages {
+		ml = append(ml, m)
+	}
+
+	sort.Slice(ml, func(i, j int) bool {
+		if ml[i].CreatedDate.Equal(ml[j].CreatedDate) {
+			return ml[i].Id < ml[j].Id
+		}
+		return ml[i].CreatedDate.Before(ml[j].CreatedDate)
+	})
+	return ml
+}
+
+// diff replaces the recorded state, and returns the events for the changes.  The caller must hold the lock.
+func (w *Watcher) diff(il IncidentList, rl ResponderList, ml MessageList) []*WatchEvent {
+	now := w.now()
+	events := make([]*WatchEvent, 0)
+
+	incidents := make(map[int]*Incident, len(il))
+	for _, inc := range il {
+		incidents[inc.Id] = inc
+
+		if old, ok := w.incidents[inc.Id]; !ok {
+			events = append(events, &WatchEvent{Type: EventIncidentAdded, Time: now, Incident: inc})
+		} else if old.UpdatedOn != inc.UpdatedOn || old.MessageBody != inc.MessageBody {
+			events = append(events, &WatchEvent{Type: EventIncidentUpdated, Time: now, Incident: inc})
+		}
+	}
+
+	responders := make(map[string]*Responder, len(rl))
+	for _, r := range rl {
+		responders[r.Id] = r
+
+		if old, ok := w.responders[r.Id]; !ok {
+			events = append(events, &WatchEvent{Type: EventResponderAdded, Time: now, Responder: r})
+		} else if responderChanged(old, r) {
+			events = append(events, &WatchEvent{Type: EventResponderUpdated, Time: now, Responder: r})
+		}
+	}
+
+	removed := make([]string, 0)
+	for id := range w.responders {
+		if _, ok := responders[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		events = append(events, &WatchEvent{Type: EventResponderRemoved, Time: now, Responder: w.responders[id]})
+	}
+
+	messages := make(map[string]*Message, len(ml))
+	for _, m := range ml {
+		messages[m.Id] = m
+
+		if _, ok := w.messages[m.Id]; !ok {
+			events = append(events, &WatchEvent{Type: EventMessageAdded, Time: now, Message: m})
+		}
+	}
+
+	w.incidents, w.responders, w.messages = incidents, responders, messages
+
+	if !w.primed {
+		w.primed = true
+		return events[:0]
+	}
+	return events
+}
+
+func responderChanged(a, b *Responder) bool {
+	return a.RespondingTo != b.RespondingTo || !a.EtaBefore.Equal(b.EtaBefore) || !a.CalledAt.Equal(b.CalledAt) ||
+		a.ResponseCodeId != b.ResponseCodeId || !a.Expired.Equal(b.Expired)
+}
@@ -0,0 +1,118 @@
+package iarapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeWatchSource struct {
+	incidents  IncidentList
+	responders ResponderList
+	messages   MessageList
+	err        error
+}
+
+func (f *fakeWatchSource) Incidents() (*IncidentList, error) {
+	return &f.incidents, f.err
+}
+
+func (f *fakeWatchSource) ResponderList() (*ResponderList, error) {
+	return &f.responders, f.err
+}
+
+func (f *fakeWatchSource) Messages() (*MessageList, error) {
+	return &f.messages, f.err
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	src := &fakeWatchSource{
+		incidents:  IncidentList{{Id: 1, UpdatedOn: "2022-11-04T10:00:00"}},
+		responders: ResponderList{{Id: "a", RespondingTo: "Station"}, {Id: "b"}},
+		messages:   MessageList{{Id: "m1", CreatedDate: time.Date(2022, 11, 4, 9, 0, 0, 0, time.UTC)}},
+	}
+
+	w := NewWatcher(src)
+	now := time.Date(2022, 11, 4, 10, 5, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	ch, stop := w.Subscribe(10)
+	defer stop()
+
+	if events, err := w.Poll(context.Background()); err != nil || len(events) != 0 {
+		t.Fatalf("first Poll() = %v, %v, want no events", events, err)
+	}
+
+	src.incidents = IncidentList{{Id: 1, UpdatedOn: "2022-11-04T10:04:00"}, {Id: 2}}
+	src.responders = ResponderList{{Id: "a", RespondingTo: "Scene"}, {Id: "c"}}
+	src.messages = MessageList{src.messages[0], {Id: "m2"}}
+
+	events, err := w.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*WatchEvent{
+		{Type: EventIncidentUpdated, Time: now, Incident: src.incidents[0]},
+		{Type: EventIncidentAdded, Time: now, Incident: src.incidents[1]},
+		{Type: EventResponderUpdated, Time: now, Responder: src.responders[0]},
+		{Type: EventResponderAdded, Time: now, Responder: src.responders[1]},
+		{Type: EventResponderRemoved, Time: now, Responder: &Responder{Id: "b"}},
+		{Type: EventMessageAdded, Time: now, Message: src.messages[1]},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Poll() = %v, want %v", events, want)
+	}
+
+	for i := range want {
+		if e := <-ch; e != events[i] {
+			t.Errorf("subscriber event %d = %+v, want %+v", i, e, events[i])
+		}
+	}
+
+	if il, rl := w.Current(); len(il) != 2 || il[0].Id != 1 || len(rl) != 2 || rl[1].Id != "c" {
+		t.Errorf("Current() = %v, %v", il, rl)
+	}
+
+	if ml := w.CurrentMessages(); len(ml) != 2 || ml[0].Id != "m2" || ml[1].Id != "m1" {
+		t.Errorf("CurrentMessages() = %v", ml)
+	}
+
+	src.err = errors.New("unavailable")
+	if _, err = w.Poll(context.Background()); err == nil {
+		t.Error("Poll() did not return source error")
+	}
+}
+
+func TestWatcher_Unsubscribe(t *testing.T) {
+	src := new(fakeWatchSource)
+	w := NewWatcher(src)
+
+	_, stop := w.Subscribe(0)
+	stop()
+	stop()
+
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	src.incidents = IncidentList{{Id: 1}}
+
+	// an unread, stopped subscription must not block polling
+	done := make(chan error)
+	go func() {
+		_, err := w.Poll(context.Background())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Poll() blocked on stopped subscriber")
+	}
+}
@@ -0,0 +1,395 @@
+// Package webhook delivers the events seen by an iarapi.Watcher to HTTP endpoints.
+//
+// Each event is POSTed to every target whose filter matches it.  The body is the JSON encoded event, or the output
+// of the target's template, and is signed with HMAC-SHA256 using the target's secret so receivers can verify it came
+// from us.  Failed deliveries are retried with exponential backoff, then written to a dead-letter file.
+//
+// Each target has its own delivery queue, so a slow or failing target delays neither the others nor the watcher.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+const (
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the request body, prefixed with "sha256="
+	SignatureHeader = "X-IAR-Signature"
+
+	// EventHeader holds the event type
+	EventHeader = "X-IAR-Event"
+
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultQueueSize   = 100
+)
+
+// Target is an endpoint receiving events
+type Target struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Secret is the HMAC key used to sign requests.  Requests are not signed if empty.
+	Secret string `json:"secret,omitempty"`
+
+	// Events are the event types sent to the target, all types if empty
+	Events []iarapi.EventType `json:"events,omitempty"`
+
+	// Template is a text/template producing the request body from the *iarapi.WatchEvent.  The json function encodes
+	// its argument as JSON.  The event is sent as JSON if empty.
+	Template string `json:"template,omitempty"`
+
+	// ContentType of the request, application/json if empty
+	ContentType string `json:"contentType,omitempty"`
+
+	// Headers are added to each request.  They can't replace the Content-Type, event or signature headers.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Filter further limits the events sent to the target, if set
+	Filter func(*iarapi.WatchEvent) bool `json:"-"`
+
+	tmpl *template.Template
+}
+
+// Match reports whether the event should be sent to the target
+func (t *Target) Match(e *iarapi.WatchEvent) bool {
+	if len(t.Events) > 0 {
+		var found bool
+		for _, et := range t.Events {
+			if et == e.Type {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return t.Filter == nil || t.Filter(e)
+}
+
+func (t *Target) payload(e *iarapi.WatchEvent) ([]byte, error) {
+	if t.tmpl == nil {
+		return json.Marshal(e)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.tmpl.Execute(buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadTargets reads a JSON array of targets
+func LoadTargets(r io.Reader) ([]*Target, error) {
+	targets := make([]*Target, 0)
+	if err := json.NewDecoder(r).Decode(&targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// DeadLetter is a delivery which failed after all attempts, as written to the dead-letter file
+type DeadLetter struct {
+	Time     time.Time          `json:"time"`
+	Target   string             `json:"target"`
+	URL      string             `json:"url"`
+	Attempts int                `json:"attempts"`
+	Error    string             `json:"error"`
+	Event    *iarapi.WatchEvent `json:"event"`
+	Payload  string             `json:"payload"`
+}
+
+// Dispatcher sends events to the targets
+type Dispatcher struct {
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+
+	// MaxAttempts is the number of delivery attempts for each event and target, DefaultMaxAttempts if 0
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubling for each following retry, DefaultBackoff if 0
+	Backoff time.Duration
+
+	// DeadLetterFile is the path of the JSON Lines file failed deliveries are appended to.  Failed deliveries are
+	// dropped if empty.
+	DeadLetterFile string
+
+	// QueueSize is the number of events waiting for delivery to each target in Run, DefaultQueueSize if 0.  Events
+	// for a target with a full queue are dead-lettered without being sent.
+	QueueSize int
+
+	// OnError is called when a delivery fails after all attempts, or is dropped
+	OnError func(*DeadLetter)
+
+	targets []*Target
+	mu      sync.Mutex
+}
+
+// NewDispatcher returns a Dispatcher for the targets, or an error if a target has no URL or an invalid template
+func NewDispatcher(targets ...*Target) (*Dispatcher, error) {
+	for i, t := range targets {
+		if len(t.URL) < 1 {
+			return nil, fmt.Errorf("target %d (%s) has no url", i, t.Name)
+		}
+
+		if len(t.Template) > 0 {
+			tmpl, err := template.New(t.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(t.Template)
+			if err != nil {
+				return nil, fmt.Errorf("target %d (%s) template: %v", i, t.Name, err)
+			}
+			t.tmpl = tmpl
+		}
+	}
+
+	return &Dispatcher{targets: targets}, nil
+}
+
+// Run subscribes to the watcher and delivers its events until ctx is done.  The watcher must be run separately.
+// Events are queued for each target and delivered in order, events still queued when ctx is done are not sent.
+func (d *Dispatcher) Run(ctx context.Context, w *iarapi.Watcher) error {
+	ch, stop := w.Subscribe(16)
+	defer stop()
+
+	size := d.QueueSize
+	if size < 1 {
+		size = DefaultQueueSize
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	queues := make([]chan *iarapi.WatchEvent, len(d.targets))
+	for i, t := range d.targets {
+		queues[i] = make(chan *iarapi.WatchEvent, size)
+
+		wg.Add(1)
+		go func(t *Target, q <-chan *iarapi.WatchEvent) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-q:
+					d.deliver(ctx, t, e)
+				}
+			}
+		}(t, queues[i])
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-ch:
+			for i, t := range d.targets {
+				if !t.Match(e) {
+					continue
+				}
+
+				select {
+				case queues[i] <- e:
+				default:
+					body, _ := t.payload(e)
+					d.deadLetter(&DeadLetter{Target: t.Name, URL: t.URL, Error: "delivery queue full", Event: e,
+						Payload: string(body)})
+				}
+			}
+		}
+	}
+}
+
+// Dispatch delivers the event to the matching targets concurrently, and waits for the deliveries to complete,
+// including retries.  It returns the number of deliveries which failed.
+func (d *Dispatcher) Dispatch(ctx context.Context, e *iarapi.WatchEvent) int {
+	var wg sync.WaitGroup
+	var failed int
+	var mu sync.Mutex
+
+	for _, t := range d.targets {
+		if !t.Match(e) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(t *Target) {
+			defer wg.Done()
+			if !d.deliver(ctx, t, e) {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(t)
+	}
+
+	wg.Wait()
+	return failed
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, t *Target, e *iarapi.WatchEvent) bool {
+	body, err := t.payload(e)
+	if err != nil {
+		d.deadLetter(&DeadLetter{Target: t.Name, URL: t.URL, Error: fmt.Sprintf("payload: %v", err), Event: e})
+		return false
+	}
+
+	maxAttempts := d.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+
+	var attempt int
+	for attempt = 1; ; attempt++ {
+		var retry bool
+		if retry, err = d.send(ctx, t, e, body); err == nil {
+			return true
+		}
+
+		if !retry || attempt >= maxAttempts {
+			break
+		}
+
+		if err = sleep(ctx, backoff); err != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	d.deadLetter(&DeadLetter{Target: t.Name, URL: t.URL, Attempts: attempt, Error: err.Error(), Event: e,
+		Payload: string(body)})
+	return false
+}
+
+// send makes a single delivery attempt, and reports whether a failure may succeed if retried
+func (d *Dispatcher) send(ctx context.Context, t *Target, e *iarapi.WatchEvent, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	ct := t.ContentType
+	if len(ct) < 1 {
+		ct = "application/json"
+	}
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set(EventHeader, string(e.Type))
+
+	// without a secret, a configured signature header would be passed off as ours
+	req.Header.Del(SignatureHeader)
+	if len(t.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(t.Secret, body))
+	}
+
+	hc := d.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests ||
+			res.StatusCode == http.StatusRequestTimeout
+		return retry, fmt.Errorf("%s returned %s", t.URL, res.Status)
+	}
+	return false, nil
+}
+
+// deadLetter records the failed delivery.  An error writing the dead-letter file is added to the error passed to
+// OnError.
+func (d *Dispatcher) deadLetter(dl *DeadLetter) {
+	dl.Time = time.Now()
+
+	if len(d.DeadLetterFile) > 0 {
+		if err := d.writeDeadLetter(dl); err != nil {
+			dl.Error += fmt.Sprintf("; writing dead letter: %v", err)
+		}
+	}
+
+	if d.OnError != nil {
+		d.OnError(dl)
+	}
+}
+
+func (d *Dispatcher) writeDeadLetter(dl *DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.OpenFile(d.DeadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Sign returns the signature header value of the body using secret
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature header value of the body using secret
+func Verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
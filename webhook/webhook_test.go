@@ -0,0 +1,312 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmmorris1975/iarapi"
+)
+
+type received struct {
+	event     string
+	signature string
+	body      string
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	requests []*received
+	status   []int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, &received{event: req.Header.Get(EventHeader),
+		signature: req.Header.Get(SignatureHeader), body: string(body)})
+
+	if len(r.status) > 0 {
+		w.WriteHeader(r.status[0])
+		r.status = r.status[1:]
+	}
+}
+
+var testEvent = &iarapi.WatchEvent{
+	Type:     iarapi.EventIncidentAdded,
+	Time:     time.Date(2022, 11, 4, 10, 0, 0, 0, time.UTC),
+	Incident: &iarapi.Incident{Id: 1, MessageBody: "STRUCTURE FIRE 100 MAIN ST"},
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	signed, templated, filtered := new(receiver), new(receiver), new(receiver)
+	srvs := make([]*httptest.Server, 0)
+	for _, r := range []*receiver{signed, templated, filtered} {
+		srvs = append(srvs, httptest.NewServer(r))
+		defer srvs[len(srvs)-1].Close()
+	}
+
+	d, err := NewDispatcher(
+		&Target{Name: "signed", URL: srvs[0].URL, Secret: "s3cret", Headers: map[string]string{SignatureHeader: "forged"}},
+		&Target{Name: "templated", URL: srvs[1].URL, ContentType: "text/plain",
+			Template: `{{.Type}} {{.Incident.Id}}: {{.Incident.MessageBody}} {{json .Incident.Id}}`,
+			Headers:  map[string]string{SignatureHeader: "forged"}},
+		&Target{Name: "filtered", URL: srvs[2].URL, Events: []iarapi.EventType{iarapi.EventMessageAdded}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed := d.Dispatch(context.Background(), testEvent); failed != 0 {
+		t.Errorf("Dispatch() failed = %d", failed)
+	}
+
+	if len(signed.requests) != 1 {
+		t.Fatalf("signed target received %d requests", len(signed.requests))
+	}
+
+	r := signed.requests[0]
+	if r.event != string(iarapi.EventIncidentAdded) || !Verify("s3cret", []byte(r.body), r.signature) {
+		t.Errorf("signed request = %+v", r)
+	}
+
+	e := new(iarapi.WatchEvent)
+	if err = json.Unmarshal([]byte(r.body), e); err != nil || e.Incident.Id != 1 {
+		t.Errorf("signed request body = %s, %v", r.body, err)
+	}
+
+	if len(templated.requests) != 1 || templated.requests[0].body != "incident.added 1: STRUCTURE FIRE 100 MAIN ST 1" ||
+		templated.requests[0].signature != "" {
+		t.Errorf("templated requests = %+v", templated.requests)
+	}
+
+	if len(filtered.requests) != 0 {
+		t.Errorf("filtered target received %d requests", len(filtered.requests))
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   []int
+		attempts int
+		failed   int
+	}{
+		{name: "recovers", status: []int{503, 429}, attempts: 3},
+		{name: "exhausted", status: []int{500, 502, 503}, attempts: 3, failed: 1},
+		{name: "permanent", status: []int{400}, attempts: 1, failed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := &receiver{status: tt.status}
+			srv := httptest.NewServer(rcv)
+			defer srv.Close()
+
+			dlf := filepath.Join(t.TempDir(), "dead.jsonl")
+			d, err := NewDispatcher(&Target{Name: "t", URL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.MaxAttempts = 3
+			d.Backoff = time.Millisecond
+			d.DeadLetterFile = dlf
+
+			var reported *DeadLetter
+			d.OnError = func(dl *DeadLetter) { reported = dl }
+
+			if failed := d.Dispatch(context.Background(), testEvent); failed != tt.failed {
+				t.Errorf("Dispatch() failed = %d, want %d", failed, tt.failed)
+			}
+
+			if len(rcv.requests) != tt.attempts {
+				t.Errorf("received %d attempts, want %d", len(rcv.requests), tt.attempts)
+			}
+
+			f, err := os.Open(dlf)
+			if tt.failed == 0 {
+				if !os.IsNotExist(err) || reported != nil {
+					t.Errorf("dead letter written for successful delivery")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			s := bufio.NewScanner(f)
+			s.Scan()
+
+			dl := new(DeadLetter)
+			if err = json.Unmarshal(s.Bytes(), dl); err != nil {
+				t.Fatal(err)
+			}
+
+			if dl.Target != "t" || dl.Attempts != tt.attempts || dl.Event.Incident.Id != 1 || len(dl.Payload) < 1 ||
+				reported == nil || reported.Error != dl.Error {
+				t.Errorf("dead letter = %+v", dl)
+			}
+		})
+	}
+}
+
+type fakeSource struct {
+	mu        sync.Mutex
+	incidents iarapi.IncidentList
+}
+
+func (f *fakeSource) add(inc *iarapi.Incident) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.incidents = append(f.incidents, inc)
+}
+
+func (f *fakeSource) Incidents() (*iarapi.IncidentList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	il := append(iarapi.IncidentList(nil), f.incidents...)
+	return &il, nil
+}
+
+func (f *fakeSource) ResponderList() (*iarapi.ResponderList, error) {
+	return &iarapi.ResponderList{}, nil
+}
+
+func (f *fakeSource) Messages() (*iarapi.MessageList, error) {
+	return &iarapi.MessageList{}, nil
+}
+
+func TestDispatcher_Run_SlowTarget(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	fast := new(receiver)
+	fastSrv := httptest.NewServer(fast)
+	t.Cleanup(fastSrv.Close)
+
+	d, err := NewDispatcher(&Target{Name: "slow", URL: slow.URL}, &Target{Name: "fast", URL: fastSrv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.QueueSize = 1
+
+	dropped := make(chan *DeadLetter, 10)
+	d.OnError = func(dl *DeadLetter) { dropped <- dl }
+
+	src := new(fakeSource)
+	w := iarapi.NewWatcher(src)
+	if _, err = w.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx, w) }()
+
+	// Run may not have subscribed yet, so keep adding incidents until the slow target's queue overflows.  None of
+	// the polls may block.
+	var dl *DeadLetter
+	for i := 1; i <= 1000 && dl == nil; i++ {
+		src.add(&iarapi.Incident{Id: i})
+
+		pollCtx, pollCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = w.Poll(pollCtx)
+		pollCancel()
+		if err != nil {
+			t.Fatalf("Poll() blocked by slow target: %v", err)
+		}
+
+		select {
+		case dl = <-dropped:
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	if dl == nil {
+		t.Fatal("no dead letter for the full queue")
+	} else if dl.Target != "slow" || dl.Error != "delivery queue full" {
+		t.Errorf("dead letter = %+v", dl)
+	}
+
+	for i := 0; i < 200; i++ {
+		fast.mu.Lock()
+		n := len(fast.requests)
+		fast.mu.Unlock()
+
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	fast.mu.Lock()
+	defer fast.mu.Unlock()
+	if len(fast.requests) < 1 {
+		t.Error("fast target received no events")
+	}
+}
+
+func TestNewDispatcher(t *testing.T) {
+	if _, err := NewDispatcher(&Target{Name: "bad", URL: "http://localhost", Template: "{{.Type"}); err == nil {
+		t.Error("NewDispatcher() accepted invalid template")
+	}
+
+	if _, err := NewDispatcher(&Target{Name: "nourl"}); err == nil {
+		t.Error("NewDispatcher() accepted target without url")
+	}
+
+	targets, err := LoadTargets(strings.NewReader(`[{"name": "a", "url": "http://localhost/hook", "events": ["incident.added"]}]`))
+	if err != nil || len(targets) != 1 || !targets[0].Match(testEvent) ||
+		targets[0].Match(&iarapi.WatchEvent{Type: iarapi.EventMessageAdded}) {
+		t.Errorf("LoadTargets() = %+v, %v", targets, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"incident.added"}`)
+	sig := Sign("key", body)
+
+	tests := []struct {
+		name   string
+		secret string
+		sig    string
+		want   bool
+	}{
+		{name: "valid", secret: "key", sig: sig, want: true},
+		{name: "wrong key", secret: "other", sig: sig},
+		{name: "no prefix", secret: "key", sig: strings.TrimPrefix(sig, "sha256=")},
+		{name: "empty", secret: "key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, body, tt.sig); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}